@@ -0,0 +1,97 @@
+// Command kosuzuc compiles kosuzu schema files
+// into the code encoding and decoding the messages.
+//
+// Usage:
+//
+//	kosuzuc [-lang go|ts|cs|py] [-package name] [-o output] schema.kosuzu
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zergon321/kosuzu/gen"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+func main() {
+	lang := flag.String("lang", "go",
+		"language of the generated code: go, ts, cs or py")
+	pkg := flag.String("package", "",
+		"name of the generated Go package or C# namespace (overrides the schema package clause)")
+	output := flag.String("o", "",
+		"output file (standard output if empty)")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"usage: kosuzuc [flags] schema.kosuzu\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	err := run(flag.Arg(0), *lang, *pkg, *output)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kosuzuc:", err)
+		os.Exit(1)
+	}
+}
+
+func run(path, lang, pkg, output string) error {
+	sch, err := schema.ParseFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	switch lang {
+	case "go":
+		if pkg == "" {
+			pkg = sch.Package
+		}
+
+		if pkg == "" {
+			return fmt.Errorf(
+				"package name is not specified in the schema or with -package")
+		}
+
+		err = gen.Go(buf, sch, pkg)
+
+	case "ts":
+		err = gen.TypeScript(buf, sch)
+
+	case "cs":
+		if pkg == "" {
+			pkg = sch.Package
+		}
+
+		err = gen.CSharp(buf, sch, pkg)
+
+	case "py":
+		err = gen.Python(buf, sch)
+
+	default:
+		err = fmt.Errorf("unknown language: %s", lang)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	return os.WriteFile(output, buf.Bytes(), 0644)
+}
@@ -0,0 +1,68 @@
+// Command kosuzucompat compares two versions of
+// the kosuzu schema and reports the breaking changes.
+// The schemas are read from the schema source files
+// or, for the files with the .json extension, from
+// the JSON produced by kosuzu.SchemaOf.
+//
+// It exits with status 1 if there are breaking
+// changes and with status 2 if the schemas
+// cannot be read, so it can be used in CI.
+//
+// Usage:
+//
+//	kosuzucompat old.kosuzu new.kosuzu
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"usage: kosuzucompat old.kosuzu new.kosuzu\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	changes, err := run(flag.Arg(0), flag.Arg(1))
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kosuzucompat:", err)
+		os.Exit(2)
+	}
+
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
+
+func run(oldPath, newPath string) ([]schema.Change, error) {
+	old, err := schema.ParseFile(oldPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	new, err := schema.ParseFile(newPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return schema.Compare(old, new), nil
+}
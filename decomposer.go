@@ -3,33 +3,125 @@ package kosuzu
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
 )
 
 // Decomposer allows you to read
 // values of different types from the packet.
 type Decomposer struct {
 	buffer *bytes.Reader
+	// data is the slice of the payload
+	// the buffer reads.
+	data []byte
+	// opcode is the opcode of the packet
+	// reported in the decode errors.
+	opcode int32
+	// base is the offset of the buffer
+	// in the packet payload.
+	base int64
+	// limits restrict the memory
+	// allocated for the decoded values.
+	limits Limits
+	// allocated is the number of bytes
+	// allocated for the decoded values,
+	// shared with the sub-decomposers.
+	allocated *int64
+	// checks are the checks of
+	// the decoded values.
+	checks Check
+}
+
+// Check is the check of the values read from
+// the packet the Decomposer makes in addition
+// to the checks of the payload bounds.
+type Check int
+
+const (
+	// CheckBools rejects bools
+	// encoded other than as 0 or 1.
+	CheckBools Check = 1 << iota
+	// CheckUTF8 rejects strings
+	// that are not valid UTF-8.
+	CheckUTF8
+)
+
+// SetChecks sets the checks of
+// the values read from the packet.
+func (decomposer *Decomposer) SetChecks(checks Check) {
+	decomposer.checks = checks
+}
+
+// checkBools returns an error if the bools
+// are not canonical and CheckBools is set.
+func (decomposer *Decomposer) checkBools(raw []uint8) error {
+	if decomposer.checks&CheckBools == 0 {
+		return nil
+	}
+
+	for _, b := range raw {
+		if b > 1 {
+			return fmt.Errorf("%w: bool encoded as %d", ErrNonCanonical, b)
+		}
+	}
+
+	return nil
+}
+
+// Limits restrict the memory the Decomposer
+// allocates for the values read from the packet,
+// so the hostile length prefixes can't exhaust it.
+// Zero fields mean no limit. Regardless of the
+// limits, the length prefix is never allowed
+// to exceed the rest of the payload.
+type Limits struct {
+	// MaxStringLength is the maximum
+	// length of a string in bytes.
+	MaxStringLength int
+	// MaxArrayLength is the maximum number
+	// of elements in a slice or a map.
+	MaxArrayLength int
+	// MaxAllocation is the maximum total
+	// number of bytes allocated for strings,
+	// slices and maps read from the packet.
+	MaxAllocation int64
+}
+
+// SetLimits sets the limits for
+// the values read from the packet.
+func (decomposer *Decomposer) SetLimits(limits Limits) {
+	decomposer.limits = limits
 }
 
 // ReadBool reads a bool value from the packet.
 func (decomposer *Decomposer) ReadBool() (bool, error) {
-	var result bool
+	offset := decomposer.offset()
+	var result uint8
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return false, err
+		return false, decomposer.fail(offset, "bool", err)
 	}
 
-	return result, nil
+	err = decomposer.checkBools([]uint8{result})
+
+	if err != nil {
+		return false, decomposer.fail(offset, "bool", err)
+	}
+
+	return result != 0, nil
 }
 
 // ReadRune reads a rune value from the packet.
 func (decomposer *Decomposer) ReadRune() (rune, int, error) {
+	offset := decomposer.offset()
 	var result rune
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 'や', 3, err
+		return 'や', 3, decomposer.fail(offset, "rune", err)
 	}
 
 	return result, len(string(result)), nil
@@ -37,11 +129,12 @@ func (decomposer *Decomposer) ReadRune() (rune, int, error) {
 
 // ReadByte reads a byte value from the packet.
 func (decomposer *Decomposer) ReadByte() (byte, error) {
+	offset := decomposer.offset()
 	var result byte
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "byte", err)
 	}
 
 	return result, nil
@@ -49,11 +142,12 @@ func (decomposer *Decomposer) ReadByte() (byte, error) {
 
 // ReadInt8 reads an int8 value from the packet.
 func (decomposer *Decomposer) ReadInt8() (int8, error) {
+	offset := decomposer.offset()
 	var result int8
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "int8", err)
 	}
 
 	return result, nil
@@ -61,11 +155,12 @@ func (decomposer *Decomposer) ReadInt8() (int8, error) {
 
 // ReadInt16 reads an int16 value from the packet.
 func (decomposer *Decomposer) ReadInt16() (int16, error) {
+	offset := decomposer.offset()
 	var result int16
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "int16", err)
 	}
 
 	return result, nil
@@ -73,11 +168,12 @@ func (decomposer *Decomposer) ReadInt16() (int16, error) {
 
 // ReadInt32 reads an int32 value from the packet.
 func (decomposer *Decomposer) ReadInt32() (int32, error) {
+	offset := decomposer.offset()
 	var result int32
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "int32", err)
 	}
 
 	return result, nil
@@ -85,11 +181,12 @@ func (decomposer *Decomposer) ReadInt32() (int32, error) {
 
 // ReadInt64 reads an int64 value from the packet.
 func (decomposer *Decomposer) ReadInt64() (int64, error) {
+	offset := decomposer.offset()
 	var result int64
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "int64", err)
 	}
 
 	return result, nil
@@ -97,11 +194,12 @@ func (decomposer *Decomposer) ReadInt64() (int64, error) {
 
 // ReadUint8 reads a uint8 value from the packet.
 func (decomposer *Decomposer) ReadUint8() (uint8, error) {
+	offset := decomposer.offset()
 	var result uint8
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "uint8", err)
 	}
 
 	return result, nil
@@ -109,11 +207,12 @@ func (decomposer *Decomposer) ReadUint8() (uint8, error) {
 
 // ReadUint16 reads a uint16 value from the packet.
 func (decomposer *Decomposer) ReadUint16() (uint16, error) {
+	offset := decomposer.offset()
 	var result uint16
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "uint16", err)
 	}
 
 	return result, nil
@@ -121,11 +220,12 @@ func (decomposer *Decomposer) ReadUint16() (uint16, error) {
 
 // ReadUint32 reads a uint32 value from the packet.
 func (decomposer *Decomposer) ReadUint32() (uint32, error) {
+	offset := decomposer.offset()
 	var result uint32
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "uint32", err)
 	}
 
 	return result, nil
@@ -133,11 +233,12 @@ func (decomposer *Decomposer) ReadUint32() (uint32, error) {
 
 // ReadUint64 reads a uint64 value from the packet.
 func (decomposer *Decomposer) ReadUint64() (uint64, error) {
+	offset := decomposer.offset()
 	var result uint64
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "uint64", err)
 	}
 
 	return result, nil
@@ -145,11 +246,12 @@ func (decomposer *Decomposer) ReadUint64() (uint64, error) {
 
 // ReadFloat32 reads a float32 value from the packet.
 func (decomposer *Decomposer) ReadFloat32() (float32, error) {
+	offset := decomposer.offset()
 	var result float32
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "float32", err)
 	}
 
 	return result, nil
@@ -157,11 +259,12 @@ func (decomposer *Decomposer) ReadFloat32() (float32, error) {
 
 // ReadFloat64 reads a float64 value from the packet.
 func (decomposer *Decomposer) ReadFloat64() (float64, error) {
+	offset := decomposer.offset()
 	var result float64
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "float64", err)
 	}
 
 	return result, nil
@@ -169,11 +272,12 @@ func (decomposer *Decomposer) ReadFloat64() (float64, error) {
 
 // ReadComplex64 reads a complex64 value from the packet.
 func (decomposer *Decomposer) ReadComplex64() (complex64, error) {
+	offset := decomposer.offset()
 	var result complex64
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "complex64", err)
 	}
 
 	return result, nil
@@ -181,11 +285,12 @@ func (decomposer *Decomposer) ReadComplex64() (complex64, error) {
 
 // ReadComplex128 reads a complex128 value from the packet.
 func (decomposer *Decomposer) ReadComplex128() (complex128, error) {
+	offset := decomposer.offset()
 	var result complex128
 	err := binary.Read(decomposer.buffer, binary.BigEndian, &result)
 
 	if err != nil {
-		return 0, err
+		return 0, decomposer.fail(offset, "complex128", err)
 	}
 
 	return result, nil
@@ -193,18 +298,24 @@ func (decomposer *Decomposer) ReadComplex128() (complex128, error) {
 
 // ReadString reads a string value from the packet.
 func (decomposer *Decomposer) ReadString() (string, error) {
-	// Read the string length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readLength(offset, "string",
+		decomposer.limits.MaxStringLength, 1, 1)
 
 	if err != nil {
 		return "", err
 	}
 
 	strBytes := make([]byte, length)
-	_, err = decomposer.buffer.Read(strBytes)
+	_, err = io.ReadFull(decomposer.buffer, strBytes)
 
 	if err != nil {
-		return "", err
+		return "", decomposer.fail(offset, "string", err)
+	}
+
+	if decomposer.checks&CheckUTF8 != 0 && !utf8.Valid(strBytes) {
+		return "", decomposer.fail(offset, "string",
+			fmt.Errorf("%w: invalid UTF-8", ErrNonCanonical))
 	}
 
 	return string(strBytes), nil
@@ -212,26 +323,26 @@ func (decomposer *Decomposer) ReadString() (string, error) {
 
 // ReadByteArray reads bytes from the packet.
 func (decomposer *Decomposer) ReadByteArray() ([]byte, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]byte", 1)
 
 	if err != nil {
 		return nil, err
 	}
 
 	bytes := make([]byte, length)
-	_, err = decomposer.buffer.Read(bytes)
+	_, err = io.ReadFull(decomposer.buffer, bytes)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]byte", err)
 	}
 
 	return bytes, nil
 }
 
 func (decomposer *Decomposer) ReadInt8Array() ([]int8, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]int8", 1)
 
 	if err != nil {
 		return nil, err
@@ -241,15 +352,15 @@ func (decomposer *Decomposer) ReadInt8Array() ([]int8, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]int8", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadUint8Array() ([]uint8, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]uint8", 1)
 
 	if err != nil {
 		return nil, err
@@ -259,15 +370,15 @@ func (decomposer *Decomposer) ReadUint8Array() ([]uint8, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]uint8", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadInt16Array() ([]int16, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]int16", 2)
 
 	if err != nil {
 		return nil, err
@@ -277,15 +388,15 @@ func (decomposer *Decomposer) ReadInt16Array() ([]int16, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]int16", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadUint16Array() ([]uint16, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]uint16", 2)
 
 	if err != nil {
 		return nil, err
@@ -295,15 +406,15 @@ func (decomposer *Decomposer) ReadUint16Array() ([]uint16, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]uint16", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadInt32Array() ([]int32, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]int32", 4)
 
 	if err != nil {
 		return nil, err
@@ -313,15 +424,15 @@ func (decomposer *Decomposer) ReadInt32Array() ([]int32, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]int32", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadUint32Array() ([]uint32, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]uint32", 4)
 
 	if err != nil {
 		return nil, err
@@ -331,15 +442,15 @@ func (decomposer *Decomposer) ReadUint32Array() ([]uint32, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]uint32", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadInt64Array() ([]int64, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]int64", 8)
 
 	if err != nil {
 		return nil, err
@@ -349,15 +460,15 @@ func (decomposer *Decomposer) ReadInt64Array() ([]int64, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]int64", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadUint64Array() ([]uint64, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]uint64", 8)
 
 	if err != nil {
 		return nil, err
@@ -367,15 +478,15 @@ func (decomposer *Decomposer) ReadUint64Array() ([]uint64, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]uint64", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadFloat32Array() ([]float32, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]float32", 4)
 
 	if err != nil {
 		return nil, err
@@ -385,15 +496,15 @@ func (decomposer *Decomposer) ReadFloat32Array() ([]float32, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]float32", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadFloat64Array() ([]float64, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]float64", 8)
 
 	if err != nil {
 		return nil, err
@@ -403,15 +514,15 @@ func (decomposer *Decomposer) ReadFloat64Array() ([]float64, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]float64", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadComplex64Array() ([]complex64, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]complex64", 8)
 
 	if err != nil {
 		return nil, err
@@ -421,15 +532,15 @@ func (decomposer *Decomposer) ReadComplex64Array() ([]complex64, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]complex64", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadComplex128Array() ([]complex128, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]complex128", 16)
 
 	if err != nil {
 		return nil, err
@@ -439,33 +550,45 @@ func (decomposer *Decomposer) ReadComplex128Array() ([]complex128, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]complex128", err)
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadBoolArray() ([]bool, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]bool", 1)
 
 	if err != nil {
 		return nil, err
 	}
 
-	val := make([]bool, length)
-	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
+	raw := make([]uint8, length)
+	_, err = io.ReadFull(decomposer.buffer, raw)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]bool", err)
+	}
+
+	err = decomposer.checkBools(raw)
+
+	if err != nil {
+		return nil, decomposer.fail(offset, "[]bool", err)
+	}
+
+	val := make([]bool, length)
+
+	for i, b := range raw {
+		val[i] = b != 0
 	}
 
 	return val, nil
 }
 
 func (decomposer *Decomposer) ReadRuneArray() ([]rune, error) {
-	// Read the byte slice length.
-	length, err := decomposer.ReadInt32()
+	offset := decomposer.offset()
+	length, err := decomposer.readArrayLength(offset, "[]rune", 4)
 
 	if err != nil {
 		return nil, err
@@ -475,7 +598,7 @@ func (decomposer *Decomposer) ReadRuneArray() ([]rune, error) {
 	err = binary.Read(decomposer.buffer, binary.BigEndian, &val)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, "[]rune", err)
 	}
 
 	return val, nil
@@ -483,11 +606,12 @@ func (decomposer *Decomposer) ReadRuneArray() ([]rune, error) {
 
 // ReadNBytes reads n bytes from the packet.
 func (decomposer *Decomposer) ReadNBytes(n int) ([]byte, error) {
+	offset := decomposer.offset()
 	bytes := make([]byte, n)
-	_, err := decomposer.buffer.Read(bytes)
+	_, err := io.ReadFull(decomposer.buffer, bytes)
 
 	if err != nil {
-		return nil, err
+		return nil, decomposer.fail(offset, fmt.Sprintf("[%d]byte", n), err)
 	}
 
 	return bytes, nil
@@ -497,6 +621,107 @@ func (decomposer *Decomposer) ReadNBytes(n int) ([]byte, error) {
 // to read values of certain types from the packet.
 func NewPacketDecomposer(packet *Packet) *Decomposer {
 	return &Decomposer{
-		buffer: bytes.NewReader(packet.payload),
+		buffer:    bytes.NewReader(packet.payload),
+		data:      packet.payload,
+		opcode:    packet.Opcode,
+		allocated: new(int64),
+	}
+}
+
+// offset returns the offset of the next
+// value in the packet payload.
+func (decomposer *Decomposer) offset() int64 {
+	return decomposer.base + decomposer.Offset()
+}
+
+// fail returns the *DecodeError for the value
+// of the type starting at the offset. The end
+// of the payload is reported as ErrTruncated.
+func (decomposer *Decomposer) fail(offset int64, typ string, err error) error {
+	var decodeErr *DecodeError
+
+	if errors.As(err, &decodeErr) {
+		err = decodeErr.Err
+	}
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+
+	return &DecodeError{
+		Opcode: decomposer.opcode,
+		Offset: offset,
+		Type:   typ,
+		Err:    err,
+	}
+}
+
+// readLength reads the int32 length prefix of
+// the value of the type starting at the offset.
+// The value consists of length elements taking
+// at least wireSize bytes in the payload and
+// memSize bytes in memory each, so the length
+// is checked against the rest of the payload,
+// maxLength and the allocation limit before
+// the value is allocated. Every element is
+// counted as at least one byte, so the payload
+// can't claim billions of zero-size elements
+// such as empty structs.
+func (decomposer *Decomposer) readLength(offset int64, typ string, maxLength int, wireSize, memSize int64) (int, error) {
+	length, err := decomposer.ReadInt32()
+
+	if err != nil {
+		return 0, decomposer.fail(offset, typ, err)
 	}
+
+	if length < 0 {
+		return 0, decomposer.fail(offset, typ,
+			fmt.Errorf("%w: %d", ErrInvalidLength, length))
+	}
+
+	if maxLength > 0 && int(length) > maxLength {
+		return 0, decomposer.fail(offset, typ, fmt.Errorf(
+			"%w: length %d exceeds %d", ErrLimitExceeded, length, maxLength))
+	}
+
+	if wireSize < 1 {
+		wireSize = 1
+	}
+
+	if int64(length)*wireSize > int64(decomposer.buffer.Len()) {
+		return 0, decomposer.fail(offset, typ, fmt.Errorf(
+			"%w: length %d exceeds the remaining %d bytes",
+			ErrTruncated, length, decomposer.buffer.Len()))
+	}
+
+	err = decomposer.allocate(int64(length) * memSize)
+
+	if err != nil {
+		return 0, decomposer.fail(offset, typ, err)
+	}
+
+	return int(length), nil
+}
+
+// readArrayLength reads the length prefix of
+// the array with the elements of the given size.
+func (decomposer *Decomposer) readArrayLength(offset int64, typ string, elemSize int64) (int, error) {
+	return decomposer.readLength(offset, typ,
+		decomposer.limits.MaxArrayLength, elemSize, elemSize)
+}
+
+// allocate accounts the bytes about to be
+// allocated for the decoded values and returns
+// an error if they exceed the allocation limit.
+func (decomposer *Decomposer) allocate(size int64) error {
+	total := *decomposer.allocated + size
+
+	if limit := decomposer.limits.MaxAllocation; limit > 0 && total > limit {
+		return fmt.Errorf("%w: %d bytes requested, %d of %d allocated",
+			ErrLimitExceeded, size, *decomposer.allocated, limit)
+	}
+
+	*decomposer.allocated = total
+
+	return nil
 }
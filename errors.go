@@ -0,0 +1,77 @@
+package kosuzu
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrTruncated is returned when the payload
+	// ends before the value being read. It wraps
+	// io.ErrUnexpectedEOF.
+	ErrTruncated = fmt.Errorf("payload is truncated: %w", io.ErrUnexpectedEOF)
+	// ErrTrailingBytes is returned when the payload
+	// has bytes left after the last value expected.
+	ErrTrailingBytes = errors.New("payload has trailing bytes")
+	// ErrInvalidLength is returned when the length
+	// prefix of a string, slice or map is negative.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrLimitExceeded is returned when the value
+	// read from the packet exceeds the limits
+	// set with Decomposer.SetLimits.
+	ErrLimitExceeded = errors.New("decoding limit exceeded")
+	// ErrNonCanonical is returned when the value
+	// fails the check set with Decomposer.SetChecks.
+	ErrNonCanonical = errors.New("non-canonical value")
+)
+
+// DecodeError describes the value which
+// couldn't be read from the packet payload.
+// Use errors.Is with ErrTruncated, ErrTrailingBytes,
+// ErrInvalidLength, ErrLimitExceeded and
+// ErrNonCanonical to check its cause.
+type DecodeError struct {
+	// Opcode is the opcode of the packet.
+	Opcode int32
+	// Path is the path of the field
+	// being read by Deserialize, e.g.
+	// Inventory.Items[3].Name. It's empty
+	// for the errors returned by Decomposer.
+	Path string
+	// Offset is the offset of the value
+	// in the packet payload.
+	Offset int64
+	// Type is the type of the value.
+	Type string
+	// Err is the cause of the error.
+	Err error
+}
+
+// Error returns the description of the error.
+func (err *DecodeError) Error() string {
+	if err.Path == "" {
+		return fmt.Sprintf("opcode %d: %s at offset %d: %v",
+			err.Opcode, err.Type, err.Offset, err.Err)
+	}
+
+	return fmt.Sprintf("opcode %d: %s (%s) at offset %d: %v",
+		err.Opcode, err.Path, err.Type, err.Offset, err.Err)
+}
+
+// Unwrap returns the cause of the error.
+func (err *DecodeError) Unwrap() error {
+	return err.Err
+}
+
+// withPath prepends the path segment to the
+// path of the decode error wrapped by err.
+func withPath(err error, segment string) error {
+	var decodeErr *DecodeError
+
+	if errors.As(err, &decodeErr) {
+		decodeErr.Path = segment + decodeErr.Path
+	}
+
+	return err
+}
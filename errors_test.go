@@ -0,0 +1,68 @@
+package kosuzu_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type Item struct {
+	ID   int32
+	Name string
+}
+
+type Inventory struct {
+	Owner string
+	Items []Item
+}
+
+func TestDecodeError(t *testing.T) {
+	packet, err := kosuzu.Serialize(5, &Inventory{
+		Owner: "kosuzu",
+		Items: []Item{{1, "book"}, {2, "scroll"}, {3, "lamp"}, {4, "bell"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := packet.Payload()
+	truncated := kosuzu.NewPacket(5, payload[:len(payload)-2])
+	err = kosuzu.Deserialize(truncated, &Inventory{})
+
+	var decodeErr *kosuzu.DecodeError
+
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("expected *DecodeError, got %v", err)
+	}
+
+	// Owner, Items length, 3 items and the ID of the 4th one.
+	offset := int64(4 + 6 + 4 + (4+4+4)*2 + (4 + 4 + 6) + 4)
+
+	if decodeErr.Opcode != 5 || decodeErr.Path != "Inventory.Items[3].Name" ||
+		decodeErr.Type != "string" || decodeErr.Offset != offset {
+		t.Fatalf("unexpected error: %v", decodeErr)
+	}
+
+	if !errors.Is(err, kosuzu.ErrTruncated) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+
+	corrupted := append([]byte{}, payload...)
+	copy(corrupted[10:], []byte{0xff, 0xff, 0xff, 0xff})
+	err = kosuzu.Deserialize(kosuzu.NewPacket(5, corrupted), &Inventory{})
+
+	if !errors.As(err, &decodeErr) || !errors.Is(err, kosuzu.ErrInvalidLength) ||
+		decodeErr.Path != "Inventory.Items" || decodeErr.Offset != 10 {
+		t.Fatalf("expected invalid length of Inventory.Items, got %v", err)
+	}
+
+	_, err = kosuzu.NewPacketDecomposer(kosuzu.NewPacket(5, []byte{0, 0})).ReadInt32()
+
+	if !errors.As(err, &decodeErr) || decodeErr.Type != "int32" ||
+		!errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected truncated int32, got %v", err)
+	}
+}
@@ -0,0 +1,502 @@
+// Code generated by kosuzuc. DO NOT EDIT.
+
+using System;
+using System.Collections.Generic;
+using System.IO;
+using System.Numerics;
+using System.Text;
+
+namespace Example
+{
+    public enum Opcode : int
+    {
+        PlayerMovement = 32,
+    }
+
+    public sealed class PlayerMovement
+    {
+        public int ID;
+        public double X;
+        public double Y;
+
+        public void Write(BinaryWriter writer)
+        {
+            Kosuzu.WriteInt32(writer, ID);
+            Kosuzu.WriteFloat64(writer, X);
+            Kosuzu.WriteFloat64(writer, Y);
+        }
+
+        public void Read(BinaryReader reader)
+        {
+            ID = Kosuzu.ReadInt32(reader);
+            X = Kosuzu.ReadFloat64(reader);
+            Y = Kosuzu.ReadFloat64(reader);
+        }
+
+        public byte[] Serialize(bool checksum = false)
+        {
+            return Kosuzu.PacketBytes((int)Opcode.PlayerMovement, Kosuzu.Encode(Write), checksum);
+        }
+
+        public static PlayerMovement Deserialize(byte[] data)
+        {
+            var packet = Kosuzu.PacketFromBytes(data);
+
+            if (packet.Opcode != (int)Opcode.PlayerMovement)
+            {
+                throw new InvalidDataException(
+                    $"expected opcode {(int)Opcode.PlayerMovement}, got {packet.Opcode}");
+            }
+
+            var msg = new PlayerMovement();
+            Kosuzu.Decode(packet.Payload, msg.Read);
+
+            return msg;
+        }
+    }
+
+    public sealed class Choice
+    {
+        public int Parameter;
+        public long[] Numbers = new long[0];
+        public Complex[] Parameters = new Complex[0];
+        public byte[] Payload = new byte[0];
+        public string Comment = "";
+
+        public void Write(BinaryWriter writer)
+        {
+            Kosuzu.WriteInt32(writer, Parameter);
+            Kosuzu.WriteArray(writer, Numbers, Kosuzu.WriteInt64);
+            Kosuzu.WriteArray(writer, Parameters, Kosuzu.WriteComplex128);
+            Kosuzu.WriteBytes(writer, Payload);
+            Kosuzu.WriteString(writer, Comment);
+        }
+
+        public void Read(BinaryReader reader)
+        {
+            Parameter = Kosuzu.ReadInt32(reader);
+            Numbers = Kosuzu.ReadArray(reader, Kosuzu.ReadInt64);
+            Parameters = Kosuzu.ReadArray(reader, Kosuzu.ReadComplex128);
+            Payload = Kosuzu.ReadBytes(reader);
+            Comment = Kosuzu.ReadString(reader);
+        }
+    }
+
+    public static class Kosuzu
+    {
+        public struct Packet
+        {
+            public int Opcode;
+            public byte[] Payload;
+            public uint? KeyID;
+            public uint? CorrelationID;
+            public byte[] Signature;
+        }
+
+        const byte FlagChecksum = 1;
+        const byte FlagSignature = 2;
+        const byte FlagCorrelation = 4;
+        const long LengthMask = (1L << 56) - 1;
+
+        static readonly uint[] CrcTable = MakeCrcTable();
+
+        static uint[] MakeCrcTable()
+        {
+            var table = new uint[256];
+
+            for (uint i = 0; i < 256; i++)
+            {
+                var crc = i;
+
+                for (var j = 0; j < 8; j++)
+                {
+                    crc = (crc & 1) != 0 ? (crc >> 1) ^ 0x82f63b78 : crc >> 1;
+                }
+
+                table[i] = crc;
+            }
+
+            return table;
+        }
+
+        public static uint Crc32C(byte[] data)
+        {
+            var crc = 0xffffffff;
+
+            foreach (var b in data)
+            {
+                crc = CrcTable[(crc ^ b) & 0xff] ^ (crc >> 8);
+            }
+
+            return crc ^ 0xffffffff;
+        }
+
+        public static void WriteBool(BinaryWriter writer, bool value)
+        {
+            writer.Write((byte)(value ? 1 : 0));
+        }
+
+        public static void WriteInt8(BinaryWriter writer, sbyte value)
+        {
+            writer.Write(value);
+        }
+
+        public static void WriteUInt8(BinaryWriter writer, byte value)
+        {
+            writer.Write(value);
+        }
+
+        public static void WriteInt16(BinaryWriter writer, short value)
+        {
+            WriteUInt16(writer, (ushort)value);
+        }
+
+        public static void WriteUInt16(BinaryWriter writer, ushort value)
+        {
+            writer.Write((byte)(value >> 8));
+            writer.Write((byte)value);
+        }
+
+        public static void WriteInt32(BinaryWriter writer, int value)
+        {
+            WriteUInt32(writer, (uint)value);
+        }
+
+        public static void WriteUInt32(BinaryWriter writer, uint value)
+        {
+            WriteUInt16(writer, (ushort)(value >> 16));
+            WriteUInt16(writer, (ushort)value);
+        }
+
+        public static void WriteInt64(BinaryWriter writer, long value)
+        {
+            WriteUInt64(writer, (ulong)value);
+        }
+
+        public static void WriteUInt64(BinaryWriter writer, ulong value)
+        {
+            WriteUInt32(writer, (uint)(value >> 32));
+            WriteUInt32(writer, (uint)value);
+        }
+
+        public static void WriteFloat32(BinaryWriter writer, float value)
+        {
+            WriteInt32(writer, BitConverter.ToInt32(BitConverter.GetBytes(value), 0));
+        }
+
+        public static void WriteFloat64(BinaryWriter writer, double value)
+        {
+            WriteInt64(writer, BitConverter.DoubleToInt64Bits(value));
+        }
+
+        public static void WriteComplex64(BinaryWriter writer, Complex value)
+        {
+            WriteFloat32(writer, (float)value.Real);
+            WriteFloat32(writer, (float)value.Imaginary);
+        }
+
+        public static void WriteComplex128(BinaryWriter writer, Complex value)
+        {
+            WriteFloat64(writer, value.Real);
+            WriteFloat64(writer, value.Imaginary);
+        }
+
+        public static void WriteBytes(BinaryWriter writer, byte[] value)
+        {
+            value = value ?? new byte[0];
+            WriteInt32(writer, value.Length);
+            writer.Write(value);
+        }
+
+        public static void WriteString(BinaryWriter writer, string value)
+        {
+            WriteBytes(writer, Encoding.UTF8.GetBytes(value ?? ""));
+        }
+
+        public static void WriteArray<T>(BinaryWriter writer, T[] values, Action<BinaryWriter, T> write)
+        {
+            values = values ?? new T[0];
+            WriteInt32(writer, values.Length);
+
+            foreach (var value in values)
+            {
+                write(writer, value);
+            }
+        }
+
+        static byte[] ReadExactly(BinaryReader reader, int count)
+        {
+            var data = reader.ReadBytes(count);
+
+            if (data.Length != count)
+            {
+                throw new EndOfStreamException($"cannot read {count} bytes");
+            }
+
+            return data;
+        }
+
+        public static bool ReadBool(BinaryReader reader)
+        {
+            return ReadUInt8(reader) != 0;
+        }
+
+        public static sbyte ReadInt8(BinaryReader reader)
+        {
+            return (sbyte)ReadUInt8(reader);
+        }
+
+        public static byte ReadUInt8(BinaryReader reader)
+        {
+            return ReadExactly(reader, 1)[0];
+        }
+
+        public static short ReadInt16(BinaryReader reader)
+        {
+            return (short)ReadUInt16(reader);
+        }
+
+        public static ushort ReadUInt16(BinaryReader reader)
+        {
+            var data = ReadExactly(reader, 2);
+
+            return (ushort)(data[0] << 8 | data[1]);
+        }
+
+        public static int ReadInt32(BinaryReader reader)
+        {
+            return (int)ReadUInt32(reader);
+        }
+
+        public static uint ReadUInt32(BinaryReader reader)
+        {
+            var data = ReadExactly(reader, 4);
+
+            return (uint)data[0] << 24 | (uint)data[1] << 16 | (uint)data[2] << 8 | data[3];
+        }
+
+        public static long ReadInt64(BinaryReader reader)
+        {
+            return (long)ReadUInt64(reader);
+        }
+
+        public static ulong ReadUInt64(BinaryReader reader)
+        {
+            var high = ReadUInt32(reader);
+            var low = ReadUInt32(reader);
+
+            return (ulong)high << 32 | low;
+        }
+
+        public static float ReadFloat32(BinaryReader reader)
+        {
+            return BitConverter.ToSingle(BitConverter.GetBytes(ReadInt32(reader)), 0);
+        }
+
+        public static double ReadFloat64(BinaryReader reader)
+        {
+            return BitConverter.Int64BitsToDouble(ReadInt64(reader));
+        }
+
+        public static Complex ReadComplex64(BinaryReader reader)
+        {
+            var re = ReadFloat32(reader);
+            var im = ReadFloat32(reader);
+
+            return new Complex(re, im);
+        }
+
+        public static Complex ReadComplex128(BinaryReader reader)
+        {
+            var re = ReadFloat64(reader);
+            var im = ReadFloat64(reader);
+
+            return new Complex(re, im);
+        }
+
+        public static byte[] ReadBytes(BinaryReader reader)
+        {
+            var length = ReadInt32(reader);
+
+            if (length < 0)
+            {
+                throw new InvalidDataException($"invalid array length {length}");
+            }
+
+            return ReadExactly(reader, length);
+        }
+
+        public static string ReadString(BinaryReader reader)
+        {
+            return Encoding.UTF8.GetString(ReadBytes(reader));
+        }
+
+        public static T[] ReadArray<T>(BinaryReader reader, Func<BinaryReader, T> read)
+        {
+            var length = ReadInt32(reader);
+
+            if (length < 0)
+            {
+                throw new InvalidDataException($"invalid array length {length}");
+            }
+
+            // Every element takes at least one byte, so the
+            // length can't exceed the bytes left in the stream.
+            var stream = reader.BaseStream;
+
+            if (stream.CanSeek && length > stream.Length - stream.Position)
+            {
+                throw new EndOfStreamException(
+                    $"array length {length} exceeds the remaining {stream.Length - stream.Position} bytes");
+            }
+
+            // The list grows as the values are read, so the
+            // length isn't allocated at once for the streams
+            // that can't tell how many bytes are left.
+            var values = new List<T>(Math.Min(length, 1024));
+
+            for (var i = 0; i < length; i++)
+            {
+                values.Add(read(reader));
+            }
+
+            return values.ToArray();
+        }
+
+        // Encode returns the payload written by the action.
+        public static byte[] Encode(Action<BinaryWriter> write)
+        {
+            using (var stream = new MemoryStream())
+            using (var writer = new BinaryWriter(stream))
+            {
+                write(writer);
+                writer.Flush();
+
+                return stream.ToArray();
+            }
+        }
+
+        // Decode reads the whole payload with the action.
+        public static void Decode(byte[] payload, Action<BinaryReader> read)
+        {
+            using (var stream = new MemoryStream(payload))
+            using (var reader = new BinaryReader(stream))
+            {
+                read(reader);
+
+                if (stream.Position != stream.Length)
+                {
+                    throw new InvalidDataException(
+                        $"{stream.Length - stream.Position} bytes left in the payload");
+                }
+            }
+        }
+
+        // PacketBytes returns the raw binary representation
+        // of the packet, optionally with the CRC32C trailer.
+        public static byte[] PacketBytes(int opcode, byte[] payload, bool checksum = false)
+        {
+            var data = Encode(writer =>
+            {
+                WriteInt32(writer, opcode);
+                WriteInt64(writer, (checksum ? (long)FlagChecksum << 56 : 0) | (uint)payload.Length);
+                writer.Write(payload);
+            });
+
+            if (!checksum)
+            {
+                return data;
+            }
+
+            return Encode(writer =>
+            {
+                writer.Write(data);
+                WriteUInt32(writer, Crc32C(data));
+            });
+        }
+
+        // ReadPacket reads the packet from the stream
+        // verifying its checksum. The signature is
+        // returned as is.
+        public static Packet ReadPacket(BinaryReader reader)
+        {
+            var packet = new Packet { Opcode = ReadInt32(reader) };
+            var lengthField = ReadInt64(reader);
+            var flags = (byte)((ulong)lengthField >> 56);
+            var length = lengthField & LengthMask;
+
+            if ((flags & ~(FlagChecksum | FlagSignature | FlagCorrelation)) != 0)
+            {
+                throw new InvalidDataException($"unknown packet flags: {flags}");
+            }
+
+            if (length > int.MaxValue)
+            {
+                throw new InvalidDataException($"packet is too long: {length} bytes");
+            }
+
+            if ((flags & FlagSignature) != 0)
+            {
+                packet.KeyID = ReadUInt32(reader);
+            }
+
+            if ((flags & FlagCorrelation) != 0)
+            {
+                packet.CorrelationID = ReadUInt32(reader);
+            }
+
+            packet.Payload = ReadExactly(reader, (int)length);
+
+            if ((flags & FlagSignature) != 0)
+            {
+                packet.Signature = ReadExactly(reader, 32);
+            }
+
+            if ((flags & FlagChecksum) != 0)
+            {
+                var expected = ReadUInt32(reader);
+                var actual = Crc32C(Encode(writer =>
+                {
+                    WriteInt32(writer, packet.Opcode);
+                    WriteInt64(writer, lengthField);
+
+                    if (packet.KeyID.HasValue)
+                    {
+                        WriteUInt32(writer, packet.KeyID.Value);
+                    }
+
+                    if (packet.CorrelationID.HasValue)
+                    {
+                        WriteUInt32(writer, packet.CorrelationID.Value);
+                    }
+
+                    writer.Write(packet.Payload);
+
+                    if (packet.Signature != null)
+                    {
+                        writer.Write(packet.Signature);
+                    }
+                }));
+
+                if (expected != actual)
+                {
+                    throw new InvalidDataException(
+                        $"packet checksum mismatch: opcode {packet.Opcode}");
+                }
+            }
+
+            return packet;
+        }
+
+        // PacketFromBytes parses the packet
+        // out of the byte sequence.
+        public static Packet PacketFromBytes(byte[] data)
+        {
+            using (var stream = new MemoryStream(data))
+            using (var reader = new BinaryReader(stream))
+            {
+                return ReadPacket(reader);
+            }
+        }
+    }
+}
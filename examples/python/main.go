@@ -0,0 +1,49 @@
+package main
+
+//go:generate go run .
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/zergon321/kosuzu/gen"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+type PlayerMovement struct {
+	ID int32
+	X  float64
+	Y  float64
+}
+
+type Choice struct {
+	Parameter  int32
+	Numbers    []int64
+	Parameters []complex128
+	Payload    []byte
+	Comment    string
+}
+
+// Opcode makes the generated Python code
+// check the opcode of the PlayerMovement packet.
+func (mv PlayerMovement) Opcode() int32 {
+	return 32
+}
+
+func main() {
+	sch, err := schema.Reflect(PlayerMovement{}, Choice{})
+	handleError(err)
+
+	buf := new(bytes.Buffer)
+	err = gen.Python(buf, sch)
+	handleError(err)
+
+	err = os.WriteFile("messages.py", buf.Bytes(), 0644)
+	handleError(err)
+}
+
+func handleError(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
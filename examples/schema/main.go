@@ -0,0 +1,46 @@
+package main
+
+//go:generate go run github.com/zergon321/kosuzu/cmd/kosuzuc -o messages.go messages.kosuzu
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func main() {
+	movement := &PlayerMovement{
+		ID:   132,
+		Team: TeamBlue,
+		X:    116.198,
+		Y:    20.07,
+	}
+
+	packet, err := movement.Serialize()
+	handleError(err)
+	generated, err := packet.Bytes()
+	handleError(err)
+
+	// The generated code produces the same
+	// bytes as the reflective serializer.
+	packet, err = kosuzu.Serialize(OpcodePlayerMovement, movement)
+	handleError(err)
+	reflective, err := packet.Bytes()
+	handleError(err)
+
+	fmt.Println("Packet:", generated)
+	fmt.Println("Same as Serialize:", bytes.Equal(generated, reflective))
+
+	restored := new(PlayerMovement)
+	err = restored.Deserialize(packet)
+	handleError(err)
+
+	fmt.Println(restored)
+}
+
+func handleError(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
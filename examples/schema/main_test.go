@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type message interface {
+	Serialize() (*kosuzu.Packet, error)
+	Deserialize(packet *kosuzu.Packet) error
+	Opcode() int32
+}
+
+func TestGeneratedCode(t *testing.T) {
+	for _, test := range []struct {
+		value message
+		empty message
+	}{
+		{
+			value: &PlayerMovement{ID: 132, Team: TeamBlue, X: 116.198, Y: 20.07},
+			empty: new(PlayerMovement),
+		},
+		{
+			value: &ChatMessage{
+				Author:   "kosuzu",
+				Text:     "小鈴",
+				Emoji:    '📚',
+				Mentions: []int32{1, 2, 3},
+			},
+			empty: new(ChatMessage),
+		},
+	} {
+		generated, err := test.value.Serialize()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reflective, err := kosuzu.Serialize(test.value.Opcode(), test.value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		generatedBytes, err := generated.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reflectiveBytes, err := reflective.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(generatedBytes, reflectiveBytes) {
+			t.Fatalf("%T: generated code writes % x, Serialize writes % x",
+				test.value, generatedBytes, reflectiveBytes)
+		}
+
+		err = test.empty.Deserialize(reflective)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(test.empty, test.value) {
+			t.Fatalf("expected %+v, got %+v", test.value, test.empty)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Code generated by kosuzuc. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type Team uint8
+
+const (
+	TeamRed  Team = 0
+	TeamBlue Team = 1
+)
+
+// Message opcodes.
+const (
+	OpcodePlayerMovement int32 = 32
+	OpcodeChatMessage    int32 = 33
+)
+
+type PlayerMovement struct {
+	ID   int32
+	Team Team
+	X    float64
+	Y    float64
+}
+
+// Build writes the PlayerMovement fields to the packet builder.
+func (msg *PlayerMovement) Build(builder *kosuzu.Builder) error {
+	var err error
+
+	err = builder.AddInt32(msg.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddUint8(uint8(msg.Team))
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.X)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.Y)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Decompose reads the PlayerMovement fields from the packet decomposer.
+func (msg *PlayerMovement) Decompose(decomposer *kosuzu.Decomposer) error {
+	var err error
+
+	msg.ID, err = decomposer.ReadInt32()
+
+	if err != nil {
+		return err
+	}
+
+	{
+		val, err := decomposer.ReadUint8()
+
+		if err != nil {
+			return err
+		}
+
+		msg.Team = Team(val)
+	}
+
+	msg.X, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Y, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Opcode returns the opcode of the PlayerMovement packet.
+func (msg *PlayerMovement) Opcode() int32 {
+	return OpcodePlayerMovement
+}
+
+// Serialize creates a new PlayerMovement packet.
+func (msg *PlayerMovement) Serialize() (*kosuzu.Packet, error) {
+	builder := kosuzu.NewPacketBuilder()
+	err := msg.Build(builder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.BuildPacket(OpcodePlayerMovement), nil
+}
+
+// Deserialize reads the PlayerMovement from the packet.
+func (msg *PlayerMovement) Deserialize(packet *kosuzu.Packet) error {
+	if packet.Opcode != OpcodePlayerMovement {
+		return fmt.Errorf("expected opcode %d, got %d", OpcodePlayerMovement, packet.Opcode)
+	}
+
+	return msg.Decompose(kosuzu.NewPacketDecomposer(packet))
+}
+
+type ChatMessage struct {
+	Author   string
+	Text     string
+	Emoji    rune
+	Mentions []int32
+}
+
+// Build writes the ChatMessage fields to the packet builder.
+func (msg *ChatMessage) Build(builder *kosuzu.Builder) error {
+	var err error
+
+	err = builder.AddString(msg.Author)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddString(msg.Text)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddRune(msg.Emoji)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddInt32Array(msg.Mentions)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Decompose reads the ChatMessage fields from the packet decomposer.
+func (msg *ChatMessage) Decompose(decomposer *kosuzu.Decomposer) error {
+	var err error
+
+	msg.Author, err = decomposer.ReadString()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Text, err = decomposer.ReadString()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Emoji, _, err = decomposer.ReadRune()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Mentions, err = decomposer.ReadInt32Array()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Opcode returns the opcode of the ChatMessage packet.
+func (msg *ChatMessage) Opcode() int32 {
+	return OpcodeChatMessage
+}
+
+// Serialize creates a new ChatMessage packet.
+func (msg *ChatMessage) Serialize() (*kosuzu.Packet, error) {
+	builder := kosuzu.NewPacketBuilder()
+	err := msg.Build(builder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.BuildPacket(OpcodeChatMessage), nil
+}
+
+// Deserialize reads the ChatMessage from the packet.
+func (msg *ChatMessage) Deserialize(packet *kosuzu.Packet) error {
+	if packet.Opcode != OpcodeChatMessage {
+		return fmt.Errorf("expected opcode %d, got %d", OpcodeChatMessage, packet.Opcode)
+	}
+
+	return msg.Decompose(kosuzu.NewPacketDecomposer(packet))
+}
@@ -0,0 +1,424 @@
+// Code generated by kosuzuc. DO NOT EDIT.
+
+export interface Complex {
+  re: number;
+  im: number;
+}
+
+export interface Packet {
+  opcode: number;
+  payload: Uint8Array;
+  keyID?: number;
+  correlationID?: number;
+  signature?: Uint8Array;
+}
+
+const flagChecksum = 1;
+const flagSignature = 2;
+const flagCorrelation = 4;
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder("utf-8");
+
+const crcTable = (() => {
+  const table = new Uint32Array(256);
+
+  for (let i = 0; i < 256; i++) {
+    let crc = i;
+
+    for (let j = 0; j < 8; j++) {
+      crc = crc & 1 ? (crc >>> 1) ^ 0x82f63b78 : crc >>> 1;
+    }
+
+    table[i] = crc >>> 0;
+  }
+
+  return table;
+})();
+
+function crc32c(data: Uint8Array): number {
+  let crc = 0xffffffff;
+
+  for (const byte of data) {
+    crc = crcTable[(crc ^ byte) & 0xff] ^ (crc >>> 8);
+  }
+
+  return (crc ^ 0xffffffff) >>> 0;
+}
+
+class Writer {
+  private buffer = new Uint8Array(64);
+  private view = new DataView(this.buffer.buffer);
+  private length = 0;
+
+  // reserve may replace the buffer and the view,
+  // so it must be called before the view is used.
+  private reserve(n: number): number {
+    const offset = this.length;
+
+    if (offset + n > this.buffer.length) {
+      const buffer = new Uint8Array(Math.max(this.buffer.length * 2, offset + n));
+      buffer.set(this.buffer);
+      this.buffer = buffer;
+      this.view = new DataView(buffer.buffer);
+    }
+
+    this.length += n;
+
+    return offset;
+  }
+
+  bool(value: boolean): void {
+    const offset = this.reserve(1);
+    this.view.setUint8(offset, value ? 1 : 0);
+  }
+
+  int8(value: number): void {
+    const offset = this.reserve(1);
+    this.view.setInt8(offset, value);
+  }
+
+  uint8(value: number): void {
+    const offset = this.reserve(1);
+    this.view.setUint8(offset, value);
+  }
+
+  int16(value: number): void {
+    const offset = this.reserve(2);
+    this.view.setInt16(offset, value);
+  }
+
+  uint16(value: number): void {
+    const offset = this.reserve(2);
+    this.view.setUint16(offset, value);
+  }
+
+  int32(value: number): void {
+    const offset = this.reserve(4);
+    this.view.setInt32(offset, value);
+  }
+
+  uint32(value: number): void {
+    const offset = this.reserve(4);
+    this.view.setUint32(offset, value);
+  }
+
+  int64(value: bigint): void {
+    const offset = this.reserve(8);
+    this.view.setBigInt64(offset, value);
+  }
+
+  uint64(value: bigint): void {
+    const offset = this.reserve(8);
+    this.view.setBigUint64(offset, value);
+  }
+
+  float32(value: number): void {
+    const offset = this.reserve(4);
+    this.view.setFloat32(offset, value);
+  }
+
+  float64(value: number): void {
+    const offset = this.reserve(8);
+    this.view.setFloat64(offset, value);
+  }
+
+  complex64(value: Complex): void {
+    this.float32(value.re);
+    this.float32(value.im);
+  }
+
+  complex128(value: Complex): void {
+    this.float64(value.re);
+    this.float64(value.im);
+  }
+
+  bytes(value: Uint8Array): void {
+    this.int32(value.length);
+    const offset = this.reserve(value.length);
+    this.buffer.set(value, offset);
+  }
+
+  string(value: string): void {
+    this.bytes(textEncoder.encode(value));
+  }
+
+  array<T>(values: T[], write: (value: T) => void): void {
+    this.int32(values.length);
+
+    for (const value of values) {
+      write(value);
+    }
+  }
+
+  finish(): Uint8Array {
+    return this.buffer.slice(0, this.length);
+  }
+}
+
+class Reader {
+  private view: DataView;
+  private offset = 0;
+
+  constructor(private data: Uint8Array) {
+    this.view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+  }
+
+  private advance(n: number): number {
+    const offset = this.offset;
+
+    if (n < 0 || offset + n > this.data.length) {
+      throw new RangeError(`cannot read ${n} bytes at offset ${offset}`);
+    }
+
+    this.offset += n;
+
+    return offset;
+  }
+
+  bool(): boolean {
+    return this.view.getUint8(this.advance(1)) !== 0;
+  }
+
+  int8(): number {
+    return this.view.getInt8(this.advance(1));
+  }
+
+  uint8(): number {
+    return this.view.getUint8(this.advance(1));
+  }
+
+  int16(): number {
+    return this.view.getInt16(this.advance(2));
+  }
+
+  uint16(): number {
+    return this.view.getUint16(this.advance(2));
+  }
+
+  int32(): number {
+    return this.view.getInt32(this.advance(4));
+  }
+
+  uint32(): number {
+    return this.view.getUint32(this.advance(4));
+  }
+
+  int64(): bigint {
+    return this.view.getBigInt64(this.advance(8));
+  }
+
+  uint64(): bigint {
+    return this.view.getBigUint64(this.advance(8));
+  }
+
+  float32(): number {
+    return this.view.getFloat32(this.advance(4));
+  }
+
+  float64(): number {
+    return this.view.getFloat64(this.advance(8));
+  }
+
+  complex64(): Complex {
+    const re = this.float32();
+    const im = this.float32();
+
+    return { re, im };
+  }
+
+  complex128(): Complex {
+    const re = this.float64();
+    const im = this.float64();
+
+    return { re, im };
+  }
+
+  bytes(): Uint8Array {
+    const length = this.int32();
+    const offset = this.advance(length);
+
+    return this.data.slice(offset, offset + length);
+  }
+
+  string(): string {
+    return textDecoder.decode(this.bytes());
+  }
+
+  array<T>(read: () => T): T[] {
+    const length = this.int32();
+
+    if (length < 0) {
+      throw new RangeError(`invalid array length ${length}`);
+    }
+
+    const values: T[] = [];
+
+    for (let i = 0; i < length; i++) {
+      values.push(read());
+    }
+
+    return values;
+  }
+
+  finish(): void {
+    if (this.offset !== this.data.length) {
+      throw new RangeError(`${this.data.length - this.offset} bytes left in the payload`);
+    }
+  }
+}
+
+// packetBytes returns the raw binary representation
+// of the packet, optionally with the CRC32C trailer.
+export function packetBytes(opcode: number, payload: Uint8Array, checksum = false): Uint8Array {
+  const data = new Uint8Array(12 + payload.length + (checksum ? 4 : 0));
+  const view = new DataView(data.buffer);
+
+  view.setInt32(0, opcode);
+  view.setBigInt64(4, BigInt(payload.length));
+  data.set(payload, 12);
+
+  if (checksum) {
+    view.setUint8(4, flagChecksum);
+    view.setUint32(12 + payload.length, crc32c(data.subarray(0, 12 + payload.length)));
+  }
+
+  return data;
+}
+
+// packetFromBytes parses the packet out of the byte sequence
+// verifying its checksum. The signature is returned as is.
+export function packetFromBytes(data: Uint8Array): Packet {
+  const view = new DataView(data.buffer, data.byteOffset, data.byteLength);
+
+  if (data.length < 12) {
+    throw new RangeError("packet header is truncated");
+  }
+
+  const opcode = view.getInt32(0);
+  const flags = view.getUint8(4);
+  const length = Number(view.getBigUint64(4) & 0xffffffffffffffn);
+
+  if ((flags & ~(flagChecksum | flagSignature | flagCorrelation)) !== 0) {
+    throw new Error(`unknown packet flags: ${flags}`);
+  }
+
+  const packet: Packet = { opcode, payload: new Uint8Array(0) };
+  let offset = 12;
+
+  if (flags & flagSignature) {
+    packet.keyID = view.getUint32(offset);
+    offset += 4;
+  }
+
+  if (flags & flagCorrelation) {
+    packet.correlationID = view.getUint32(offset);
+    offset += 4;
+  }
+
+  const end = offset + length + (flags & flagSignature ? 32 : 0) +
+    (flags & flagChecksum ? 4 : 0);
+
+  if (data.length < end) {
+    throw new RangeError("packet is truncated");
+  }
+
+  packet.payload = data.slice(offset, offset + length);
+  offset += length;
+
+  if (flags & flagSignature) {
+    packet.signature = data.slice(offset, offset + 32);
+    offset += 32;
+  }
+
+  if (flags & flagChecksum) {
+    const expected = view.getUint32(offset);
+    const actual = crc32c(data.subarray(0, offset));
+
+    if (expected !== actual) {
+      throw new Error(`packet checksum mismatch: opcode ${opcode}`);
+    }
+  }
+
+  return packet;
+}
+
+export const OpcodePlayerMovement = 32;
+
+export interface PlayerMovement {
+  ID: number;
+  X: number;
+  Y: number;
+}
+
+export function encodePlayerMovement(msg: PlayerMovement): Uint8Array {
+  const writer = new Writer();
+
+  writer.int32(msg.ID);
+  writer.float64(msg.X);
+  writer.float64(msg.Y);
+
+  return writer.finish();
+}
+
+export function decodePlayerMovement(payload: Uint8Array): PlayerMovement {
+  const reader = new Reader(payload);
+  const msg: PlayerMovement = {
+    ID: reader.int32(),
+    X: reader.float64(),
+    Y: reader.float64(),
+  };
+
+  reader.finish();
+
+  return msg;
+}
+
+export function serializePlayerMovement(msg: PlayerMovement, checksum = false): Uint8Array {
+  return packetBytes(OpcodePlayerMovement, encodePlayerMovement(msg), checksum);
+}
+
+export function deserializePlayerMovement(data: Uint8Array): PlayerMovement {
+  const packet = packetFromBytes(data);
+
+  if (packet.opcode !== OpcodePlayerMovement) {
+    throw new Error(`expected opcode ${OpcodePlayerMovement}, got ${packet.opcode}`);
+  }
+
+  return decodePlayerMovement(packet.payload);
+}
+
+export interface Choice {
+  Parameter: number;
+  Numbers: bigint[];
+  Parameters: Complex[];
+  Payload: Uint8Array;
+  Comment: string;
+}
+
+export function encodeChoice(msg: Choice): Uint8Array {
+  const writer = new Writer();
+
+  writer.int32(msg.Parameter);
+  writer.array(msg.Numbers, (value) => writer.int64(value));
+  writer.array(msg.Parameters, (value) => writer.complex128(value));
+  writer.bytes(msg.Payload);
+  writer.string(msg.Comment);
+
+  return writer.finish();
+}
+
+export function decodeChoice(payload: Uint8Array): Choice {
+  const reader = new Reader(payload);
+  const msg: Choice = {
+    Parameter: reader.int32(),
+    Numbers: reader.array(() => reader.int64()),
+    Parameters: reader.array(() => reader.complex128()),
+    Payload: reader.bytes(),
+    Comment: reader.string(),
+  };
+
+  reader.finish();
+
+  return msg;
+}
@@ -0,0 +1,7 @@
+package kosuzu
+
+// Allocated returns the number of bytes the
+// decomposer has accounted for the decoded values.
+func (decomposer *Decomposer) Allocated() int64 {
+	return *decomposer.allocated
+}
@@ -0,0 +1,229 @@
+package kosuzu_test
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// fuzzLimits are the limits the decomposers
+// fed with the fuzzed input must respect.
+var fuzzLimits = kosuzu.Limits{
+	MaxStringLength: 1 << 10,
+	MaxArrayLength:  1 << 10,
+	MaxAllocation:   1 << 16,
+}
+
+type fuzzNested struct {
+	ID    uint32
+	Label string
+	Ratio float32
+}
+
+type fuzzValue struct {
+	Flag       bool
+	Small      int8
+	Byte       uint8
+	Short      int16
+	Word       uint16
+	Int        int32
+	Uint       uint32
+	Long       int64
+	Ulong      uint64
+	Float      float32
+	Double     float64
+	Complex    complex64
+	Complex128 complex128
+	Text       string
+	Bytes      []byte
+	Ints       []int32
+	Doubles    []float64
+	Bools      []bool
+	Texts      []string
+	Fixed      [3]uint16
+	Nested     fuzzNested
+	List       []fuzzNested
+	Optional   *fuzzNested
+	Lookup     map[string]int16
+	Keys       map[int64]bool
+	Profile    ProfileV2
+}
+
+// fuzzReaders read the values of every
+// kind the decomposer supports.
+var fuzzReaders = map[string]func(*kosuzu.Decomposer) error{
+	"bool":       func(d *kosuzu.Decomposer) error { _, err := d.ReadBool(); return err },
+	"rune":       func(d *kosuzu.Decomposer) error { _, _, err := d.ReadRune(); return err },
+	"byte":       func(d *kosuzu.Decomposer) error { _, err := d.ReadByte(); return err },
+	"int8":       func(d *kosuzu.Decomposer) error { _, err := d.ReadInt8(); return err },
+	"uint8":      func(d *kosuzu.Decomposer) error { _, err := d.ReadUint8(); return err },
+	"int16":      func(d *kosuzu.Decomposer) error { _, err := d.ReadInt16(); return err },
+	"uint16":     func(d *kosuzu.Decomposer) error { _, err := d.ReadUint16(); return err },
+	"int32":      func(d *kosuzu.Decomposer) error { _, err := d.ReadInt32(); return err },
+	"uint32":     func(d *kosuzu.Decomposer) error { _, err := d.ReadUint32(); return err },
+	"int64":      func(d *kosuzu.Decomposer) error { _, err := d.ReadInt64(); return err },
+	"uint64":     func(d *kosuzu.Decomposer) error { _, err := d.ReadUint64(); return err },
+	"float32":    func(d *kosuzu.Decomposer) error { _, err := d.ReadFloat32(); return err },
+	"float64":    func(d *kosuzu.Decomposer) error { _, err := d.ReadFloat64(); return err },
+	"complex64":  func(d *kosuzu.Decomposer) error { _, err := d.ReadComplex64(); return err },
+	"complex128": func(d *kosuzu.Decomposer) error { _, err := d.ReadComplex128(); return err },
+	"string":     func(d *kosuzu.Decomposer) error { _, err := d.ReadString(); return err },
+	"[]byte":     func(d *kosuzu.Decomposer) error { _, err := d.ReadByteArray(); return err },
+	"[]int8":     func(d *kosuzu.Decomposer) error { _, err := d.ReadInt8Array(); return err },
+	"[]uint8":    func(d *kosuzu.Decomposer) error { _, err := d.ReadUint8Array(); return err },
+	"[]int16":    func(d *kosuzu.Decomposer) error { _, err := d.ReadInt16Array(); return err },
+	"[]uint16":   func(d *kosuzu.Decomposer) error { _, err := d.ReadUint16Array(); return err },
+	"[]int32":    func(d *kosuzu.Decomposer) error { _, err := d.ReadInt32Array(); return err },
+	"[]uint32":   func(d *kosuzu.Decomposer) error { _, err := d.ReadUint32Array(); return err },
+	"[]int64":    func(d *kosuzu.Decomposer) error { _, err := d.ReadInt64Array(); return err },
+	"[]uint64":   func(d *kosuzu.Decomposer) error { _, err := d.ReadUint64Array(); return err },
+	"[]float32":  func(d *kosuzu.Decomposer) error { _, err := d.ReadFloat32Array(); return err },
+	"[]float64":  func(d *kosuzu.Decomposer) error { _, err := d.ReadFloat64Array(); return err },
+	"[]complex64": func(d *kosuzu.Decomposer) error {
+		_, err := d.ReadComplex64Array()
+		return err
+	},
+	"[]complex128": func(d *kosuzu.Decomposer) error {
+		_, err := d.ReadComplex128Array()
+		return err
+	},
+	"[]bool": func(d *kosuzu.Decomposer) error { _, err := d.ReadBoolArray(); return err },
+	"[]rune": func(d *kosuzu.Decomposer) error { _, err := d.ReadRuneArray(); return err },
+	"value":  func(d *kosuzu.Decomposer) error { return d.ReadValue(&fuzzValue{}) },
+	"[]struct{}": func(d *kosuzu.Decomposer) error {
+		var empty []struct{}
+		return d.ReadValue(&empty)
+	},
+}
+
+func fuzzPackets(f *testing.F) [][]byte {
+	plain := kosuzu.NewPacket(1, []byte("reimu"))
+	checked := kosuzu.NewPacket(2, []byte("marisa"))
+	checked.SetChecksum(true)
+	signed := kosuzu.NewPacket(3, []byte("kosuzu"))
+	signed.Sign(7, []byte("secret"))
+	signed.SetChecksum(true)
+	data := [][]byte{}
+
+	for _, packet := range []*kosuzu.Packet{plain, checked, signed} {
+		raw, err := packet.Bytes()
+
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		data = append(data, raw)
+	}
+
+	return data
+}
+
+func FuzzPacketFromBytes(f *testing.F) {
+	for _, data := range fuzzPackets(f) {
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packet, err := kosuzu.PacketFromBytes(data)
+
+		if err != nil {
+			return
+		}
+
+		raw, err := packet.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(raw) > len(data) || !bytes.Equal(raw, data[:len(raw)]) {
+			t.Fatalf("packet bytes differ from the input:\n% x\n% x", raw, data)
+		}
+	})
+}
+
+func FuzzReadPacketFrom(f *testing.F) {
+	f.Add(bytes.Join(fuzzPackets(f), nil))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		stream := bytes.NewReader(data)
+
+		for {
+			_, packet, err := kosuzu.ReadPacketFrom(stream)
+
+			if err != nil {
+				return
+			}
+
+			if packet.DataLength() > int64(len(data)) {
+				t.Fatalf("payload of %d bytes read from %d bytes",
+					packet.DataLength(), len(data))
+			}
+		}
+	})
+}
+
+func FuzzDecomposer(f *testing.F) {
+	value, err := kosuzu.Serialize(1, &fuzzValue{Text: "kosuzu"})
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(value.Payload())
+	f.Add([]byte{0, 0, 0, 3, 'k', 'o', 's'})
+	f.Add([]byte{0x7f, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for name, read := range fuzzReaders {
+			decomposer := kosuzu.NewPacketDecomposer(kosuzu.NewPacket(1, data))
+			decomposer.SetLimits(fuzzLimits)
+
+			for read(decomposer) == nil && decomposer.Remaining() > 0 {
+			}
+
+			if decomposer.Allocated() > fuzzLimits.MaxAllocation {
+				t.Fatalf("%s: %d bytes allocated, the limit is %d",
+					name, decomposer.Allocated(), fuzzLimits.MaxAllocation)
+			}
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 8; seed++ {
+		f.Add(seed)
+	}
+
+	typ := reflect.TypeOf(fuzzValue{})
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+		generated, ok := quick.Value(typ, rand.New(rand.NewSource(seed)))
+
+		if !ok {
+			t.Fatalf("cannot generate %v", typ)
+		}
+
+		value := generated.Interface().(fuzzValue)
+		packet, err := kosuzu.Serialize(1, &value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded fuzzValue
+		err = kosuzu.DeserializeStrict(packet, &decoded, kosuzu.CheckUTF8)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(value, decoded) {
+			t.Fatalf("round trip changed the value:\n%+v\n%+v", value, decoded)
+		}
+	})
+}
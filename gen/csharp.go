@@ -0,0 +1,750 @@
+package gen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// csRuntime contains the C# code writing and
+// reading primitive values and packet headers
+// the same way kosuzu does. BinaryWriter and
+// BinaryReader are little-endian, so the values
+// are written byte by byte in big-endian order.
+const csRuntime = `public static class Kosuzu
+{
+    public struct Packet
+    {
+        public int Opcode;
+        public byte[] Payload;
+        public uint? KeyID;
+        public uint? CorrelationID;
+        public byte[] Signature;
+    }
+
+    const byte FlagChecksum = 1;
+    const byte FlagSignature = 2;
+    const byte FlagCorrelation = 4;
+    const long LengthMask = (1L << 56) - 1;
+
+    static readonly uint[] CrcTable = MakeCrcTable();
+
+    static uint[] MakeCrcTable()
+    {
+        var table = new uint[256];
+
+        for (uint i = 0; i < 256; i++)
+        {
+            var crc = i;
+
+            for (var j = 0; j < 8; j++)
+            {
+                crc = (crc & 1) != 0 ? (crc >> 1) ^ 0x82f63b78 : crc >> 1;
+            }
+
+            table[i] = crc;
+        }
+
+        return table;
+    }
+
+    public static uint Crc32C(byte[] data)
+    {
+        var crc = 0xffffffff;
+
+        foreach (var b in data)
+        {
+            crc = CrcTable[(crc ^ b) & 0xff] ^ (crc >> 8);
+        }
+
+        return crc ^ 0xffffffff;
+    }
+
+    public static void WriteBool(BinaryWriter writer, bool value)
+    {
+        writer.Write((byte)(value ? 1 : 0));
+    }
+
+    public static void WriteInt8(BinaryWriter writer, sbyte value)
+    {
+        writer.Write(value);
+    }
+
+    public static void WriteUInt8(BinaryWriter writer, byte value)
+    {
+        writer.Write(value);
+    }
+
+    public static void WriteInt16(BinaryWriter writer, short value)
+    {
+        WriteUInt16(writer, (ushort)value);
+    }
+
+    public static void WriteUInt16(BinaryWriter writer, ushort value)
+    {
+        writer.Write((byte)(value >> 8));
+        writer.Write((byte)value);
+    }
+
+    public static void WriteInt32(BinaryWriter writer, int value)
+    {
+        WriteUInt32(writer, (uint)value);
+    }
+
+    public static void WriteUInt32(BinaryWriter writer, uint value)
+    {
+        WriteUInt16(writer, (ushort)(value >> 16));
+        WriteUInt16(writer, (ushort)value);
+    }
+
+    public static void WriteInt64(BinaryWriter writer, long value)
+    {
+        WriteUInt64(writer, (ulong)value);
+    }
+
+    public static void WriteUInt64(BinaryWriter writer, ulong value)
+    {
+        WriteUInt32(writer, (uint)(value >> 32));
+        WriteUInt32(writer, (uint)value);
+    }
+
+    public static void WriteFloat32(BinaryWriter writer, float value)
+    {
+        WriteInt32(writer, BitConverter.ToInt32(BitConverter.GetBytes(value), 0));
+    }
+
+    public static void WriteFloat64(BinaryWriter writer, double value)
+    {
+        WriteInt64(writer, BitConverter.DoubleToInt64Bits(value));
+    }
+
+    public static void WriteComplex64(BinaryWriter writer, Complex value)
+    {
+        WriteFloat32(writer, (float)value.Real);
+        WriteFloat32(writer, (float)value.Imaginary);
+    }
+
+    public static void WriteComplex128(BinaryWriter writer, Complex value)
+    {
+        WriteFloat64(writer, value.Real);
+        WriteFloat64(writer, value.Imaginary);
+    }
+
+    public static void WriteBytes(BinaryWriter writer, byte[] value)
+    {
+        value = value ?? new byte[0];
+        WriteInt32(writer, value.Length);
+        writer.Write(value);
+    }
+
+    public static void WriteString(BinaryWriter writer, string value)
+    {
+        WriteBytes(writer, Encoding.UTF8.GetBytes(value ?? ""));
+    }
+
+    public static void WriteArray<T>(BinaryWriter writer, T[] values, Action<BinaryWriter, T> write)
+    {
+        values = values ?? new T[0];
+        WriteInt32(writer, values.Length);
+
+        foreach (var value in values)
+        {
+            write(writer, value);
+        }
+    }
+
+    static byte[] ReadExactly(BinaryReader reader, int count)
+    {
+        var data = reader.ReadBytes(count);
+
+        if (data.Length != count)
+        {
+            throw new EndOfStreamException($"cannot read {count} bytes");
+        }
+
+        return data;
+    }
+
+    public static bool ReadBool(BinaryReader reader)
+    {
+        return ReadUInt8(reader) != 0;
+    }
+
+    public static sbyte ReadInt8(BinaryReader reader)
+    {
+        return (sbyte)ReadUInt8(reader);
+    }
+
+    public static byte ReadUInt8(BinaryReader reader)
+    {
+        return ReadExactly(reader, 1)[0];
+    }
+
+    public static short ReadInt16(BinaryReader reader)
+    {
+        return (short)ReadUInt16(reader);
+    }
+
+    public static ushort ReadUInt16(BinaryReader reader)
+    {
+        var data = ReadExactly(reader, 2);
+
+        return (ushort)(data[0] << 8 | data[1]);
+    }
+
+    public static int ReadInt32(BinaryReader reader)
+    {
+        return (int)ReadUInt32(reader);
+    }
+
+    public static uint ReadUInt32(BinaryReader reader)
+    {
+        var data = ReadExactly(reader, 4);
+
+        return (uint)data[0] << 24 | (uint)data[1] << 16 | (uint)data[2] << 8 | data[3];
+    }
+
+    public static long ReadInt64(BinaryReader reader)
+    {
+        return (long)ReadUInt64(reader);
+    }
+
+    public static ulong ReadUInt64(BinaryReader reader)
+    {
+        var high = ReadUInt32(reader);
+        var low = ReadUInt32(reader);
+
+        return (ulong)high << 32 | low;
+    }
+
+    public static float ReadFloat32(BinaryReader reader)
+    {
+        return BitConverter.ToSingle(BitConverter.GetBytes(ReadInt32(reader)), 0);
+    }
+
+    public static double ReadFloat64(BinaryReader reader)
+    {
+        return BitConverter.Int64BitsToDouble(ReadInt64(reader));
+    }
+
+    public static Complex ReadComplex64(BinaryReader reader)
+    {
+        var re = ReadFloat32(reader);
+        var im = ReadFloat32(reader);
+
+        return new Complex(re, im);
+    }
+
+    public static Complex ReadComplex128(BinaryReader reader)
+    {
+        var re = ReadFloat64(reader);
+        var im = ReadFloat64(reader);
+
+        return new Complex(re, im);
+    }
+
+    public static byte[] ReadBytes(BinaryReader reader)
+    {
+        var length = ReadInt32(reader);
+
+        if (length < 0)
+        {
+            throw new InvalidDataException($"invalid array length {length}");
+        }
+
+        return ReadExactly(reader, length);
+    }
+
+    public static string ReadString(BinaryReader reader)
+    {
+        return Encoding.UTF8.GetString(ReadBytes(reader));
+    }
+
+    public static T[] ReadArray<T>(BinaryReader reader, Func<BinaryReader, T> read)
+    {
+        var length = ReadInt32(reader);
+
+        if (length < 0)
+        {
+            throw new InvalidDataException($"invalid array length {length}");
+        }
+
+        // Every element takes at least one byte, so the
+        // length can't exceed the bytes left in the stream.
+        var stream = reader.BaseStream;
+
+        if (stream.CanSeek && length > stream.Length - stream.Position)
+        {
+            throw new EndOfStreamException(
+                $"array length {length} exceeds the remaining {stream.Length - stream.Position} bytes");
+        }
+
+        // The list grows as the values are read, so the
+        // length isn't allocated at once for the streams
+        // that can't tell how many bytes are left.
+        var values = new List<T>(Math.Min(length, 1024));
+
+        for (var i = 0; i < length; i++)
+        {
+            values.Add(read(reader));
+        }
+
+        return values.ToArray();
+    }
+
+    // Encode returns the payload written by the action.
+    public static byte[] Encode(Action<BinaryWriter> write)
+    {
+        using (var stream = new MemoryStream())
+        using (var writer = new BinaryWriter(stream))
+        {
+            write(writer);
+            writer.Flush();
+
+            return stream.ToArray();
+        }
+    }
+
+    // Decode reads the whole payload with the action.
+    public static void Decode(byte[] payload, Action<BinaryReader> read)
+    {
+        using (var stream = new MemoryStream(payload))
+        using (var reader = new BinaryReader(stream))
+        {
+            read(reader);
+
+            if (stream.Position != stream.Length)
+            {
+                throw new InvalidDataException(
+                    $"{stream.Length - stream.Position} bytes left in the payload");
+            }
+        }
+    }
+
+    // PacketBytes returns the raw binary representation
+    // of the packet, optionally with the CRC32C trailer.
+    public static byte[] PacketBytes(int opcode, byte[] payload, bool checksum = false)
+    {
+        var data = Encode(writer =>
+        {
+            WriteInt32(writer, opcode);
+            WriteInt64(writer, (checksum ? (long)FlagChecksum << 56 : 0) | (uint)payload.Length);
+            writer.Write(payload);
+        });
+
+        if (!checksum)
+        {
+            return data;
+        }
+
+        return Encode(writer =>
+        {
+            writer.Write(data);
+            WriteUInt32(writer, Crc32C(data));
+        });
+    }
+
+    // ReadPacket reads the packet from the stream
+    // verifying its checksum. The signature is
+    // returned as is.
+    public static Packet ReadPacket(BinaryReader reader)
+    {
+        var packet = new Packet { Opcode = ReadInt32(reader) };
+        var lengthField = ReadInt64(reader);
+        var flags = (byte)((ulong)lengthField >> 56);
+        var length = lengthField & LengthMask;
+
+        if ((flags & ~(FlagChecksum | FlagSignature | FlagCorrelation)) != 0)
+        {
+            throw new InvalidDataException($"unknown packet flags: {flags}");
+        }
+
+        if (length > int.MaxValue)
+        {
+            throw new InvalidDataException($"packet is too long: {length} bytes");
+        }
+
+        if ((flags & FlagSignature) != 0)
+        {
+            packet.KeyID = ReadUInt32(reader);
+        }
+
+        if ((flags & FlagCorrelation) != 0)
+        {
+            packet.CorrelationID = ReadUInt32(reader);
+        }
+
+        packet.Payload = ReadExactly(reader, (int)length);
+
+        if ((flags & FlagSignature) != 0)
+        {
+            packet.Signature = ReadExactly(reader, 32);
+        }
+
+        if ((flags & FlagChecksum) != 0)
+        {
+            var expected = ReadUInt32(reader);
+            var actual = Crc32C(Encode(writer =>
+            {
+                WriteInt32(writer, packet.Opcode);
+                WriteInt64(writer, lengthField);
+
+                if (packet.KeyID.HasValue)
+                {
+                    WriteUInt32(writer, packet.KeyID.Value);
+                }
+
+                if (packet.CorrelationID.HasValue)
+                {
+                    WriteUInt32(writer, packet.CorrelationID.Value);
+                }
+
+                writer.Write(packet.Payload);
+
+                if (packet.Signature != null)
+                {
+                    writer.Write(packet.Signature);
+                }
+            }));
+
+            if (expected != actual)
+            {
+                throw new InvalidDataException(
+                    $"packet checksum mismatch: opcode {packet.Opcode}");
+            }
+        }
+
+        return packet;
+    }
+
+    // PacketFromBytes parses the packet
+    // out of the byte sequence.
+    public static Packet PacketFromBytes(byte[] data)
+    {
+        using (var stream = new MemoryStream(data))
+        using (var reader = new BinaryReader(stream))
+        {
+            return ReadPacket(reader);
+        }
+    }
+}
+`
+
+// csReserved contains the names declared
+// by the runtime part of the generated C# code.
+var csReserved = map[string]bool{
+	"Kosuzu": true,
+	"Opcode": true,
+}
+
+// csMethods contains the names of the methods
+// of the generated classes which can't be
+// used as the field names.
+var csMethods = map[string]bool{
+	"Write":       true,
+	"Read":        true,
+	"Serialize":   true,
+	"Deserialize": true,
+}
+
+// CSharp writes the C# classes of the schema messages
+// to the writer. Each class has Write(BinaryWriter) and
+// Read(BinaryReader) methods producing the same bytes
+// as kosuzu.Serialize for the equivalent Go struct, and
+// the opcodes of the messages are collected into the
+// Opcode enum. If the namespace is empty, the classes
+// are declared in the global namespace.
+//
+// Complex numbers are represented with System.Numerics.Complex,
+// and runes are represented with int.
+func CSharp(writer io.Writer, sch *schema.Schema, namespace string) error {
+	err := checkFlat(sch)
+
+	if err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	writeCSOpcodes(body, sch)
+
+	for _, enum := range sch.Enums {
+		if csReserved[enum.Name] {
+			return fmt.Errorf("enum name is reserved: %s", enum.Name)
+		}
+
+		writeCSEnum(body, enum)
+	}
+
+	for _, message := range sch.Messages {
+		if csReserved[message.Name] {
+			return fmt.Errorf("message name is reserved: %s", message.Name)
+		}
+
+		err = writeCSMessage(body, sch, message)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(body, "\n%s", csRuntime)
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "// Code generated by kosuzuc. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "using System;\n")
+	fmt.Fprintf(buf, "using System.Collections.Generic;\n")
+	fmt.Fprintf(buf, "using System.IO;\n")
+	fmt.Fprintf(buf, "using System.Numerics;\n")
+	fmt.Fprintf(buf, "using System.Text;\n\n")
+
+	if namespace == "" {
+		buf.Write(bytes.TrimPrefix(body.Bytes(), []byte("\n")))
+	} else {
+		fmt.Fprintf(buf, "namespace %s\n{\n", namespace)
+		scanner := bufio.NewScanner(body)
+		first := true
+
+		for scanner.Scan() {
+			line := scanner.Text()
+
+			if first && line == "" {
+				continue
+			}
+
+			if line != "" {
+				line = "    " + line
+			}
+
+			fmt.Fprintf(buf, "%s\n", line)
+			first = false
+		}
+
+		fmt.Fprintf(buf, "}\n")
+	}
+
+	_, err = writer.Write(buf.Bytes())
+
+	return err
+}
+
+func writeCSOpcodes(buf *bytes.Buffer, sch *schema.Schema) {
+	lines := []string{}
+
+	for _, message := range sch.Messages {
+		if message.Opcode != nil {
+			lines = append(lines, fmt.Sprintf("    %s = %d,\n",
+				message.Name, *message.Opcode))
+		}
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "\npublic enum Opcode : int\n{\n")
+	fmt.Fprintf(buf, "%s", strings.Join(lines, ""))
+	fmt.Fprintf(buf, "}\n")
+}
+
+func writeCSEnum(buf *bytes.Buffer, enum *schema.Enum) {
+	fmt.Fprintf(buf, "\npublic enum %s : %s\n{\n", enum.Name, csType(enum.Type))
+
+	for _, value := range enum.Values {
+		fmt.Fprintf(buf, "    %s = %d,\n", value.Name, value.Value)
+	}
+
+	fmt.Fprintf(buf, "}\n")
+}
+
+func writeCSMessage(buf *bytes.Buffer, sch *schema.Schema, message *schema.Message) error {
+	types := make([]*schema.Type, len(message.Fields))
+
+	for i, field := range message.Fields {
+		if field.Name == message.Name || csMethods[field.Name] {
+			return fmt.Errorf("message %s: field name can't be used in C#: %s",
+				message.Name, field.Name)
+		}
+
+		typ, err := schema.ParseType(field.Type)
+
+		if err != nil {
+			return err
+		}
+
+		types[i] = typ
+	}
+
+	fmt.Fprintf(buf, "\npublic sealed class %s\n{\n", message.Name)
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "    public %s %s%s;\n", csFieldType(sch, types[i]),
+			field.Name, csInit(sch, types[i]))
+	}
+
+	if len(message.Fields) > 0 {
+		fmt.Fprintf(buf, "\n")
+	}
+
+	fmt.Fprintf(buf, "    public void Write(BinaryWriter writer)\n    {\n")
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "        %s;\n", csWrite(sch, types[i], field.Name))
+	}
+
+	fmt.Fprintf(buf, "    }\n\n")
+
+	fmt.Fprintf(buf, "    public void Read(BinaryReader reader)\n    {\n")
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "        %s = %s;\n", field.Name, csRead(sch, types[i]))
+	}
+
+	fmt.Fprintf(buf, "    }\n")
+
+	if message.Opcode != nil {
+		fmt.Fprintf(buf, "\n    public byte[] Serialize(bool checksum = false)\n    {\n")
+		fmt.Fprintf(buf, "        return Kosuzu.PacketBytes((int)Opcode.%s, Kosuzu.Encode(Write), checksum);\n",
+			message.Name)
+		fmt.Fprintf(buf, "    }\n\n")
+
+		fmt.Fprintf(buf, "    public static %s Deserialize(byte[] data)\n    {\n", message.Name)
+		fmt.Fprintf(buf, "        var packet = Kosuzu.PacketFromBytes(data);\n\n")
+		fmt.Fprintf(buf, "        if (packet.Opcode != (int)Opcode.%s)\n        {\n", message.Name)
+		fmt.Fprintf(buf, "            throw new InvalidDataException(\n")
+		fmt.Fprintf(buf, "                $\"expected opcode {(int)Opcode.%s}, got {packet.Opcode}\");\n",
+			message.Name)
+		fmt.Fprintf(buf, "        }\n\n")
+		fmt.Fprintf(buf, "        var msg = new %s();\n", message.Name)
+		fmt.Fprintf(buf, "        Kosuzu.Decode(packet.Payload, msg.Read);\n\n")
+		fmt.Fprintf(buf, "        return msg;\n")
+		fmt.Fprintf(buf, "    }\n")
+	}
+
+	fmt.Fprintf(buf, "}\n")
+
+	return nil
+}
+
+// csWireName returns the suffix of the Kosuzu
+// Write and Read methods for the named type:
+// int8 -> Int8, uint16 -> UInt16, float32 -> Float32.
+func csWireName(sch *schema.Schema, name string) string {
+	name = wireName(sch, name)
+
+	if strings.HasPrefix(name, "uint") {
+		return "UInt" + name[len("uint"):]
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// csType returns the C# type of the primitive type.
+func csType(name string) string {
+	switch name {
+	case "bool":
+		return "bool"
+
+	case "string":
+		return "string"
+
+	case "int8":
+		return "sbyte"
+
+	case "uint8", "byte":
+		return "byte"
+
+	case "int16":
+		return "short"
+
+	case "uint16":
+		return "ushort"
+
+	case "int32", "rune":
+		return "int"
+
+	case "uint32":
+		return "uint"
+
+	case "int64":
+		return "long"
+
+	case "uint64":
+		return "ulong"
+
+	case "float32":
+		return "float"
+
+	case "float64":
+		return "double"
+
+	default:
+		return "Complex"
+	}
+}
+
+func csFieldType(sch *schema.Schema, typ *schema.Type) string {
+	if typ.Kind == schema.Slice {
+		return csFieldType(sch, typ.Elem) + "[]"
+	}
+
+	if sch.Enum(typ.Name) != nil {
+		return typ.Name
+	}
+
+	return csType(typ.Name)
+}
+
+// csInit returns the initializer of the field, so
+// strings and arrays are empty instead of null.
+func csInit(sch *schema.Schema, typ *schema.Type) string {
+	if typ.Kind == schema.Slice {
+		return fmt.Sprintf(" = new %s[0]", csFieldType(sch, typ.Elem))
+	}
+
+	if typ.Name == "string" {
+		return ` = ""`
+	}
+
+	return ""
+}
+
+func csWrite(sch *schema.Schema, typ *schema.Type, value string) string {
+	if isBytes(sch, typ) {
+		return fmt.Sprintf("Kosuzu.WriteBytes(writer, %s)", value)
+	}
+
+	if typ.Kind == schema.Slice {
+		return fmt.Sprintf("Kosuzu.WriteArray(writer, %s, Kosuzu.Write%s)",
+			value, csWireName(sch, typ.Elem.Name))
+	}
+
+	if enum := sch.Enum(typ.Name); enum != nil {
+		value = fmt.Sprintf("(%s)%s", csType(enum.Type), value)
+	}
+
+	return fmt.Sprintf("Kosuzu.Write%s(writer, %s)", csWireName(sch, typ.Name), value)
+}
+
+func csRead(sch *schema.Schema, typ *schema.Type) string {
+	if isBytes(sch, typ) {
+		return "Kosuzu.ReadBytes(reader)"
+	}
+
+	if typ.Kind == schema.Slice {
+		return fmt.Sprintf("Kosuzu.ReadArray(reader, Kosuzu.Read%s)",
+			csWireName(sch, typ.Elem.Name))
+	}
+
+	read := fmt.Sprintf("Kosuzu.Read%s(reader)", csWireName(sch, typ.Name))
+
+	if sch.Enum(typ.Name) != nil {
+		return fmt.Sprintf("(%s)%s", typ.Name, read)
+	}
+
+	return read
+}
@@ -0,0 +1,79 @@
+// Package gen generates the code encoding and decoding
+// the messages described with the kosuzu schema.
+package gen
+
+import (
+	"fmt"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// checkFlat validates the schema and returns an error
+// if any message has a field of the type the generators
+// don't support: nested messages, arrays, maps, pointers
+// and slices of strings, enums or composite types.
+// Versioned messages are not supported either.
+func checkFlat(sch *schema.Schema) error {
+	err := sch.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	for _, message := range sch.Messages {
+		if message.Version != nil {
+			return fmt.Errorf(
+				"message %s: versioned messages are not supported by the generator",
+				message.Name)
+		}
+
+		for _, field := range message.Fields {
+			typ, err := schema.ParseType(field.Type)
+
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case typ.Kind == schema.Named && sch.Message(typ.Name) == nil,
+				typ.Kind == schema.Slice && typ.Elem.Kind == schema.Named &&
+					schema.IsPrimitive(typ.Elem.Name) && typ.Elem.Name != "string":
+				continue
+			}
+
+			return fmt.Errorf(
+				"message %s: field %s: type %s is not supported by the generator",
+				message.Name, field.Name, typ)
+		}
+	}
+
+	return nil
+}
+
+// wireName returns the name of the primitive type the
+// named type is written as: enums are written as their
+// underlying types, byte as uint8 and rune as int32.
+func wireName(sch *schema.Schema, name string) string {
+	if enum := sch.Enum(name); enum != nil {
+		name = enum.Type
+	}
+
+	switch name {
+	case "byte":
+		return "uint8"
+
+	case "rune":
+		return "int32"
+
+	default:
+		return name
+	}
+}
+
+// isBytes returns true if the slice is
+// the byte array with its own representation
+// in the generated code.
+func isBytes(sch *schema.Schema, typ *schema.Type) bool {
+	return typ.Kind == schema.Slice && typ.Elem.Kind == schema.Named &&
+		sch.Enum(typ.Elem.Name) == nil && wireName(sch, typ.Elem.Name) == "uint8"
+}
@@ -0,0 +1,355 @@
+package gen_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+	"github.com/zergon321/kosuzu/gen"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// PlayerMovement and Choice are the messages
+// the examples generate the code for.
+type PlayerMovement struct {
+	ID int32
+	X  float64
+	Y  float64
+}
+
+type Choice struct {
+	Parameter  int32
+	Numbers    []int64
+	Parameters []complex128
+	Payload    []byte
+	Comment    string
+}
+
+func (mv PlayerMovement) Opcode() int32 {
+	return 32
+}
+
+// checkExample generates the code for the example
+// messages and compares it with the example file,
+// so the generators don't change their output
+// unnoticed. Run go generate in the example
+// directory if the change is intended.
+func checkExample(t *testing.T, path string, generate func(io.Writer, *schema.Schema) error) {
+	sch, err := schema.Reflect(PlayerMovement{}, Choice{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = generate(buf, sch)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("generated code differs from %s", path)
+	}
+}
+
+// choicePayload returns the payload of
+// the Choice the runtime tests encode.
+func choicePayload(t *testing.T) string {
+	choice := &Choice{
+		Parameter:  34,
+		Numbers:    []int64{13, -14, 1 << 40},
+		Parameters: []complex128{2 + 3i, -0.5 + 1i},
+		Payload:    []byte{192, 168, 1, 41},
+		Comment:    "小鈴",
+	}
+	packet, err := kosuzu.Serialize(0, choice)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(packet.Payload())
+}
+
+func TestTypeScript(t *testing.T) {
+	checkExample(t, "../examples/typescript/messages.ts", gen.TypeScript)
+
+	tsc, err := exec.LookPath("tsc")
+
+	if err != nil {
+		t.Skip("tsc is not installed")
+	}
+
+	node, err := exec.LookPath("node")
+
+	if err != nil {
+		t.Skip("node is not installed")
+	}
+
+	dir := t.TempDir()
+	source, err := os.ReadFile("../examples/typescript/messages.ts")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "messages.ts"), source, 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated code must write the same bytes
+	// as Serialize and reject the trailing bytes.
+	err = os.WriteFile(filepath.Join(dir, "main.ts"), []byte(`
+import { Choice, decodeChoice, encodeChoice } from "./messages";
+
+const hex = (data: Uint8Array): string =>
+  Array.from(data, (b) => b.toString(16).padStart(2, "0")).join("");
+
+const choice: Choice = {
+  Parameter: 34,
+  Numbers: [13n, -14n, 1n << 40n],
+  Parameters: [{ re: 2, im: 3 }, { re: -0.5, im: 1 }],
+  Payload: new Uint8Array([192, 168, 1, 41]),
+  Comment: "小鈴",
+};
+const payload = encodeChoice(choice);
+
+if (hex(encodeChoice(decodeChoice(payload))) !== hex(payload)) {
+  throw new Error("decoded value encodes differently");
+}
+
+let rejected = false;
+
+try {
+  decodeChoice(new Uint8Array([...payload, 0]));
+} catch {
+  rejected = true;
+}
+
+if (!rejected) {
+  throw new Error("trailing bytes are accepted");
+}
+
+console.log(hex(payload));
+`), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(tsc, "--strict", "--target", "es2020",
+		"--module", "commonjs", "--outDir", dir,
+		filepath.Join(dir, "messages.ts"), filepath.Join(dir, "main.ts"))
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+
+	output, err = exec.Command(node, filepath.Join(dir, "main.js")).CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+
+	if payload := strings.TrimSpace(string(output)); payload != choicePayload(t) {
+		t.Fatalf("expected %s, got %s", choicePayload(t), payload)
+	}
+}
+
+func TestGo(t *testing.T) {
+	sch, err := schema.ParseFile("../examples/schema/messages.kosuzu")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = gen.Go(buf, sch, sch.Package)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile("../examples/schema/messages.go")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("generated code differs from ../examples/schema/messages.go")
+	}
+}
+
+// csharpProgram encodes the Choice with the generated
+// code and prints the payload. It also checks the hostile
+// array lengths and the trailing bytes are rejected.
+const csharpProgram = `using System;
+using System.IO;
+using System.Numerics;
+using Example;
+
+static class Program
+{
+    static void Reject(byte[] payload)
+    {
+        try
+        {
+            Kosuzu.Decode(payload, new Choice().Read);
+        }
+        catch (Exception e) when (e is IOException || e is InvalidDataException)
+        {
+            return;
+        }
+
+        throw new Exception("the payload is accepted: " + BitConverter.ToString(payload));
+    }
+
+    static void Main()
+    {
+        var choice = new Choice
+        {
+            Parameter = 34,
+            Numbers = new long[] { 13, -14, 1L << 40 },
+            Parameters = new[] { new Complex(2, 3), new Complex(-0.5, 1) },
+            Payload = new byte[] { 192, 168, 1, 41 },
+            Comment = "小鈴",
+        };
+        var payload = Kosuzu.Encode(choice.Write);
+        var decoded = new Choice();
+        Kosuzu.Decode(payload, decoded.Read);
+
+        if (BitConverter.ToString(Kosuzu.Encode(decoded.Write)) != BitConverter.ToString(payload))
+        {
+            throw new Exception("decoded value encodes differently");
+        }
+
+        Reject(new byte[] { 0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff });
+        var trailing = new byte[payload.Length + 1];
+        payload.CopyTo(trailing, 0);
+        Reject(trailing);
+
+        Console.WriteLine(BitConverter.ToString(payload).Replace("-", "").ToLowerInvariant());
+    }
+}
+`
+
+func TestCSharp(t *testing.T) {
+	checkExample(t, "../examples/csharp/Messages.cs",
+		func(writer io.Writer, sch *schema.Schema) error {
+			return gen.CSharp(writer, sch, "Example")
+		})
+
+	dotnet, err := exec.LookPath("dotnet")
+
+	if err != nil {
+		// The default location of the install script.
+		home, _ := os.UserHomeDir()
+		dotnet = filepath.Join(home, ".dotnet", "dotnet")
+
+		if _, err := os.Stat(dotnet); err != nil {
+			t.Skip("dotnet is not installed")
+		}
+	}
+
+	version, err := exec.Command(dotnet, "--version").Output()
+
+	if err != nil {
+		t.Skipf("dotnet SDK is not installed: %v", err)
+	}
+
+	major := strings.SplitN(strings.TrimSpace(string(version)), ".", 2)[0]
+	dir := t.TempDir()
+	source, err := os.ReadFile("../examples/csharp/Messages.cs")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"Messages.cs": string(source),
+		"Program.cs":  csharpProgram,
+		"Test.csproj": `<Project Sdk="Microsoft.NET.Sdk">
+  <PropertyGroup>
+    <OutputType>Exe</OutputType>
+    <TargetFramework>net` + major + `.0</TargetFramework>
+  </PropertyGroup>
+</Project>
+`,
+	}
+
+	for name, content := range files {
+		err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(dotnet, "run", "--project", dir)
+	cmd.Env = append(os.Environ(),
+		"DOTNET_CLI_TELEMETRY_OPTOUT=1",
+		"DOTNET_NOLOGO=1",
+		"DOTNET_SKIP_FIRST_TIME_EXPERIENCE=1")
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+
+	if payload := strings.TrimSpace(string(output)); payload != choicePayload(t) {
+		t.Fatalf("expected %s, got %s", choicePayload(t), payload)
+	}
+}
+
+func TestPython(t *testing.T) {
+	checkExample(t, "../examples/python/messages.py", gen.Python)
+
+	python, err := exec.LookPath("python3")
+
+	if err != nil {
+		t.Skip("python3 is not installed")
+	}
+
+	// The generated code must write
+	// the same bytes as Serialize.
+	cmd := exec.Command(python, "-c", `
+from messages import Choice
+
+choice = Choice(
+    Parameter=34,
+    Numbers=[13, -14, 1 << 40],
+    Parameters=[2 + 3j, -0.5 + 1j],
+    Payload=bytes([192, 168, 1, 41]),
+    Comment="小鈴",
+)
+print(choice.encode().hex())
+assert Choice.decode(choice.encode()) == choice
+`)
+	cmd.Dir = "../examples/python"
+	output, err := cmd.CombinedOutput()
+
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+
+	if payload := strings.TrimSpace(string(output)); payload != choicePayload(t) {
+		t.Fatalf("expected %s, got %s", choicePayload(t), payload)
+	}
+}
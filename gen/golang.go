@@ -0,0 +1,207 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strings"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// Go writes the Go source code of the schema enums
+// and messages to the writer. Each message gets
+// Build and Decompose methods writing and reading
+// its fields with kosuzu Builder and Decomposer.
+// Messages with opcodes also get Serialize and
+// Deserialize methods working with packets.
+func Go(writer io.Writer, sch *schema.Schema, pkg string) error {
+	err := checkFlat(sch)
+
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "// Code generated by kosuzuc. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "package %s\n\n", pkg)
+
+	opcodes := []*schema.Message{}
+
+	for _, message := range sch.Messages {
+		if message.Opcode != nil {
+			opcodes = append(opcodes, message)
+		}
+	}
+
+	switch {
+	case len(opcodes) > 0:
+		fmt.Fprintf(buf, "import (\n\t\"fmt\"\n\n")
+		fmt.Fprintf(buf, "\t\"github.com/zergon321/kosuzu\"\n)\n\n")
+
+	case len(sch.Messages) > 0:
+		fmt.Fprintf(buf, "import \"github.com/zergon321/kosuzu\"\n\n")
+	}
+
+	for _, enum := range sch.Enums {
+		writeGoEnum(buf, enum)
+	}
+
+	if len(opcodes) > 0 {
+		fmt.Fprintf(buf, "// Message opcodes.\nconst (\n")
+
+		for _, message := range opcodes {
+			fmt.Fprintf(buf, "\tOpcode%s int32 = %d\n",
+				message.Name, *message.Opcode)
+		}
+
+		fmt.Fprintf(buf, ")\n\n")
+	}
+
+	for _, message := range sch.Messages {
+		err = writeGoMessage(buf, sch, message)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	src, err := format.Source(buf.Bytes())
+
+	if err != nil {
+		return fmt.Errorf("format generated code: %w", err)
+	}
+
+	_, err = writer.Write(src)
+
+	return err
+}
+
+func writeGoEnum(buf *bytes.Buffer, enum *schema.Enum) {
+	fmt.Fprintf(buf, "type %s %s\n\n", enum.Name, enum.Type)
+
+	if len(enum.Values) == 0 {
+		return
+	}
+
+	fmt.Fprintf(buf, "const (\n")
+
+	for _, value := range enum.Values {
+		fmt.Fprintf(buf, "\t%s%s %s = %d\n",
+			enum.Name, value.Name, enum.Name, value.Value)
+	}
+
+	fmt.Fprintf(buf, ")\n\n")
+}
+
+func writeGoMessage(buf *bytes.Buffer, sch *schema.Schema, message *schema.Message) error {
+	fmt.Fprintf(buf, "type %s struct {\n", message.Name)
+
+	for _, field := range message.Fields {
+		fmt.Fprintf(buf, "\t%s %s\n", field.Name, field.Type)
+	}
+
+	fmt.Fprintf(buf, "}\n\n")
+
+	build := new(bytes.Buffer)
+	decompose := new(bytes.Buffer)
+
+	for _, field := range message.Fields {
+		typ, err := schema.ParseType(field.Type)
+
+		if err != nil {
+			return err
+		}
+
+		method := goAccessor(sch, typ)
+		enum := sch.Enum(typ.Name)
+
+		if typ.Kind == schema.Named && enum != nil {
+			fmt.Fprintf(build, "\terr = builder.Add%s(%s(msg.%s))\n\n",
+				method, enum.Type, field.Name)
+			fmt.Fprintf(decompose, "\t{\n\t\tval, err := decomposer.Read%s()\n\n",
+				method)
+			fmt.Fprintf(decompose, "\t\tif err != nil {\n\t\t\treturn err\n\t\t}\n\n")
+			fmt.Fprintf(decompose, "\t\tmsg.%s = %s(val)\n\t}\n\n",
+				field.Name, enum.Name)
+		} else {
+			results := "msg." + field.Name + ", err"
+
+			if method == "Rune" {
+				results = "msg." + field.Name + ", _, err"
+			}
+
+			fmt.Fprintf(build, "\terr = builder.Add%s(msg.%s)\n\n",
+				method, field.Name)
+			fmt.Fprintf(decompose, "\t%s = decomposer.Read%s()\n\n",
+				results, method)
+			fmt.Fprintf(decompose, "\tif err != nil {\n\t\treturn err\n\t}\n\n")
+		}
+
+		fmt.Fprintf(build, "\tif err != nil {\n\t\treturn err\n\t}\n\n")
+	}
+
+	fmt.Fprintf(buf, "// Build writes the %s fields to the packet builder.\n",
+		message.Name)
+	fmt.Fprintf(buf, "func (msg *%s) Build(builder *kosuzu.Builder) error {\n",
+		message.Name)
+
+	if len(message.Fields) > 0 {
+		fmt.Fprintf(buf, "\tvar err error\n\n%s", build)
+	}
+
+	fmt.Fprintf(buf, "\treturn nil\n}\n\n")
+
+	fmt.Fprintf(buf, "// Decompose reads the %s fields from the packet decomposer.\n",
+		message.Name)
+	fmt.Fprintf(buf, "func (msg *%s) Decompose(decomposer *kosuzu.Decomposer) error {\n",
+		message.Name)
+	if len(message.Fields) > 0 {
+		fmt.Fprintf(buf, "\tvar err error\n\n%s", decompose)
+	}
+
+	fmt.Fprintf(buf, "\treturn nil\n}\n\n")
+
+	if message.Opcode == nil {
+		return nil
+	}
+
+	fmt.Fprintf(buf, "// Opcode returns the opcode of the %s packet.\n", message.Name)
+	fmt.Fprintf(buf, "func (msg *%s) Opcode() int32 {\n", message.Name)
+	fmt.Fprintf(buf, "\treturn Opcode%s\n}\n\n", message.Name)
+
+	fmt.Fprintf(buf, "// Serialize creates a new %s packet.\n", message.Name)
+	fmt.Fprintf(buf, "func (msg *%s) Serialize() (*kosuzu.Packet, error) {\n",
+		message.Name)
+	fmt.Fprintf(buf, "\tbuilder := kosuzu.NewPacketBuilder()\n")
+	fmt.Fprintf(buf, "\terr := msg.Build(builder)\n\n")
+	fmt.Fprintf(buf, "\tif err != nil {\n\t\treturn nil, err\n\t}\n\n")
+	fmt.Fprintf(buf, "\treturn builder.BuildPacket(Opcode%s), nil\n}\n\n", message.Name)
+
+	fmt.Fprintf(buf, "// Deserialize reads the %s from the packet.\n", message.Name)
+	fmt.Fprintf(buf, "func (msg *%s) Deserialize(packet *kosuzu.Packet) error {\n",
+		message.Name)
+	fmt.Fprintf(buf, "\tif packet.Opcode != Opcode%s {\n", message.Name)
+	fmt.Fprintf(buf, "\t\treturn fmt.Errorf(\"expected opcode %%d, got %%d\", Opcode%s, packet.Opcode)\n",
+		message.Name)
+	fmt.Fprintf(buf, "\t}\n\n")
+	fmt.Fprintf(buf, "\treturn msg.Decompose(kosuzu.NewPacketDecomposer(packet))\n}\n\n")
+
+	return nil
+}
+
+// goAccessor returns the name suffix of the
+// Builder and Decomposer methods for the type.
+func goAccessor(sch *schema.Schema, typ *schema.Type) string {
+	if typ.Kind == schema.Slice {
+		return goAccessor(sch, typ.Elem) + "Array"
+	}
+
+	if enum := sch.Enum(typ.Name); enum != nil {
+		return goAccessor(sch, &schema.Type{Name: enum.Type})
+	}
+
+	return strings.ToUpper(typ.Name[:1]) + typ.Name[1:]
+}
@@ -0,0 +1,536 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// pyRuntime contains the Python code
+// writing and reading primitive values and
+// packet headers the same way kosuzu does.
+const pyRuntime = `from __future__ import annotations
+
+import enum
+import io
+import struct
+from dataclasses import dataclass, field
+from typing import Any, BinaryIO, Callable, ClassVar, List, Optional
+
+FLAG_CHECKSUM = 1
+FLAG_SIGNATURE = 2
+FLAG_CORRELATION = 4
+LENGTH_MASK = (1 << 56) - 1
+
+_HEADER = struct.Struct(">iQ")
+_BOOL = struct.Struct(">B")
+_INT8 = struct.Struct(">b")
+_UINT8 = struct.Struct(">B")
+_INT16 = struct.Struct(">h")
+_UINT16 = struct.Struct(">H")
+_INT32 = struct.Struct(">i")
+_UINT32 = struct.Struct(">I")
+_INT64 = struct.Struct(">q")
+_UINT64 = struct.Struct(">Q")
+_FLOAT32 = struct.Struct(">f")
+_FLOAT64 = struct.Struct(">d")
+_COMPLEX64 = struct.Struct(">ff")
+_COMPLEX128 = struct.Struct(">dd")
+
+
+def _make_crc_table() -> List[int]:
+    table = []
+
+    for i in range(256):
+        crc = i
+
+        for _ in range(8):
+            crc = (crc >> 1) ^ 0x82F63B78 if crc & 1 else crc >> 1
+
+        table.append(crc)
+
+    return table
+
+
+_CRC_TABLE = _make_crc_table()
+
+
+def crc32c(data: bytes) -> int:
+    crc = 0xFFFFFFFF
+
+    for byte in data:
+        crc = _CRC_TABLE[(crc ^ byte) & 0xFF] ^ (crc >> 8)
+
+    return crc ^ 0xFFFFFFFF
+
+
+@dataclass
+class Packet:
+    opcode: int
+    payload: bytes
+    key_id: Optional[int] = None
+    correlation_id: Optional[int] = None
+    signature: Optional[bytes] = None
+
+
+class Writer:
+    def __init__(self) -> None:
+        self._buffer = bytearray()
+
+    def bool(self, value: bool) -> None:
+        self._buffer += _BOOL.pack(1 if value else 0)
+
+    def int8(self, value: int) -> None:
+        self._buffer += _INT8.pack(value)
+
+    def uint8(self, value: int) -> None:
+        self._buffer += _UINT8.pack(value)
+
+    def int16(self, value: int) -> None:
+        self._buffer += _INT16.pack(value)
+
+    def uint16(self, value: int) -> None:
+        self._buffer += _UINT16.pack(value)
+
+    def int32(self, value: int) -> None:
+        self._buffer += _INT32.pack(value)
+
+    def uint32(self, value: int) -> None:
+        self._buffer += _UINT32.pack(value)
+
+    def int64(self, value: int) -> None:
+        self._buffer += _INT64.pack(value)
+
+    def uint64(self, value: int) -> None:
+        self._buffer += _UINT64.pack(value)
+
+    def float32(self, value: float) -> None:
+        self._buffer += _FLOAT32.pack(value)
+
+    def float64(self, value: float) -> None:
+        self._buffer += _FLOAT64.pack(value)
+
+    def complex64(self, value: complex) -> None:
+        self._buffer += _COMPLEX64.pack(value.real, value.imag)
+
+    def complex128(self, value: complex) -> None:
+        self._buffer += _COMPLEX128.pack(value.real, value.imag)
+
+    def bytes(self, value: bytes) -> None:
+        self.int32(len(value))
+        self._buffer += value
+
+    def string(self, value: str) -> None:
+        self.bytes(value.encode("utf-8"))
+
+    def array(self, values: List[Any], write: Callable[[Any], None]) -> None:
+        self.int32(len(values))
+
+        for value in values:
+            write(value)
+
+    def finish(self) -> bytes:
+        return bytes(self._buffer)
+
+
+class Reader:
+    def __init__(self, data: bytes) -> None:
+        self._data = data
+        self._offset = 0
+
+    def _advance(self, n: int) -> int:
+        offset = self._offset
+
+        if n < 0 or offset + n > len(self._data):
+            raise ValueError(f"cannot read {n} bytes at offset {offset}")
+
+        self._offset += n
+
+        return offset
+
+    def _unpack(self, layout: struct.Struct) -> Any:
+        return layout.unpack_from(self._data, self._advance(layout.size))[0]
+
+    def bool(self) -> bool:
+        return self._unpack(_BOOL) != 0
+
+    def int8(self) -> int:
+        return self._unpack(_INT8)
+
+    def uint8(self) -> int:
+        return self._unpack(_UINT8)
+
+    def int16(self) -> int:
+        return self._unpack(_INT16)
+
+    def uint16(self) -> int:
+        return self._unpack(_UINT16)
+
+    def int32(self) -> int:
+        return self._unpack(_INT32)
+
+    def uint32(self) -> int:
+        return self._unpack(_UINT32)
+
+    def int64(self) -> int:
+        return self._unpack(_INT64)
+
+    def uint64(self) -> int:
+        return self._unpack(_UINT64)
+
+    def float32(self) -> float:
+        return self._unpack(_FLOAT32)
+
+    def float64(self) -> float:
+        return self._unpack(_FLOAT64)
+
+    def complex64(self) -> complex:
+        re, im = _COMPLEX64.unpack_from(self._data, self._advance(_COMPLEX64.size))
+
+        return complex(re, im)
+
+    def complex128(self) -> complex:
+        re, im = _COMPLEX128.unpack_from(self._data, self._advance(_COMPLEX128.size))
+
+        return complex(re, im)
+
+    def bytes(self) -> bytes:
+        length = self.int32()
+        offset = self._advance(length)
+
+        return bytes(self._data[offset:offset + length])
+
+    def string(self) -> str:
+        return self.bytes().decode("utf-8")
+
+    def array(self, read: Callable[[], Any]) -> List[Any]:
+        length = self.int32()
+
+        if length < 0:
+            raise ValueError(f"invalid array length {length}")
+
+        return [read() for _ in range(length)]
+
+    def finish(self) -> None:
+        if self._offset != len(self._data):
+            raise ValueError(f"{len(self._data) - self._offset} bytes left in the payload")
+
+
+def packet_bytes(opcode: int, payload: bytes, checksum: bool = False) -> bytes:
+    """Returns the raw binary representation
+    of the packet, optionally with the CRC32C trailer."""
+    flags = FLAG_CHECKSUM if checksum else 0
+    data = _HEADER.pack(opcode, flags << 56 | len(payload)) + payload
+
+    if checksum:
+        data += _UINT32.pack(crc32c(data))
+
+    return data
+
+
+def _read_exactly(stream: BinaryIO, n: int) -> bytes:
+    data = b""
+
+    while len(data) < n:
+        chunk = stream.read(n - len(data))
+
+        if not chunk:
+            raise EOFError(f"cannot read {n} bytes, got {len(data)}")
+
+        data += chunk
+
+    return data
+
+
+def read_packet(stream: BinaryIO) -> Packet:
+    """Reads the packet from the binary stream verifying
+    its checksum. The signature is returned as is.
+    Use socket.makefile("rb") to read from sockets."""
+    header = _read_exactly(stream, _HEADER.size)
+    opcode, length_field = _HEADER.unpack(header)
+    flags = length_field >> 56
+    length = length_field & LENGTH_MASK
+
+    if flags & ~(FLAG_CHECKSUM | FLAG_SIGNATURE | FLAG_CORRELATION):
+        raise ValueError(f"unknown packet flags: {flags:08b}")
+
+    packet = Packet(opcode, b"")
+    data = header
+
+    if flags & FLAG_SIGNATURE:
+        key_id = _read_exactly(stream, _UINT32.size)
+        packet.key_id = _UINT32.unpack(key_id)[0]
+        data += key_id
+
+    if flags & FLAG_CORRELATION:
+        correlation_id = _read_exactly(stream, _UINT32.size)
+        packet.correlation_id = _UINT32.unpack(correlation_id)[0]
+        data += correlation_id
+
+    packet.payload = _read_exactly(stream, length)
+    data += packet.payload
+
+    if flags & FLAG_SIGNATURE:
+        packet.signature = _read_exactly(stream, 32)
+        data += packet.signature
+
+    if flags & FLAG_CHECKSUM:
+        expected = _UINT32.unpack(_read_exactly(stream, _UINT32.size))[0]
+
+        if expected != crc32c(data):
+            raise ValueError(f"packet checksum mismatch: opcode {opcode}")
+
+    return packet
+
+
+def packet_from_bytes(data: bytes) -> Packet:
+    """Parses the packet out of the byte sequence."""
+    return read_packet(io.BytesIO(data))
+`
+
+// pyReserved contains the names declared by the runtime
+// part of the generated Python code and the capitalized
+// Python keywords.
+var pyReserved = map[string]bool{
+	"Packet":   true,
+	"Writer":   true,
+	"Reader":   true,
+	"Any":      true,
+	"BinaryIO": true,
+	"Callable": true,
+	"ClassVar": true,
+	"List":     true,
+	"Optional": true,
+	"False":    true,
+	"None":     true,
+	"True":     true,
+}
+
+// Python writes the Python dataclasses of the schema messages
+// to the writer. Each dataclass has the encode method and the
+// decode class method producing and reading the same bytes as
+// kosuzu.Serialize for the equivalent Go struct. Messages with
+// opcodes also have serialize and deserialize methods handling
+// the packet header. The output is a self-contained module
+// depending only on the standard library.
+//
+// Field names are kept as is, complex numbers are represented
+// with complex, and []byte is represented with bytes.
+func Python(writer io.Writer, sch *schema.Schema) error {
+	err := checkFlat(sch)
+
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "# Code generated by kosuzuc. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "%s", pyRuntime)
+
+	for _, enum := range sch.Enums {
+		if pyReserved[enum.Name] {
+			return fmt.Errorf("enum name is reserved: %s", enum.Name)
+		}
+
+		writePyEnum(buf, enum)
+	}
+
+	for _, message := range sch.Messages {
+		if pyReserved[message.Name] {
+			return fmt.Errorf("message name is reserved: %s", message.Name)
+		}
+
+		err = writePyMessage(buf, sch, message)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = writer.Write(buf.Bytes())
+
+	return err
+}
+
+func writePyEnum(buf *bytes.Buffer, enum *schema.Enum) {
+	fmt.Fprintf(buf, "\n\nclass %s(enum.IntEnum):\n", enum.Name)
+
+	if len(enum.Values) == 0 {
+		fmt.Fprintf(buf, "    pass\n")
+	}
+
+	for _, value := range enum.Values {
+		fmt.Fprintf(buf, "    %s = %d\n", value.Name, value.Value)
+	}
+}
+
+func writePyMessage(buf *bytes.Buffer, sch *schema.Schema, message *schema.Message) error {
+	types := make([]*schema.Type, len(message.Fields))
+
+	for i, field := range message.Fields {
+		if field.Name == "OPCODE" || pyReserved[field.Name] {
+			return fmt.Errorf("message %s: field name can't be used in Python: %s",
+				message.Name, field.Name)
+		}
+
+		typ, err := schema.ParseType(field.Type)
+
+		if err != nil {
+			return err
+		}
+
+		types[i] = typ
+	}
+
+	fmt.Fprintf(buf, "\n\n@dataclass\nclass %s:\n", message.Name)
+
+	if message.Opcode != nil {
+		fmt.Fprintf(buf, "    OPCODE: ClassVar[int] = %d\n\n", *message.Opcode)
+	}
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "    %s: %s = %s\n", field.Name,
+			pyType(sch, types[i]), pyDefault(sch, types[i]))
+	}
+
+	if len(message.Fields) > 0 {
+		fmt.Fprintf(buf, "\n")
+	}
+
+	fmt.Fprintf(buf, "    def encode(self) -> bytes:\n")
+	fmt.Fprintf(buf, "        writer = Writer()\n")
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "        %s\n", pyWrite(sch, types[i], "self."+field.Name))
+	}
+
+	fmt.Fprintf(buf, "\n        return writer.finish()\n\n")
+
+	fmt.Fprintf(buf, "    @classmethod\n")
+	fmt.Fprintf(buf, "    def decode(cls, payload: bytes) -> %s:\n", message.Name)
+	fmt.Fprintf(buf, "        reader = Reader(payload)\n")
+	fmt.Fprintf(buf, "        msg = cls(\n")
+
+	for i, field := range message.Fields {
+		fmt.Fprintf(buf, "            %s=%s,\n", field.Name, pyRead(sch, types[i]))
+	}
+
+	fmt.Fprintf(buf, "        )\n")
+	fmt.Fprintf(buf, "        reader.finish()\n\n")
+	fmt.Fprintf(buf, "        return msg\n")
+
+	if message.Opcode == nil {
+		return nil
+	}
+
+	fmt.Fprintf(buf, "\n    def serialize(self, checksum: bool = False) -> bytes:\n")
+	fmt.Fprintf(buf, "        return packet_bytes(self.OPCODE, self.encode(), checksum)\n\n")
+
+	fmt.Fprintf(buf, "    @classmethod\n")
+	fmt.Fprintf(buf, "    def deserialize(cls, data: bytes) -> %s:\n", message.Name)
+	fmt.Fprintf(buf, "        packet = packet_from_bytes(data)\n\n")
+	fmt.Fprintf(buf, "        if packet.opcode != cls.OPCODE:\n")
+	fmt.Fprintf(buf, "            raise ValueError(f\"expected opcode {cls.OPCODE}, got {packet.opcode}\")\n\n")
+	fmt.Fprintf(buf, "        return cls.decode(packet.payload)\n")
+
+	return nil
+}
+
+func pyType(sch *schema.Schema, typ *schema.Type) string {
+	if isBytes(sch, typ) {
+		return "bytes"
+	}
+
+	if typ.Kind == schema.Slice {
+		return "List[" + pyType(sch, typ.Elem) + "]"
+	}
+
+	if sch.Enum(typ.Name) != nil {
+		return typ.Name
+	}
+
+	switch wireName(sch, typ.Name) {
+	case "bool":
+		return "bool"
+
+	case "string":
+		return "str"
+
+	case "float32", "float64":
+		return "float"
+
+	case "complex64", "complex128":
+		return "complex"
+
+	default:
+		return "int"
+	}
+}
+
+// pyDefault returns the default value of the field.
+// Enum defaults are created by the factory because
+// the field may shadow the enum class in the class body.
+func pyDefault(sch *schema.Schema, typ *schema.Type) string {
+	if typ.Kind == schema.Slice && !isBytes(sch, typ) {
+		return "field(default_factory=list)"
+	}
+
+	if enum := sch.Enum(typ.Name); enum != nil && len(enum.Values) > 0 {
+		return fmt.Sprintf("field(default_factory=lambda: %s.%s)",
+			enum.Name, enum.Values[0].Name)
+	}
+
+	switch pyType(sch, typ) {
+	case "bytes":
+		return `b""`
+
+	case "bool":
+		return "False"
+
+	case "str":
+		return `""`
+
+	case "float":
+		return "0.0"
+
+	case "complex":
+		return "0j"
+
+	default:
+		return "0"
+	}
+}
+
+func pyWrite(sch *schema.Schema, typ *schema.Type, value string) string {
+	if isBytes(sch, typ) {
+		return fmt.Sprintf("writer.bytes(%s)", value)
+	}
+
+	if typ.Kind == schema.Slice {
+		return fmt.Sprintf("writer.array(%s, writer.%s)",
+			value, wireName(sch, typ.Elem.Name))
+	}
+
+	return fmt.Sprintf("writer.%s(%s)", wireName(sch, typ.Name), value)
+}
+
+func pyRead(sch *schema.Schema, typ *schema.Type) string {
+	if isBytes(sch, typ) {
+		return "reader.bytes()"
+	}
+
+	if typ.Kind == schema.Slice {
+		return fmt.Sprintf("reader.array(reader.%s)", wireName(sch, typ.Elem.Name))
+	}
+
+	read := fmt.Sprintf("reader.%s()", wireName(sch, typ.Name))
+
+	if sch.Enum(typ.Name) != nil {
+		return fmt.Sprintf("%s(%s)", typ.Name, read)
+	}
+
+	return read
+}
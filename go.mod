@@ -1,5 +1,5 @@
 module github.com/zergon321/kosuzu
 
-go 1.17
+go 1.18
 
 require github.com/gopherjs/gopherjs v0.0.0-20211004101933-6b77bd30416d
@@ -0,0 +1,404 @@
+package kosuzu_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden vectors")
+
+// goldenPath is the file with the golden vectors
+// shared with the tests of the JS bindings.
+const goldenPath = "testdata/golden.json"
+
+// Data mirrors the struct from examples/comprehensive.
+type Data struct {
+	Str         string
+	Rune        rune
+	Runes       []rune
+	Bool        bool
+	Bools       []bool
+	Byte        byte
+	Bytes       []byte
+	Int8        int8
+	Uint8       uint8
+	Int8s       []int8
+	Uint8s      []uint8
+	Int16       int16
+	Uint16      uint16
+	Int16s      []int16
+	Uint16s     []uint16
+	Int32       int32
+	Uint32      uint32
+	Int32s      []int32
+	Uint32s     []uint32
+	Int64       int64
+	Uint64      uint64
+	Int64s      []int64
+	Uint64s     []uint64
+	Float32     float32
+	Float32s    []float32
+	Float64     float64
+	Float64s    []float64
+	Complex64   complex64
+	Complex64s  []complex64
+	Complex128  complex128
+	Complex128s []complex128
+}
+
+// Empty holds the values
+// of the zero length.
+type Empty struct {
+	Str      string
+	Ints     []int32
+	Optional *Position
+	Scores   map[string]uint16
+}
+
+// goldenVector is the encoding of the value
+// which must not change between releases.
+// The fields, types and value are written
+// the way the JS bindings accept them:
+// 64-bit integers as decimal strings and
+// complex numbers as {re, im} objects.
+type goldenVector struct {
+	Name   string                         `json:"name"`
+	Fields []map[string]string            `json:"fields"`
+	Types  map[string][]map[string]string `json:"types,omitempty"`
+	Value  map[string]interface{}         `json:"value"`
+	Hex    string                         `json:"hex"`
+}
+
+// builderVectors contain the values written
+// by every Builder method along with the types
+// of the equivalent struct fields.
+var builderVectors = []struct {
+	method string
+	typ    string
+	value  interface{}
+}{
+	{"AddBool", "bool", true},
+	{"AddRune", "rune", '鈴'},
+	{"AddByte", "byte", byte(0xab)},
+	{"AddInt8", "int8", int8(math.MinInt8)},
+	{"AddUint8", "uint8", uint8(math.MaxUint8)},
+	{"AddInt16", "int16", int16(-12345)},
+	{"AddUint16", "uint16", uint16(math.MaxUint16)},
+	{"AddInt32", "int32", int32(-2)},
+	{"AddUint32", "uint32", uint32(math.MaxUint32)},
+	{"AddInt64", "int64", int64(math.MinInt64)},
+	{"AddUint64", "uint64", uint64(math.MaxUint64)},
+	{"AddFloat32", "float32", float32(-120.56)},
+	{"AddFloat64", "float64", math.Pi},
+	{"AddComplex64", "complex64", complex64(3 + 2i)},
+	{"AddComplex128", "complex128", -0.5 + 1e300i},
+	{"AddString", "string", "小鈴"},
+	{"AddBytes", "[4]byte", []byte{192, 168, 1, 41}},
+	{"AddByteArray", "[]byte", []byte{0xde, 0xad, 0xbe, 0xef}},
+	{"AddInt8Array", "[]int8", []int8{-120, 122, -125}},
+	{"AddUint8Array", "[]uint8", []uint8{1, 2, 255}},
+	{"AddInt16Array", "[]int16", []int16{-120, 32767, -32768}},
+	{"AddUint16Array", "[]uint16", []uint16{1, 2, 65535}},
+	{"AddInt32Array", "[]int32", []int32{-120, math.MaxInt32, math.MinInt32}},
+	{"AddUint32Array", "[]uint32", []uint32{1, 2, math.MaxUint32}},
+	{"AddInt64Array", "[]int64", []int64{-120, 9007199254740993, math.MinInt64}},
+	{"AddUint64Array", "[]uint64", []uint64{1, 2, math.MaxUint64}},
+	{"AddFloat32Array", "[]float32", []float32{-130.1, -150.12, -14.8}},
+	{"AddFloat64Array", "[]float64", []float64{-130.1, 0, math.MaxFloat64}},
+	{"AddComplex64Array", "[]complex64", []complex64{3 + 2i, 2 + 3i, 7 + 11i}},
+	{"AddComplex128Array", "[]complex128", []complex128{9 + 8i, 5 + 12i}},
+	{"AddBoolArray", "[]bool", []bool{true, false, true}},
+	{"AddRuneArray", "[]rune", []rune("ロック")},
+}
+
+// structVectors contain the representative
+// structs written with Serialize.
+var structVectors = []interface{}{
+	&Data{
+		Str:         "Lolk",
+		Rune:        '良',
+		Runes:       []rune("ロックしましょう"),
+		Bool:        true,
+		Bools:       []bool{true, false, true, true, false},
+		Byte:        32,
+		Bytes:       []byte{192, 168, 1, 41},
+		Int8:        -120,
+		Uint8:       255,
+		Int8s:       []int8{-120, 122, -125},
+		Uint8s:      []uint8{1, 2, 3, 4, 5},
+		Int16:       -120,
+		Uint16:      255,
+		Int16s:      []int16{-120, 122, -125},
+		Uint16s:     []uint16{1, 2, 3, 4, 5},
+		Int32:       -120,
+		Uint32:      255,
+		Int32s:      []int32{-120, 122, -125},
+		Uint32s:     []uint32{1, 2, 3, 4, 5},
+		Int64:       -120,
+		Uint64:      255,
+		Int64s:      []int64{-120, 122, -125},
+		Uint64s:     []uint64{1, 2, 3, 4, 5},
+		Float32:     -120.56,
+		Float32s:    []float32{-130.1, -150.12, -14.8},
+		Float64:     -120.56,
+		Float64s:    []float64{-130.1, -150.12, -14.8},
+		Complex64:   3 + 2i,
+		Complex64s:  []complex64{3 + 2i, 2 + 3i, 7 + 11i},
+		Complex128:  7 + 9i,
+		Complex128s: []complex128{9 + 8i, 5 + 12i},
+	},
+	&Inventory{
+		Owner: "kosuzu",
+		Items: []Item{{1, "book"}, {2, "scroll"}, {3, "lamp"}},
+	},
+	&PlayerMovement{
+		ID:       7,
+		Team:     2,
+		Name:     "reimu",
+		Position: Position{X: 1.5, Y: -2},
+		Path:     []Position{{X: 1}, {Y: 2}},
+		Target:   &Position{X: 3, Y: 4},
+		Scores:   map[string]uint16{"b": 2, "a": 1},
+		Color:    [3]byte{255, 128, 0},
+		Phase:    1 + 2i,
+	},
+	&Empty{
+		Ints:   []int32{},
+		Scores: map[string]uint16{},
+	},
+}
+
+// goldenValue converts the Go value to the JSON
+// value in the form accepted by the JS bindings.
+func goldenValue(value reflect.Value) interface{} {
+	switch value.Kind() {
+	case reflect.Int64:
+		return fmt.Sprint(value.Int())
+
+	case reflect.Uint64:
+		return fmt.Sprint(value.Uint())
+
+	case reflect.Complex64, reflect.Complex128:
+		return map[string]interface{}{
+			"re": real(value.Complex()),
+			"im": imag(value.Complex()),
+		}
+
+	case reflect.Slice, reflect.Array:
+		values := []interface{}{}
+
+		for i := 0; i < value.Len(); i++ {
+			values = append(values, goldenValue(value.Index(i)))
+		}
+
+		return values
+
+	case reflect.Map:
+		obj := map[string]interface{}{}
+		iter := value.MapRange()
+
+		for iter.Next() {
+			obj[fmt.Sprint(iter.Key().Interface())] = goldenValue(iter.Value())
+		}
+
+		return obj
+
+	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
+
+		return goldenValue(value.Elem())
+
+	case reflect.Struct:
+		obj := map[string]interface{}{}
+
+		for i := 0; i < value.NumField(); i++ {
+			obj[value.Type().Field(i).Name] = goldenValue(value.Field(i))
+		}
+
+		return obj
+
+	default:
+		return value.Interface()
+	}
+}
+
+// goldenVectors encodes the vector values
+// with the current version of the package.
+func goldenVectors(t *testing.T) []*goldenVector {
+	vectors := []*goldenVector{}
+
+	for _, vector := range builderVectors {
+		builder := kosuzu.NewPacketBuilder()
+		method := reflect.ValueOf(builder).MethodByName(vector.method)
+		results := method.Call([]reflect.Value{reflect.ValueOf(vector.value)})
+
+		if err, _ := results[0].Interface().(error); err != nil {
+			t.Fatalf("%s: %v", vector.method, err)
+		}
+
+		vectors = append(vectors, &goldenVector{
+			Name:   fmt.Sprintf("%s %v", vector.method, vector.typ),
+			Fields: []map[string]string{{"name": "Value", "type": vector.typ}},
+			Value: map[string]interface{}{
+				"Value": goldenValue(reflect.ValueOf(vector.value)),
+			},
+			Hex: hex.EncodeToString(builder.BuildPacket(0).Payload()),
+		})
+	}
+
+	for _, value := range structVectors {
+		sch, err := kosuzu.SchemaOf(value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packet, err := kosuzu.Serialize(0, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		vector := &goldenVector{
+			Name:  sch.Messages[0].Name,
+			Value: goldenValue(reflect.ValueOf(value)).(map[string]interface{}),
+			Hex:   hex.EncodeToString(packet.Payload()),
+		}
+
+		for i, message := range sch.Messages {
+			fields := []map[string]string{}
+
+			for _, field := range message.Fields {
+				fields = append(fields, map[string]string{
+					"name": field.Name,
+					"type": field.Type,
+				})
+			}
+
+			if i == 0 {
+				vector.Fields = fields
+				continue
+			}
+
+			if vector.Types == nil {
+				vector.Types = map[string][]map[string]string{}
+			}
+
+			vector.Types[message.Name] = fields
+		}
+
+		vectors = append(vectors, vector)
+	}
+
+	return vectors
+}
+
+func TestGoldenVectors(t *testing.T) {
+	vectors := goldenVectors(t)
+	data, err := json.MarshalIndent(vectors, "", "  ")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		err = os.WriteFile(goldenPath, append(data, '\n'), 0644)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	golden, err := os.ReadFile(goldenPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*goldenVector{}
+	err = json.Unmarshal(golden, &expected)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(expected) != len(vectors) {
+		t.Fatalf("expected %d vectors, got %d, run go test -update if the change is intended",
+			len(expected), len(vectors))
+	}
+
+	for i, vector := range vectors {
+		if vector.Name != expected[i].Name || vector.Hex != expected[i].Hex {
+			t.Fatalf("%s: the wire format changed:\nexpected %s\ngot      %s",
+				vector.Name, expected[i].Hex, vector.Hex)
+		}
+	}
+}
+
+func TestGoldenDecode(t *testing.T) {
+	vectors := goldenVectors(t)
+
+	for i, vector := range builderVectors {
+		payload, err := hex.DecodeString(vectors[i].Hex)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decomposer := kosuzu.NewPacketDecomposer(kosuzu.NewPacket(0, payload))
+		var results []reflect.Value
+
+		switch vector.method {
+		case "AddBytes":
+			results = reflect.ValueOf(decomposer).MethodByName("ReadNBytes").
+				Call([]reflect.Value{reflect.ValueOf(len(payload))})
+
+		default:
+			results = reflect.ValueOf(decomposer).
+				MethodByName(strings.Replace(vector.method, "Add", "Read", 1)).Call(nil)
+		}
+
+		if err, _ := results[len(results)-1].Interface().(error); err != nil {
+			t.Fatalf("%s: %v", vectors[i].Name, err)
+		}
+
+		if !reflect.DeepEqual(results[0].Interface(), vector.value) {
+			t.Fatalf("%s: expected %v, got %v", vectors[i].Name, vector.value, results[0])
+		}
+
+		if err := decomposer.Done(); err != nil {
+			t.Fatalf("%s: %v", vectors[i].Name, err)
+		}
+	}
+
+	for i, value := range structVectors {
+		vector := vectors[len(builderVectors)+i]
+		payload, err := hex.DecodeString(vector.Hex)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := reflect.New(reflect.TypeOf(value).Elem())
+		err = kosuzu.DeserializeStrict(kosuzu.NewPacket(0, payload), decoded.Interface())
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		if !reflect.DeepEqual(decoded.Interface(), value) {
+			t.Fatalf("%s: expected %+v, got %+v", vector.Name, value, decoded)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package kosuzu
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// HandshakeOpcode is the opcode of the
+// packet exchanged by Handshake. It must
+// not be used by the application messages.
+const HandshakeOpcode int32 = math.MinInt32
+
+// ErrHandshakeMismatch is returned when the
+// peers disagree on the protocol version or
+// the schema fingerprint.
+var ErrHandshakeMismatch = errors.New("handshake mismatch")
+
+// Hello is the description of the peer
+// exchanged during the handshake.
+type Hello struct {
+	// Version is the version of the
+	// application protocol.
+	Version uint32
+	// Fingerprint is the hash of the messages
+	// the peer sends and receives, usually
+	// obtained with schema.Schema.Fingerprint.
+	Fingerprint [sha256.Size]byte
+	// Features is the set of optional features
+	// the peer supports, such as compression
+	// or encryption. The bits are defined by
+	// the application, and the features both
+	// peers support are local.Features &
+	// remote.Features.
+	Features uint64
+}
+
+// HandshakeError describes the
+// rejected handshake.
+type HandshakeError struct {
+	Local  Hello
+	Remote Hello
+}
+
+// Error returns the description of the error.
+func (err *HandshakeError) Error() string {
+	reasons := []string{}
+
+	if err.Local.Version != err.Remote.Version {
+		reasons = append(reasons, fmt.Sprintf(
+			"protocol version %d, remote %d",
+			err.Local.Version, err.Remote.Version))
+	}
+
+	if err.Local.Fingerprint != err.Remote.Fingerprint {
+		reasons = append(reasons, fmt.Sprintf(
+			"schema fingerprint %x, remote %x",
+			err.Local.Fingerprint[:8], err.Remote.Fingerprint[:8]))
+	}
+
+	return fmt.Sprintf("%s: %s",
+		ErrHandshakeMismatch, strings.Join(reasons, ", "))
+}
+
+// Unwrap returns ErrHandshakeMismatch so
+// the error can be checked with errors.Is.
+func (err *HandshakeError) Unwrap() error {
+	return ErrHandshakeMismatch
+}
+
+// Handshake sends the local Hello to the peer
+// and reads the peer's one. It should be called
+// by both peers right after the connection is
+// established, before any other packets are sent.
+// Both Hello values are sent at once, so neither
+// peer waits for the other one to speak first.
+// Handshake returns only after the local Hello
+// is written, even if reading the remote one
+// fails, so it never writes to the stream after
+// returning. The stream should be closed if
+// the handshake fails.
+//
+// The context bounds the handshake, so it doesn't
+// block forever if the peer never speaks or never
+// reads. If the stream has the SetDeadline method,
+// like net.Conn, the pending read and write are
+// interrupted with the deadline in the past when
+// the context is done, and the deadline isn't reset
+// afterwards. Otherwise Handshake returns as soon
+// as the context is done, and the stream must be
+// closed to stop the pending read and write.
+//
+// If the protocol versions or the fingerprints
+// differ, the *HandshakeError is returned along
+// with the remote Hello.
+func Handshake(ctx context.Context, stream io.ReadWriter, local Hello) (Hello, error) {
+	packet, err := Serialize(HandshakeOpcode, &local)
+
+	if err != nil {
+		return Hello{}, err
+	}
+
+	packet.SetChecksum(true)
+	written := make(chan error, 1)
+	read := make(chan error, 1)
+	var remote Hello
+
+	go func() {
+		_, err := packet.WriteTo(stream)
+		written <- err
+	}()
+
+	go func() {
+		var err error
+		remote, err = readHello(stream)
+		read <- err
+	}()
+
+	conn, interruptible := stream.(deadliner)
+	done := ctx.Done()
+	var readErr, writeErr error
+
+	for pending := 2; pending > 0; {
+		select {
+		case readErr = <-read:
+			pending--
+
+		case writeErr = <-written:
+			pending--
+
+		case <-done:
+			if !interruptible {
+				return Hello{}, fmt.Errorf("handshake: %w", ctx.Err())
+			}
+
+			// Wait for the interrupted read and write
+			// to return, so they don't touch the stream
+			// after Handshake does.
+			conn.SetDeadline(aLongTimeAgo)
+			done = nil
+		}
+	}
+
+	if (readErr != nil || writeErr != nil) && ctx.Err() != nil {
+		return Hello{}, fmt.Errorf("handshake: %w", ctx.Err())
+	}
+
+	if readErr != nil {
+		return Hello{}, fmt.Errorf("read handshake: %w", readErr)
+	}
+
+	if writeErr != nil {
+		return Hello{}, fmt.Errorf("write handshake: %w", writeErr)
+	}
+
+	if local.Version != remote.Version ||
+		local.Fingerprint != remote.Fingerprint {
+		return remote, &HandshakeError{
+			Local:  local,
+			Remote: remote,
+		}
+	}
+
+	return remote, nil
+}
+
+// deadliner is the stream which pending
+// reads and writes can be interrupted
+// with a deadline, like net.Conn.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// aLongTimeAgo is the deadline which
+// interrupts the pending operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// readHello reads the Hello
+// packet sent by the peer.
+func readHello(stream io.Reader) (Hello, error) {
+	var remote Hello
+	_, reply, err := ReadPacketFrom(stream)
+
+	if err != nil {
+		return Hello{}, err
+	}
+
+	if reply.Opcode != HandshakeOpcode {
+		return Hello{}, fmt.Errorf(
+			"expected handshake packet, got opcode %d", reply.Opcode)
+	}
+
+	err = Deserialize(reply, &remote)
+
+	if err != nil {
+		return Hello{}, err
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,169 @@
+package kosuzu_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func handshake(client, server kosuzu.Hello) (kosuzu.Hello, error, kosuzu.Hello, error) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	type result struct {
+		hello kosuzu.Hello
+		err   error
+	}
+
+	done := make(chan result)
+
+	go func() {
+		hello, err := kosuzu.Handshake(context.Background(), serverConn, server)
+		done <- result{hello, err}
+	}()
+
+	clientRemote, clientErr := kosuzu.Handshake(context.Background(), clientConn, client)
+	res := <-done
+
+	return clientRemote, clientErr, res.hello, res.err
+}
+
+func TestHandshake(t *testing.T) {
+	sch, err := kosuzu.SchemaOf(&PlayerMovement{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := kosuzu.Hello{Version: 3, Fingerprint: sch.Fingerprint(), Features: 0b011}
+	server := kosuzu.Hello{Version: 3, Fingerprint: sch.Fingerprint(), Features: 0b110}
+	clientRemote, clientErr, serverRemote, serverErr := handshake(client, server)
+
+	if clientErr != nil || serverErr != nil {
+		t.Fatal(clientErr, serverErr)
+	}
+
+	if clientRemote != server || serverRemote != client {
+		t.Fatalf("unexpected remote hello: %+v, %+v", clientRemote, serverRemote)
+	}
+
+	other, err := kosuzu.SchemaOf(&Choice{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server.Fingerprint = other.Fingerprint()
+	_, clientErr, _, serverErr = handshake(client, server)
+
+	var handshakeErr *kosuzu.HandshakeError
+
+	if !errors.As(clientErr, &handshakeErr) || !errors.Is(serverErr, kosuzu.ErrHandshakeMismatch) {
+		t.Fatalf("expected handshake mismatch, got %v, %v", clientErr, serverErr)
+	}
+
+	if handshakeErr.Remote != server {
+		t.Fatalf("unexpected remote hello: %+v", handshakeErr.Remote)
+	}
+}
+
+// blockedWriter is the stream which
+// reads the data and blocks writes
+// until it's released.
+type blockedWriter struct {
+	io.Reader
+	writing chan struct{}
+	release chan struct{}
+	wrote   int32
+}
+
+func (stream *blockedWriter) Write(data []byte) (int, error) {
+	select {
+	case stream.writing <- struct{}{}:
+	default:
+	}
+
+	<-stream.release
+	atomic.StoreInt32(&stream.wrote, 1)
+
+	return len(data), nil
+}
+
+func TestHandshakeUnexpectedPacket(t *testing.T) {
+	data, err := kosuzu.NewPacket(1, []byte("reimu")).Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &blockedWriter{
+		Reader:  bytes.NewReader(data),
+		writing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+	returned := make(chan bool)
+
+	go func() {
+		_, err := kosuzu.Handshake(context.Background(), stream, kosuzu.Hello{Version: 1})
+
+		if err == nil || errors.Is(err, kosuzu.ErrHandshakeMismatch) {
+			t.Errorf("expected unexpected packet error, got %v", err)
+		}
+
+		returned <- atomic.LoadInt32(&stream.wrote) == 1
+	}()
+
+	// The client must not return before its
+	// Hello is written, so it doesn't write
+	// to the stream after the error.
+	<-stream.writing
+	close(stream.release)
+
+	if !<-returned {
+		t.Fatal("expected the hello to be written before returning")
+	}
+}
+
+func TestHandshakeContext(t *testing.T) {
+	// The peer never reads nor writes.
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := kosuzu.Handshake(ctx, clientConn, kosuzu.Hello{Version: 1})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// The stream without deadlines
+	// which peer is silent as well.
+	reader, _ := io.Pipe()
+	_, writer := io.Pipe()
+	defer reader.Close()
+	defer writer.Close()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	stream := struct {
+		io.Reader
+		io.Writer
+	}{reader, writer}
+	_, err = kosuzu.Handshake(ctx, stream, kosuzu.Hello{Version: 1})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// toPacket converts the JavaScript
+// packet object to the Go packet.
+func toPacket(packet map[string]interface{}) (*kosuzu.Packet, error) {
+	opcode, ok := packet["opcode"].(float64)
+
+	if !ok {
+		return nil, fmt.Errorf("packet opcode must be a number")
+	}
+
+	payload, ok := packet["payload"].([]byte)
+
+	if !ok {
+		return nil, fmt.Errorf("packet payload must be a Uint8Array")
+	}
+
+	return kosuzu.NewPacket(int32(opcode), payload), nil
+}
+
+// toSchema returns the compiled schema
+// or compiles the array of {name, type}
+// objects passed from JavaScript.
+func toSchema(scheme interface{}) (*messageSchema, error) {
+	switch s := scheme.(type) {
+	case *messageSchema:
+		return s, nil
+
+	case []interface{}:
+		return compileSchema(s, nil)
+
+	default:
+		return nil, fmt.Errorf(
+			"schema must be an array of {name, type} objects or a compiled schema")
+	}
+}
+
+// decodePacket reads the object out of
+// the JavaScript packet using the schema.
+func decodePacket(scheme interface{}, packet map[string]interface{}) (map[string]interface{}, error) {
+	compiled, err := toSchema(scheme)
+
+	if err != nil {
+		return nil, err
+	}
+
+	goPacket, err := toPacket(packet)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decomposer := kosuzu.NewPacketDecomposer(goPacket)
+
+	return compiled.decode(decomposer)
+}
+
+// packetStream cuts the packets out of the byte
+// chunks received from the socket. The chunks
+// don't have to be aligned with the packets.
+type packetStream struct {
+	buffer    []byte
+	maxLength int64
+	err       error
+}
+
+// push appends the chunk to the buffered bytes and
+// returns the packets completed by it. Once the stream
+// fails, the packet boundaries are lost, so the same
+// error is returned for all the next chunks.
+func (stream *packetStream) push(chunk []byte) ([]*kosuzu.Packet, error) {
+	if stream.err != nil {
+		return nil, stream.err
+	}
+
+	stream.buffer = append(stream.buffer, chunk...)
+	packets := []*kosuzu.Packet{}
+	offset := 0
+
+	for len(stream.buffer)-offset >= kosuzu.HeaderLength {
+		length, err := kosuzu.PacketLength(stream.buffer[offset:])
+
+		if err == nil && stream.maxLength > 0 && length > stream.maxLength {
+			err = fmt.Errorf("packet length %d exceeds the limit of %d bytes",
+				length, stream.maxLength)
+		}
+
+		if err != nil {
+			stream.err = err
+			break
+		}
+
+		if int64(len(stream.buffer)-offset) < length {
+			break
+		}
+
+		packet, err := kosuzu.PacketFromBytes(
+			stream.buffer[offset : offset+int(length)])
+
+		if err != nil {
+			stream.err = err
+			break
+		}
+
+		packets = append(packets, packet)
+		offset += int(length)
+	}
+
+	// Keep only the incomplete packet.
+	stream.buffer = append(stream.buffer[:0], stream.buffer[offset:]...)
+
+	return packets, stream.err
+}
+
+// close returns the error if the
+// stream ended in the middle of the packet.
+func (stream *packetStream) close() error {
+	if stream.err == nil && len(stream.buffer) > 0 {
+		stream.err = fmt.Errorf(
+			"stream ended with %d bytes of the incomplete packet",
+			len(stream.buffer))
+
+		return stream.err
+	}
+
+	stream.buffer = nil
+
+	return nil
+}
+
+// packetStreamClass is the body of the function taking the
+// platform splitter constructor and returning the PacketStream
+// class. The splitter has push(chunk) and close() methods
+// returning the {value, error} objects.
+//
+// The packets are passed to the onPacket callback or,
+// without one, can be consumed with the async iterator.
+const packetStreamClass = `return class PacketStream {
+  constructor(onPacket, options) {
+    this.onPacket = onPacket || null;
+    this.splitter = newSplitter((options && options.maxLength) || 0);
+    this.queue = [];
+    this.waiting = [];
+    this.error = null;
+    this.ended = false;
+    this.closed = false;
+  }
+
+  push(chunk) {
+    if (this.error) {
+      throw this.error;
+    }
+
+    if (this.ended) {
+      throw new Error("packet stream has ended");
+    }
+
+    if (chunk instanceof ArrayBuffer) {
+      chunk = new Uint8Array(chunk);
+    } else if (ArrayBuffer.isView(chunk) && chunk.constructor !== Uint8Array) {
+      chunk = new Uint8Array(chunk.buffer, chunk.byteOffset, chunk.byteLength);
+    }
+
+    const result = this.splitter.push(chunk);
+
+    for (const packet of result.value) {
+      this.emit(packet);
+    }
+
+    if (result.error) {
+      this.fail(result.error);
+      throw result.error;
+    }
+  }
+
+  end() {
+    if (this.ended || this.error) {
+      return;
+    }
+
+    const result = this.close();
+
+    if (result.error) {
+      this.fail(result.error);
+      throw result.error;
+    }
+
+    this.ended = true;
+
+    for (const waiter of this.waiting.splice(0)) {
+      waiter.resolve({ value: undefined, done: true });
+    }
+  }
+
+  emit(packet) {
+    if (this.onPacket) {
+      this.onPacket(packet);
+    } else if (this.waiting.length > 0) {
+      this.waiting.shift().resolve({ value: packet, done: false });
+    } else {
+      this.queue.push(packet);
+    }
+  }
+
+  close() {
+    if (this.closed) {
+      return { value: null, error: null };
+    }
+
+    this.closed = true;
+
+    return this.splitter.close();
+  }
+
+  fail(error) {
+    this.error = error;
+    this.close();
+
+    for (const waiter of this.waiting.splice(0)) {
+      waiter.reject(error);
+    }
+  }
+
+  next() {
+    if (this.queue.length > 0) {
+      return Promise.resolve({ value: this.queue.shift(), done: false });
+    }
+
+    if (this.error) {
+      return Promise.reject(this.error);
+    }
+
+    if (this.ended) {
+      return Promise.resolve({ value: undefined, done: true });
+    }
+
+    return new Promise((resolve, reject) => {
+      this.waiting.push({ resolve, reject });
+    });
+  }
+
+  return() {
+    this.ended = true;
+    this.close();
+
+    return Promise.resolve({ value: undefined, done: true });
+  }
+
+  [Symbol.asyncIterator]() {
+    return this;
+  }
+};`
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func streamData(t *testing.T) ([]*kosuzu.Packet, []byte) {
+	plain := kosuzu.NewPacket(1, []byte("reimu"))
+	empty := kosuzu.NewPacket(2, []byte{})
+	checked := kosuzu.NewPacket(3, []byte("marisa"))
+	checked.SetChecksum(true)
+	signed := kosuzu.NewPacket(4, []byte("kosuzu"))
+	signed.Sign(7, []byte("secret"))
+	signed.SetChecksum(true)
+
+	packets := []*kosuzu.Packet{plain, empty, checked, signed}
+	data := []byte{}
+
+	for _, packet := range packets {
+		raw, err := packet.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data = append(data, raw...)
+	}
+
+	return packets, data
+}
+
+func TestPacketStreamChunks(t *testing.T) {
+	expected, data := streamData(t)
+
+	for _, size := range []int{1, 2, 5, 13, 29, len(data)} {
+		stream := &packetStream{}
+		packets := []*kosuzu.Packet{}
+
+		for i := 0; i < len(data); i += size {
+			end := i + size
+
+			if end > len(data) {
+				end = len(data)
+			}
+
+			chunk, err := stream.push(data[i:end])
+
+			if err != nil {
+				t.Fatalf("chunk size %d: %v", size, err)
+			}
+
+			packets = append(packets, chunk...)
+		}
+
+		if err := stream.close(); err != nil {
+			t.Fatalf("chunk size %d: %v", size, err)
+		}
+
+		if len(packets) != len(expected) {
+			t.Fatalf("chunk size %d: expected %d packets, got %d",
+				size, len(expected), len(packets))
+		}
+
+		for i, packet := range packets {
+			if packet.Opcode != expected[i].Opcode ||
+				!bytes.Equal(packet.Payload(), expected[i].Payload()) ||
+				packet.HasSignature() != expected[i].HasSignature() {
+				t.Fatalf("chunk size %d: packet %d differs", size, i)
+			}
+		}
+	}
+}
+
+func TestPacketStreamErrors(t *testing.T) {
+	_, data := streamData(t)
+
+	stream := &packetStream{}
+	stream.push(data[:len(data)-1])
+
+	if err := stream.close(); err == nil {
+		t.Fatalf("expected error for the incomplete packet")
+	}
+
+	stream = &packetStream{maxLength: 16}
+	_, err := stream.push(data)
+
+	if err == nil {
+		t.Fatalf("expected error for the packet exceeding the limit")
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[4] = 0x80
+	stream = &packetStream{}
+	_, err = stream.push(corrupted)
+
+	if err == nil {
+		t.Fatalf("expected error for the unknown flags")
+	}
+
+	if _, next := stream.push(data); next != err {
+		t.Fatalf("expected the stream to stay failed")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// goldenVector is the vector from the
+// testdata/golden.json file of the package
+// root written by its TestGoldenVectors.
+type goldenVector struct {
+	Name   string                 `json:"name"`
+	Fields []interface{}          `json:"fields"`
+	Types  map[string]interface{} `json:"types"`
+	Value  map[string]interface{} `json:"value"`
+	Hex    string                 `json:"hex"`
+}
+
+func loadGolden(t *testing.T) []*goldenVector {
+	data, err := os.ReadFile("../testdata/golden.json")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vectors := []*goldenVector{}
+	err = json.Unmarshal(data, &vectors)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return vectors
+}
+
+// input returns the vector value with the 64-bit
+// integers, written as decimal strings, converted
+// to BigInt the way the bindings receive them.
+func (vector *goldenVector) input(t *testing.T) map[string]interface{} {
+	return goldenMessage(t, vector.Types, vector.Fields, vector.Value)
+}
+
+func goldenMessage(t *testing.T, types map[string]interface{}, fields []interface{}, value map[string]interface{}) map[string]interface{} {
+	obj := map[string]interface{}{}
+
+	for _, f := range fields {
+		f := f.(map[string]interface{})
+		name := f["name"].(string)
+		typ, err := schema.ParseType(f["type"].(string))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj[name] = goldenInput(t, types, typ, value[name])
+	}
+
+	return obj
+}
+
+func goldenInput(t *testing.T, types map[string]interface{}, typ *schema.Type, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch typ.Kind {
+	case schema.Slice, schema.Array:
+		elems := []interface{}{}
+
+		for _, elem := range value.([]interface{}) {
+			elems = append(elems, goldenInput(t, types, typ.Elem, elem))
+		}
+
+		return elems
+
+	case schema.Map:
+		obj := map[string]interface{}{}
+
+		for key, elem := range value.(map[string]interface{}) {
+			obj[key] = goldenInput(t, types, typ.Elem, elem)
+		}
+
+		return obj
+
+	case schema.Pointer:
+		return goldenInput(t, types, typ.Elem, value)
+	}
+
+	switch typ.Name {
+	case "int64", "uint64":
+		return bigInt(value.(string))
+	}
+
+	if fields, ok := types[typ.Name]; ok {
+		return goldenMessage(t, types, fields.([]interface{}),
+			value.(map[string]interface{}))
+	}
+
+	return value
+}
+
+func TestGoldenVectors(t *testing.T) {
+	for _, vector := range loadGolden(t) {
+		expected, err := hex.DecodeString(vector.Hex)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		compiled, err := compileSchema(vector.Fields, vector.Types)
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		builder := kosuzu.NewPacketBuilder()
+		err = compiled.encode(builder, vector.input(t))
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		if !bytes.Equal(builder.BuildPacket(0).Payload(), expected) {
+			t.Fatalf("%s: expected %x, got %x", vector.Name,
+				expected, builder.BuildPacket(0).Payload())
+		}
+
+		decomposer := kosuzu.NewPacketDecomposer(kosuzu.NewPacket(0, expected))
+		decoded, err := compiled.decode(decomposer)
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		err = decomposer.Done()
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		builder = kosuzu.NewPacketBuilder()
+		err = compiled.encode(builder, decoded)
+
+		if err != nil {
+			t.Fatalf("%s: %v", vector.Name, err)
+		}
+
+		if !bytes.Equal(builder.BuildPacket(0).Payload(), expected) {
+			t.Fatalf("%s: decoded value encodes as %x", vector.Name,
+				builder.BuildPacket(0).Payload())
+		}
+	}
+}
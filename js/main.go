@@ -1,351 +1,278 @@
+//go:build !wasm
+// +build !wasm
+
 package main
 
 //go:generate gopherjs build -o kosuzu.js --minify
 
 import (
-	"bytes"
-	"encoding/binary"
+	"fmt"
 
 	"github.com/gopherjs/gopherjs/js"
 	"github.com/zergon321/kosuzu"
 )
 
-func packetBytes(packet map[string]interface{}) []byte {
-	opcode := int32(packet["opcode"].(float64))
-	dataLength := int64(packet["dataLength"].(float64))
-	payload := packet["payload"].([]byte)
-
-	data := make([]byte, 4+8+dataLength)
-	buffer := bytes.NewBuffer(data)
-	buffer.Reset()
-
-	binary.Write(buffer, binary.BigEndian, opcode)
-	binary.Write(buffer, binary.BigEndian, dataLength)
-	buffer.Write(payload)
-
-	return buffer.Bytes()
-}
+// typeOf returns the result of the typeof operator.
+// It's created by main as js.Global is only
+// available in the JavaScript environment.
+var typeOf *js.Object
+
+// internalize converts the JavaScript value to the Go
+// value the same way GopherJS does but keeps BigInt
+// values which GopherJS turns into empty maps.
+func internalize(value *js.Object) interface{} {
+	switch typeOf.Invoke(value).String() {
+	case "bigint":
+		return bigInt(js.Global.Call("String", value).String())
+
+	case "object":
+		if value == nil {
+			return nil
+		}
 
-func packetFromBytes(data []byte) map[string]interface{} {
-	packet, _ := kosuzu.PacketFromBytes(data)
-	jsPacket := map[string]interface{}{
-		"opcode":     packet.Opcode,
-		"dataLength": packet.DataLength(),
-		"payload":    packet.Payload(),
+	default:
+		return value.Interface()
 	}
 
-	return jsPacket
-}
-
-func serialize(opcode int32, obj map[string]interface{}, scheme map[string]interface{}) map[string]interface{} {
-	builder := kosuzu.NewPacketBuilder()
-
-	if len(scheme) > 0 {
-		for param, value := range obj {
-			switch scheme[param] {
-			case "string":
-				builder.AddString(value.(string))
+	constructor := value.Get("constructor")
 
-			case "bool":
-				builder.AddBool(value.(bool))
+	switch {
+	case value.Get("__internal_object__") != js.Undefined:
+		return value.Interface()
 
-			case "byte":
-				builder.AddByte(byte(value.(float64)))
+	case constructor == js.Global.Get("BigInt64Array"),
+		constructor == js.Global.Get("BigUint64Array"),
+		js.Global.Get("Array").Call("isArray", value).Bool():
+		elems := make([]interface{}, value.Length())
 
-			case "rune":
-				builder.AddRune(value.(rune))
-
-			case "int8":
-				builder.AddInt8(int8(value.(float64)))
-
-			case "uint8":
-				builder.AddUint8(uint8(value.(float64)))
-
-			case "int16":
-				builder.AddInt16(int16(value.(float64)))
+		for i := range elems {
+			elems[i] = internalize(value.Index(i))
+		}
 
-			case "uint16":
-				builder.AddUint16(uint16(value.(float64)))
+		return elems
 
-			case "int32":
-				builder.AddInt32(int32(value.(float64)))
+	case value.Get("BYTES_PER_ELEMENT") != js.Undefined:
+		return value.Interface()
+	}
 
-			case "uint32":
-				builder.AddUint32(uint32(value.(float64)))
+	keys := js.Global.Get("Object").Call("keys", value)
+	obj := make(map[string]interface{}, keys.Length())
 
-			case "int64":
-				builder.AddInt64(int64(value.(float64)))
+	for i := 0; i < keys.Length(); i++ {
+		key := keys.Index(i).String()
+		obj[key] = internalize(value.Get(key))
+	}
 
-			case "uint64":
-				builder.AddUint64(uint64(value.(float64)))
+	return obj
+}
 
-			case "float32":
-				builder.AddFloat32(float32(value.(float64)))
+// externalize replaces the 64-bit integers
+// decoded from the packet with BigInt values.
+func externalize(value interface{}) interface{} {
+	switch val := value.(type) {
+	case bigInt:
+		return js.Global.Call("BigInt", string(val))
 
-			case "float64":
-				builder.AddFloat64(value.(float64))
+	case []interface{}:
+		for i, elem := range val {
+			val[i] = externalize(elem)
+		}
 
-			case "[]bool":
-				builder.AddBoolArray(value.([]bool))
+	case map[string]interface{}:
+		for key, elem := range val {
+			val[key] = externalize(elem)
+		}
+	}
 
-			case "[]byte":
-				builder.AddByteArray(value.([]byte))
+	return value
+}
 
-			case "[]rune":
-				builder.AddRuneArray(value.([]rune))
+// jsError converts the Go error to the JavaScript
+// Error. If the error occurred for a message field,
+// the field name, its byte offset in the payload and
+// the underlying error message are set as the field,
+// offset and cause properties.
+func jsError(err error) *js.Object {
+	jsErr := js.Global.Get("Error").New(err.Error())
+
+	if fieldErr, ok := err.(*fieldError); ok {
+		jsErr.Set("field", fieldErr.field)
+		jsErr.Set("offset", fieldErr.offset)
+		jsErr.Set("cause", fieldErr.cause.Error())
+	}
 
-			case "[]int8":
-				builder.AddInt8Array(value.([]int8))
+	return jsErr
+}
 
-			case "[]uint8":
-				builder.AddUint8Array(value.([]uint8))
+// throw raises the JavaScript
+// Error made out of err.
+func throw(err error) {
+	panic(jsError(err))
+}
 
-			case "[]int16":
-				builder.AddInt16Array(value.([]int16))
+// fromPacket converts the Go packet
+// to the JavaScript packet object.
+func fromPacket(packet *kosuzu.Packet) map[string]interface{} {
+	return map[string]interface{}{
+		"opcode":     packet.Opcode,
+		"dataLength": packet.DataLength(),
+		"payload":    packet.Payload(),
+	}
+}
 
-			case "[]uint16":
-				builder.AddUint16Array(value.([]uint16))
+func packetBytes(packet map[string]interface{}) []byte {
+	goPacket, err := toPacket(packet)
 
-			case "[]int32":
-				builder.AddInt32Array(value.([]int32))
+	if err != nil {
+		throw(err)
+	}
 
-			case "[]uint32":
-				builder.AddUint32Array(value.([]uint32))
+	data, err := goPacket.Bytes()
 
-			case "[]int64":
-				builder.AddInt64Array(value.([]int64))
+	if err != nil {
+		throw(err)
+	}
 
-			case "[]uint64":
-				builder.AddUint64Array(value.([]uint64))
+	return data
+}
 
-			case "[]float32":
-				builder.AddFloat32Array(value.([]float32))
+func packetFromBytes(data []byte) map[string]interface{} {
+	packet, err := kosuzu.PacketFromBytes(data)
 
-			case "[]float64":
-				builder.AddFloat64Array(value.([]float64))
-			}
-		}
-	} else {
-		for _, value := range obj {
-			switch v := value.(type) {
-			case string:
-				builder.AddString(v)
+	if err != nil {
+		throw(err)
+	}
 
-			case bool:
-				builder.AddBool(v)
+	return fromPacket(packet)
+}
 
-			case int8:
-				builder.AddInt8(v)
+// compile compiles the array of {name, type}
+// objects into the schema object which can
+// be passed to serialize and deserialize.
+// The optional types object maps the names
+// of the message types used in the fields
+// to their schemas.
+func compile(fields []interface{}, types interface{}) *js.Object {
+	compiled, err := compileSchema(fields, types)
+
+	if err != nil {
+		throw(err)
+	}
 
-			case uint8:
-				builder.AddUint8(v)
+	return js.MakeWrapper(compiled)
+}
 
-			case int16:
-				builder.AddInt16(v)
+func serialize(opcode int32, value *js.Object, scheme interface{}) map[string]interface{} {
+	compiled, err := toSchema(scheme)
 
-			case uint16:
-				builder.AddUint16(v)
+	if err != nil {
+		throw(err)
+	}
 
-			case int32:
-				builder.AddInt32(v)
+	obj, ok := internalize(value).(map[string]interface{})
 
-			case uint32:
-				builder.AddUint32(v)
+	if !ok {
+		throw(fmt.Errorf("value must be an object"))
+	}
 
-			case int64:
-				builder.AddInt64(v)
+	builder := kosuzu.NewPacketBuilder()
+	err = compiled.encode(builder, obj)
 
-			case uint64:
-				builder.AddUint64(v)
+	if err != nil {
+		throw(err)
+	}
 
-			case float32:
-				builder.AddFloat32(v)
+	return fromPacket(builder.BuildPacket(opcode))
+}
 
-			case float64:
-				builder.AddFloat64(v)
+func deserialize(scheme interface{}, packet map[string]interface{}) map[string]interface{} {
+	obj, err := decodePacket(scheme, packet)
 
-			case complex64:
-				builder.AddComplex64(v)
+	if err != nil {
+		throw(err)
+	}
 
-			case complex128:
-				builder.AddComplex128(v)
+	return externalize(obj).(map[string]interface{})
+}
 
-			case []bool:
-				builder.AddBoolArray(v)
+// tryDeserialize is the same as deserialize
+// but returns the {value, error} object
+// instead of throwing the error.
+func tryDeserialize(scheme interface{}, packet map[string]interface{}) map[string]interface{} {
+	obj, err := decodePacket(scheme, packet)
 
-			case []int8:
-				builder.AddInt8Array(v)
+	if err != nil {
+		return map[string]interface{}{
+			"value": nil,
+			"error": jsError(err),
+		}
+	}
 
-			case []uint8:
-				builder.AddUint8Array(v)
+	return map[string]interface{}{
+		"value": externalize(obj),
+		"error": nil,
+	}
+}
 
-			case []int16:
-				builder.AddInt16Array(v)
+// newSplitter creates the packet
+// splitter of the PacketStream class.
+func newSplitter(maxLength float64) map[string]interface{} {
+	stream := &packetStream{maxLength: int64(maxLength)}
 
-			case []uint16:
-				builder.AddUint16Array(v)
+	return map[string]interface{}{
+		"push": func(chunk []byte) map[string]interface{} {
+			packets, err := stream.push(chunk)
+			values := make([]interface{}, len(packets))
 
-			case []int32:
-				builder.AddInt32Array(v)
+			for i, packet := range packets {
+				values[i] = fromPacket(packet)
+			}
 
-			case []uint32:
-				builder.AddUint32Array(v)
+			res := map[string]interface{}{
+				"value": values,
+				"error": nil,
+			}
 
-			case []int64:
-				builder.AddInt64Array(v)
+			if err != nil {
+				res["error"] = jsError(err)
+			}
 
-			case []uint64:
-				builder.AddUint64Array(v)
+			return res
+		},
 
-			case []float32:
-				builder.AddFloat32Array(v)
+		"close": func() map[string]interface{} {
+			res := map[string]interface{}{
+				"value": nil,
+				"error": nil,
+			}
 
-			case []float64:
-				builder.AddFloat64Array(v)
+			if err := stream.close(); err != nil {
+				res["error"] = jsError(err)
 			}
-		}
-	}
 
-	packet := builder.BuildPacket(opcode)
-	jsPacket := map[string]interface{}{
-		"opcode":     packet.Opcode,
-		"dataLength": packet.DataLength(),
-		"payload":    packet.Payload(),
+			return res
+		},
 	}
-
-	return jsPacket
 }
 
-func deserialize(scheme map[string]interface{}, packet map[string]interface{}) map[string]interface{} {
-	goPacket := kosuzu.NewPacket(
-		int32(packet["opcode"].(float64)),
-		packet["payload"].([]byte))
-	decomposer := kosuzu.NewPacketDecomposer(goPacket)
-	obj := map[string]interface{}{}
-
-	for param, typ := range scheme {
-		if typName, ok := typ.(string); ok {
-			switch typName {
-			case "string":
-				val, _ := decomposer.ReadString()
-				obj[param] = val
-
-			case "bool":
-				val, _ := decomposer.ReadBool()
-				obj[param] = val
-
-			case "byte":
-				val, _ := decomposer.ReadByte()
-				obj[param] = val
-
-			case "rune":
-				val, _, _ := decomposer.ReadRune()
-				obj[param] = val
-
-			case "int8":
-				val, _ := decomposer.ReadInt8()
-				obj[param] = val
-
-			case "uint8":
-				val, _ := decomposer.ReadUint8()
-				obj[param] = val
-
-			case "int16":
-				val, _ := decomposer.ReadInt16()
-				obj[param] = val
-
-			case "uint16":
-				val, _ := decomposer.ReadUint16()
-				obj[param] = val
-
-			case "int32":
-				val, _ := decomposer.ReadInt32()
-				obj[param] = val
-
-			case "uint32":
-				val, _ := decomposer.ReadUint32()
-				obj[param] = val
-
-			case "int64":
-				val, _ := decomposer.ReadInt64()
-				obj[param] = val
-
-			case "uint64":
-				val, _ := decomposer.ReadUint64()
-				obj[param] = val
-
-			case "float32":
-				val, _ := decomposer.ReadFloat32()
-				obj[param] = val
-
-			case "float64":
-				val, _ := decomposer.ReadFloat64()
-				obj[param] = val
-
-			case "[]bool":
-				val, _ := decomposer.ReadBoolArray()
-				obj[param] = val
-
-			case "[]byte":
-				val, _ := decomposer.ReadByteArray()
-				obj[param] = val
-
-			case "[]rune":
-				val, _ := decomposer.ReadRuneArray()
-				obj[param] = val
-
-			case "[]int8":
-				val, _ := decomposer.ReadInt8Array()
-				obj[param] = val
-
-			case "[]uint8":
-				val, _ := decomposer.ReadUint8Array()
-				obj[param] = val
-
-			case "[]int16":
-				val, _ := decomposer.ReadInt16Array()
-				obj[param] = val
-
-			case "[]uint16":
-				val, _ := decomposer.ReadUint16Array()
-				obj[param] = val
-
-			case "[]int32":
-				val, _ := decomposer.ReadInt32Array()
-				obj[param] = val
-
-			case "[]uint32":
-				val, _ := decomposer.ReadUint32Array()
-				obj[param] = val
-
-			case "[]int64":
-				val, _ := decomposer.ReadInt64Array()
-				obj[param] = val
-
-			case "[]uint64":
-				val, _ := decomposer.ReadUint64Array()
-				obj[param] = val
-
-			case "[]float32":
-				val, _ := decomposer.ReadFloat32Array()
-				obj[param] = val
-
-			case "[]float64":
-				val, _ := decomposer.ReadFloat64Array()
-				obj[param] = val
-			}
-		}
+func init() {
+	isNull = func(value interface{}) bool {
+		obj, ok := value.(*js.Object)
+		return value == nil || ok && obj == js.Undefined
 	}
-
-	return obj
 }
 
 func main() {
+	typeOf = js.Global.Get("Function").New("value", "return typeof value;")
 	exports := map[string]interface{}{
+		"compileSchema":   compile,
 		"serialize":       serialize,
 		"deserialize":     deserialize,
+		"tryDeserialize":  tryDeserialize,
 		"packetBytes":     packetBytes,
 		"packetFromBytes": packetFromBytes,
+		"PacketStream": js.Global.Get("Function").New(
+			"newSplitter", packetStreamClass).Invoke(newSplitter),
 	}
 
 	js.Global.Set("kosuzu", exports)
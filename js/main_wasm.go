@@ -0,0 +1,498 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+// The WebAssembly build of the bindings exposes the same
+// API as the GopherJS one. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o kosuzu.wasm
+//
+// and load it with wasm_exec.js shipped with Go.
+
+import (
+	"fmt"
+	"reflect"
+	"syscall/js"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// headerLength is the length of the opcode and the
+// data length fields of the packet without flags.
+const headerLength = 12
+
+// schemaKey is the property of the JavaScript
+// object referring to the compiled schema.
+const schemaKey = "__kosuzu_schema__"
+
+var (
+	uint8Array = js.Global().Get("Uint8Array")
+	object     = js.Global().Get("Object")
+
+	// typedArrays maps the kinds of the slice
+	// elements to the JavaScript typed arrays.
+	typedArrays = map[reflect.Kind]js.Value{
+		reflect.Int8:    js.Global().Get("Int8Array"),
+		reflect.Int16:   js.Global().Get("Int16Array"),
+		reflect.Uint16:  js.Global().Get("Uint16Array"),
+		reflect.Int32:   js.Global().Get("Int32Array"),
+		reflect.Uint32:  js.Global().Get("Uint32Array"),
+		reflect.Float32: js.Global().Get("Float32Array"),
+		reflect.Float64: js.Global().Get("Float64Array"),
+	}
+
+	// typeOf returns the result of the typeof operator
+	// because js.Value.Type panics for BigInt values.
+	typeOf = js.Global().Get("Function").New("value", "return typeof value;")
+
+	// unwrap turns the Go function returning the
+	// {value, error} object into the JavaScript
+	// function throwing the error because Go
+	// functions can't throw JavaScript exceptions.
+	unwrap = js.Global().Get("Function").New("fn", `return function () {
+	const result = fn.apply(this, arguments);
+
+	if (result.error) {
+		throw result.error;
+	}
+
+	return result.value;
+};`)
+)
+
+// schemas contains the schemas compiled from JavaScript.
+// They are removed when their JavaScript objects are
+// garbage collected.
+var (
+	schemas         = map[int]*messageSchema{}
+	nextSchemaID    = 0
+	schemaFinalizer js.Value
+)
+
+// uint8ArrayWriter copies the written
+// bytes right into the Uint8Array.
+type uint8ArrayWriter struct {
+	array  js.Value
+	offset int
+}
+
+func (writer *uint8ArrayWriter) Write(data []byte) (int, error) {
+	n := js.CopyBytesToJS(writer.array.Call("subarray", writer.offset), data)
+	writer.offset += n
+
+	if n < len(data) {
+		return n, fmt.Errorf("Uint8Array is too short")
+	}
+
+	return n, nil
+}
+
+// jsError converts the Go error to the JavaScript
+// Error. If the error occurred for a message field,
+// the field name, its byte offset in the payload and
+// the underlying error message are set as the field,
+// offset and cause properties.
+func jsError(err error) js.Value {
+	jsErr := js.Global().Get("Error").New(err.Error())
+
+	if fieldErr, ok := err.(*fieldError); ok {
+		jsErr.Set("field", fieldErr.field)
+		jsErr.Set("offset", fieldErr.offset)
+		jsErr.Set("cause", fieldErr.cause.Error())
+	}
+
+	return jsErr
+}
+
+// result makes the {value, error}
+// object out of the Go function result.
+func result(value interface{}, err error) interface{} {
+	if err != nil {
+		return map[string]interface{}{
+			"value": nil,
+			"error": jsError(err),
+		}
+	}
+
+	return map[string]interface{}{
+		"value": value,
+		"error": nil,
+	}
+}
+
+// toGo converts the JavaScript value to the Go
+// value of the same kind the GopherJS build
+// receives. Uint8Array is copied to the
+// Go memory at once.
+func toGo(value js.Value) interface{} {
+	switch typeOf.Invoke(value).String() {
+	case "boolean":
+		return value.Bool()
+
+	case "number":
+		return value.Float()
+
+	case "string":
+		return value.String()
+
+	case "bigint":
+		return bigInt(js.Global().Call("String", value).String())
+
+	case "object":
+		if value.IsNull() {
+			return nil
+		}
+
+	default:
+		return nil
+	}
+
+	if value.InstanceOf(uint8Array) {
+		data := make([]byte, value.Length())
+		js.CopyBytesToGo(data, value)
+
+		return data
+	}
+
+	if id := value.Get(schemaKey); id.Type() == js.TypeNumber {
+		return schemas[id.Int()]
+	}
+
+	// Typed arrays are the only views having the element size.
+	if !value.Get("BYTES_PER_ELEMENT").IsUndefined() ||
+		js.Global().Get("Array").Call("isArray", value).Bool() {
+		elems := make([]interface{}, value.Length())
+
+		for i := range elems {
+			elems[i] = toGo(value.Index(i))
+		}
+
+		return elems
+	}
+
+	keys := object.Call("keys", value)
+	obj := make(map[string]interface{}, keys.Length())
+
+	for i := 0; i < keys.Length(); i++ {
+		key := keys.Index(i).String()
+		obj[key] = toGo(value.Get(key))
+	}
+
+	return obj
+}
+
+// toJS converts the Go value decoded from the
+// packet to the JavaScript value. Slices of
+// the primitive types become typed arrays.
+func toJS(value interface{}) js.Value {
+	switch val := value.(type) {
+	case nil:
+		return js.Null()
+
+	case bigInt:
+		return js.Global().Call("BigInt", string(val))
+
+	case []byte:
+		array := uint8Array.New(len(val))
+		js.CopyBytesToJS(array, val)
+
+		return array
+
+	case []interface{}:
+		array := js.Global().Get("Array").New(len(val))
+
+		for i, elem := range val {
+			array.SetIndex(i, toJS(elem))
+		}
+
+		return array
+
+	case map[string]interface{}:
+		obj := object.New()
+
+		for key, elem := range val {
+			obj.Set(key, toJS(elem))
+		}
+
+		return obj
+	}
+
+	elems := reflect.ValueOf(value)
+
+	if elems.Kind() != reflect.Slice {
+		return js.ValueOf(value)
+	}
+
+	array := js.Global().Get("Array").New(elems.Len())
+
+	if typedArray, ok := typedArrays[elems.Type().Elem().Kind()]; ok {
+		array = typedArray.New(elems.Len())
+	}
+
+	for i := 0; i < elems.Len(); i++ {
+		array.SetIndex(i, toJS(elems.Index(i).Interface()))
+	}
+
+	return array
+}
+
+// toPacketObject converts the JavaScript value
+// to the packet object understood by toPacket.
+func toPacketObject(value js.Value) (map[string]interface{}, error) {
+	packet, ok := toGo(value).(map[string]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("packet must be an object")
+	}
+
+	return packet, nil
+}
+
+// fromPacket writes the packet without flags
+// to the new Uint8Array and returns the array
+// along with the JavaScript packet object
+// whose payload is the view on the array.
+func fromPacket(packet *kosuzu.Packet) (js.Value, js.Value, error) {
+	data := uint8Array.New(headerLength + int(packet.DataLength()))
+	_, err := packet.WriteTo(&uint8ArrayWriter{array: data})
+
+	if err != nil {
+		return js.Undefined(), js.Undefined(), err
+	}
+
+	obj := object.New()
+	obj.Set("opcode", packet.Opcode)
+	obj.Set("dataLength", packet.DataLength())
+	obj.Set("payload", data.Call("subarray", headerLength))
+
+	return data, obj, nil
+}
+
+// packetObject converts the packet read from
+// the stream to the JavaScript packet object.
+func packetObject(packet *kosuzu.Packet) js.Value {
+	payload := uint8Array.New(int(packet.DataLength()))
+	js.CopyBytesToJS(payload, packet.Payload())
+
+	obj := object.New()
+	obj.Set("opcode", packet.Opcode)
+	obj.Set("dataLength", packet.DataLength())
+	obj.Set("payload", payload)
+
+	return obj
+}
+
+// newSplitter creates the packet splitter of
+// the PacketStream class. Its functions are
+// released when the stream is closed.
+func newSplitter(this js.Value, args []js.Value) interface{} {
+	stream := &packetStream{maxLength: int64(arg(args, 0).Float())}
+	var push, close js.Func
+
+	push = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		res := map[string]interface{}{
+			"value": []interface{}{},
+			"error": nil,
+		}
+
+		chunk, ok := toGo(arg(args, 0)).([]byte)
+
+		if !ok {
+			res["error"] = jsError(fmt.Errorf("chunk must be a Uint8Array"))
+			return res
+		}
+
+		packets, err := stream.push(chunk)
+		values := make([]interface{}, len(packets))
+
+		for i, packet := range packets {
+			values[i] = packetObject(packet)
+		}
+
+		res["value"] = values
+
+		if err != nil {
+			res["error"] = jsError(err)
+		}
+
+		return res
+	})
+
+	close = js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		push.Release()
+		close.Release()
+
+		return result(nil, stream.close())
+	})
+
+	obj := object.New()
+	obj.Set("push", push)
+	obj.Set("close", close)
+
+	return obj
+}
+
+// compile compiles the array of {name, type}
+// objects into the schema object which can
+// be passed to serialize and deserialize.
+// The optional types object maps the names
+// of the message types used in the fields
+// to their schemas.
+func compile(this js.Value, args []js.Value) interface{} {
+	fields, ok := toGo(arg(args, 0)).([]interface{})
+
+	if !ok {
+		return result(nil, fmt.Errorf(
+			"schema must be an array of {name, type} objects"))
+	}
+
+	compiled, err := compileSchema(fields, toGo(arg(args, 1)))
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	id := nextSchemaID
+	nextSchemaID++
+	schemas[id] = compiled
+
+	obj := object.New()
+	obj.Set(schemaKey, id)
+	schemaFinalizer.Call("register", obj, id)
+
+	return result(object.Call("freeze", obj), nil)
+}
+
+func serialize(this js.Value, args []js.Value) interface{} {
+	obj, ok := toGo(arg(args, 1)).(map[string]interface{})
+
+	if !ok {
+		return result(nil, fmt.Errorf("value must be an object"))
+	}
+
+	compiled, err := toSchema(toGo(arg(args, 2)))
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	builder := kosuzu.NewPacketBuilder()
+	err = compiled.encode(builder, obj)
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	_, packet, err := fromPacket(builder.BuildPacket(int32(arg(args, 0).Int())))
+
+	return result(packet, err)
+}
+
+func packetBytes(this js.Value, args []js.Value) interface{} {
+	obj, err := toPacketObject(arg(args, 0))
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	packet, err := toPacket(obj)
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	data, _, err := fromPacket(packet)
+
+	return result(data, err)
+}
+
+// packetFromBytes parses the packet and
+// copies its payload out of the data
+// without passing it through Go.
+func packetFromBytes(this js.Value, args []js.Value) interface{} {
+	data, ok := toGo(arg(args, 0)).([]byte)
+
+	if !ok {
+		return result(nil, fmt.Errorf("data must be a Uint8Array"))
+	}
+
+	packet, err := kosuzu.PacketFromBytes(data)
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	offset := headerLength
+
+	if packet.HasSignature() {
+		offset += 4
+	}
+
+	obj := object.New()
+	obj.Set("opcode", packet.Opcode)
+	obj.Set("dataLength", packet.DataLength())
+	obj.Set("payload", args[0].Call("slice", offset,
+		offset+int(packet.DataLength())))
+
+	return result(obj, nil)
+}
+
+// tryDeserialize is the same as deserialize
+// but returns the {value, error} object
+// instead of throwing the error.
+func tryDeserialize(this js.Value, args []js.Value) interface{} {
+	packet, err := toPacketObject(arg(args, 1))
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	obj, err := decodePacket(toGo(arg(args, 0)), packet)
+
+	if err != nil {
+		return result(nil, err)
+	}
+
+	return result(toJS(obj), nil)
+}
+
+// arg returns the argument at the index
+// or undefined if it wasn't passed.
+func arg(args []js.Value, index int) js.Value {
+	if index >= len(args) {
+		return js.Undefined()
+	}
+
+	return args[index]
+}
+
+// register sets the kosuzu global object.
+func register() {
+	schemaFinalizer = js.Global().Get("FinalizationRegistry").New(
+		js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			delete(schemas, args[0].Int())
+			return nil
+		}))
+
+	exports := map[string]interface{}{
+		"compileSchema":   unwrap.Invoke(js.FuncOf(compile)),
+		"serialize":       unwrap.Invoke(js.FuncOf(serialize)),
+		"deserialize":     unwrap.Invoke(js.FuncOf(tryDeserialize)),
+		"tryDeserialize":  js.FuncOf(tryDeserialize),
+		"packetBytes":     unwrap.Invoke(js.FuncOf(packetBytes)),
+		"packetFromBytes": unwrap.Invoke(js.FuncOf(packetFromBytes)),
+		"PacketStream": js.Global().Get("Function").New(
+			"newSplitter", packetStreamClass).Invoke(js.FuncOf(newSplitter)),
+	}
+
+	js.Global().Set("kosuzu", exports)
+}
+
+func main() {
+	register()
+
+	// The functions exported to JavaScript
+	// only work while the program is running.
+	select {}
+}
@@ -0,0 +1,312 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"syscall/js"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type point struct {
+	X int32
+	Y float64
+}
+
+type route struct {
+	Name   string
+	Points []point
+	Ids    []uint16
+	Data   []byte
+	Best   *point
+}
+
+func (r *route) jsValue() js.Value {
+	points := make([]interface{}, len(r.Points))
+
+	for i, p := range r.Points {
+		points[i] = map[string]interface{}{"X": p.X, "Y": p.Y}
+	}
+
+	ids := js.Global().Get("Uint16Array").New(len(r.Ids))
+
+	for i, id := range r.Ids {
+		ids.SetIndex(i, id)
+	}
+
+	data := uint8Array.New(len(r.Data))
+	js.CopyBytesToJS(data, r.Data)
+
+	return js.ValueOf(map[string]interface{}{
+		"Name":   r.Name,
+		"Points": points,
+		"Ids":    ids,
+		"Data":   data,
+		"Best":   map[string]interface{}{"X": r.Best.X, "Y": r.Best.Y},
+	})
+}
+
+func jsBytes(value js.Value) []byte {
+	data := make([]byte, value.Length())
+	js.CopyBytesToGo(data, value)
+
+	return data
+}
+
+func compileRoute(bindings js.Value) js.Value {
+	point := js.ValueOf([]interface{}{
+		map[string]interface{}{"name": "X", "type": "int32"},
+		map[string]interface{}{"name": "Y", "type": "float64"},
+	})
+
+	return bindings.Call("compileSchema", []interface{}{
+		map[string]interface{}{"name": "Name", "type": "string"},
+		map[string]interface{}{"name": "Points", "type": "[]Point"},
+		map[string]interface{}{"name": "Ids", "type": "[]uint16"},
+		map[string]interface{}{"name": "Data", "type": "[]byte"},
+		map[string]interface{}{"name": "Best", "type": "*Point"},
+	}, map[string]interface{}{"Point": point})
+}
+
+func TestWasmRoundTrip(t *testing.T) {
+	register()
+	bindings := js.Global().Get("kosuzu")
+	compiled := compileRoute(bindings)
+
+	r := &route{
+		Name:   "home",
+		Points: []point{{1, 2.5}, {-3, 4}},
+		Ids:    []uint16{7, 8, 9},
+		Data:   []byte{0xde, 0xad},
+		Best:   &point{5, 6},
+	}
+
+	expected, err := kosuzu.Serialize(42, r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := bindings.Call("serialize", 42, r.jsValue(), compiled)
+
+	if packet.Get("opcode").Int() != 42 {
+		t.Fatalf("expected opcode 42, got %d", packet.Get("opcode").Int())
+	}
+
+	if !bytes.Equal(jsBytes(packet.Get("payload")), expected.Payload()) {
+		t.Fatalf("payload differs from the Go codec")
+	}
+
+	data := bindings.Call("packetBytes", packet)
+	expectedData, err := expected.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(jsBytes(data), expectedData) {
+		t.Fatalf("packet bytes differ from the Go codec")
+	}
+
+	parsed := bindings.Call("packetFromBytes", data)
+	obj := bindings.Call("deserialize", compiled, parsed)
+
+	if obj.Get("Name").String() != "home" ||
+		obj.Get("Points").Index(1).Get("X").Int() != -3 ||
+		obj.Get("Points").Index(0).Get("Y").Float() != 2.5 ||
+		obj.Get("Best").Get("Y").Float() != 6 {
+		t.Fatalf("unexpected object deserialized")
+	}
+
+	if !obj.Get("Ids").InstanceOf(js.Global().Get("Uint16Array")) ||
+		obj.Get("Ids").Index(2).Int() != 9 {
+		t.Fatalf("expected Uint16Array [7, 8, 9]")
+	}
+
+	if !bytes.Equal(jsBytes(obj.Get("Data")), r.Data) {
+		t.Fatalf("unexpected Data deserialized")
+	}
+}
+
+func TestWasmErrors(t *testing.T) {
+	register()
+	bindings := js.Global().Get("kosuzu")
+	compiled := compileRoute(bindings)
+
+	truncated := js.ValueOf(map[string]interface{}{
+		"opcode":     1,
+		"dataLength": 2,
+		"payload":    uint8Array.New(2),
+	})
+
+	res := bindings.Call("tryDeserialize", compiled, truncated)
+
+	if res.Get("error").IsNull() {
+		t.Fatalf("expected error for the truncated payload")
+	}
+
+	if res.Get("error").Get("field").String() != "Name" {
+		t.Fatalf("expected error for the Name field, got %s",
+			res.Get("error").Get("field").String())
+	}
+
+	defer func() {
+		if _, ok := recover().(js.Error); !ok {
+			t.Fatalf("expected JavaScript exception")
+		}
+	}()
+
+	bindings.Call("deserialize", compiled, truncated)
+}
+
+func TestWasmWideTypes(t *testing.T) {
+	register()
+	bindings := js.Global().Get("kosuzu")
+	compiled := bindings.Call("compileSchema", []interface{}{
+		map[string]interface{}{"name": "N", "type": "int64"},
+		map[string]interface{}{"name": "C", "type": "complex128"},
+		map[string]interface{}{"name": "R", "type": "rune"},
+		map[string]interface{}{"name": "Ns", "type": "[]uint64"},
+	}, js.Undefined())
+
+	ns := js.Global().Get("BigUint64Array").New(1)
+	ns.SetIndex(0, js.Global().Call("BigInt", "18446744073709551615"))
+
+	obj := js.ValueOf(map[string]interface{}{
+		"N":  js.Global().Call("BigInt", "-9007199254740993"),
+		"C":  map[string]interface{}{"re": 1.5, "im": -2},
+		"R":  "ё",
+		"Ns": ns,
+	})
+
+	expected, err := kosuzu.Serialize(3, &struct {
+		N  int64
+		C  complex128
+		R  rune
+		Ns []uint64
+	}{-9007199254740993, 1.5 - 2i, 'ё', []uint64{18446744073709551615}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := bindings.Call("serialize", 3, obj, compiled)
+
+	if !bytes.Equal(jsBytes(packet.Get("payload")), expected.Payload()) {
+		t.Fatalf("payload differs from the Go codec")
+	}
+
+	decoded := bindings.Call("deserialize", compiled, packet)
+
+	if typeOf.Invoke(decoded.Get("N")).String() != "bigint" ||
+		js.Global().Call("String", decoded.Get("N")).String() != "-9007199254740993" {
+		t.Fatalf("expected BigInt -9007199254740993")
+	}
+
+	if js.Global().Call("String", decoded.Get("Ns").Index(0)).String() != "18446744073709551615" {
+		t.Fatalf("expected BigInt 18446744073709551615")
+	}
+
+	if decoded.Get("C").Get("im").Float() != -2 || decoded.Get("R").Int() != 'ё' {
+		t.Fatalf("unexpected complex or rune deserialized")
+	}
+}
+
+func TestWasmPacketStream(t *testing.T) {
+	register()
+	bindings := js.Global().Get("kosuzu")
+	expected, data := streamData(t)
+
+	opcodes := []int{}
+	onPacket := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		opcodes = append(opcodes, args[0].Get("opcode").Int())
+		return nil
+	})
+	defer onPacket.Release()
+
+	stream := bindings.Get("PacketStream").New(onPacket)
+
+	for i := 0; i < len(data); i += 3 {
+		end := i + 3
+
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := uint8Array.New(end - i)
+		js.CopyBytesToJS(chunk, data[i:end])
+		stream.Call("push", chunk.Get("buffer"))
+	}
+
+	stream.Call("end")
+
+	if len(opcodes) != len(expected) {
+		t.Fatalf("expected %d packets, got %d", len(expected), len(opcodes))
+	}
+
+	// Without the callback, the packets are consumed
+	// with the async iterator which is the stream itself.
+	stream = bindings.Get("PacketStream").New()
+	next := make(chan js.Value, 1)
+	then := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		next <- args[0]
+		return nil
+	})
+	defer then.Release()
+
+	chunk := uint8Array.New(len(data))
+	js.CopyBytesToJS(chunk, data)
+	stream.Call("push", chunk)
+	stream.Call("end")
+
+	for _, packet := range expected {
+		stream.Call("next").Call("then", then)
+		res := <-next
+
+		if res.Get("done").Bool() {
+			t.Fatalf("expected packet %d", packet.Opcode)
+		}
+
+		if res.Get("value").Get("opcode").Int() != int(packet.Opcode) ||
+			!bytes.Equal(jsBytes(res.Get("value").Get("payload")), packet.Payload()) {
+			t.Fatalf("packet %d differs", packet.Opcode)
+		}
+	}
+
+	stream.Call("next").Call("then", then)
+
+	if res := <-next; !res.Get("done").Bool() {
+		t.Fatalf("expected the iterator to be done")
+	}
+}
+
+func TestWasmGoldenVectors(t *testing.T) {
+	register()
+	bindings := js.Global().Get("kosuzu")
+
+	for _, vector := range loadGolden(t) {
+		types := js.Undefined()
+
+		if vector.Types != nil {
+			types = js.ValueOf(vector.Types)
+		}
+
+		compiled := bindings.Call("compileSchema", js.ValueOf(vector.Fields), types)
+		packet := bindings.Call("serialize", 0, toJS(vector.input(t)), compiled)
+
+		if payload := hex.EncodeToString(jsBytes(packet.Get("payload"))); payload != vector.Hex {
+			t.Fatalf("%s: expected %s, got %s", vector.Name, vector.Hex, payload)
+		}
+
+		decoded := bindings.Call("deserialize", compiled, packet)
+		packet = bindings.Call("serialize", 0, decoded, compiled)
+
+		if payload := hex.EncodeToString(jsBytes(packet.Get("payload"))); payload != vector.Hex {
+			t.Fatalf("%s: decoded value serializes as %s", vector.Name, payload)
+		}
+	}
+}
@@ -0,0 +1,986 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/zergon321/kosuzu"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// jsTypes contains the names of the primitive
+// types supported in the JS schema along with
+// the number of bytes they take in the packet
+// (strings take 4 bytes of length plus the contents).
+var jsTypes = map[string]int{
+	"string":     4,
+	"bool":       1,
+	"byte":       1,
+	"rune":       4,
+	"int8":       1,
+	"uint8":      1,
+	"int16":      2,
+	"uint16":     2,
+	"int32":      4,
+	"uint32":     4,
+	"int64":      8,
+	"uint64":     8,
+	"float32":    4,
+	"float64":    8,
+	"complex64":  8,
+	"complex128": 16,
+}
+
+// integerRanges are the bounds of the integer
+// types passed as JS numbers. The values beyond
+// them are rejected instead of being truncated.
+var integerRanges = map[string][2]float64{
+	"byte":   {0, math.MaxUint8},
+	"rune":   {math.MinInt32, math.MaxInt32},
+	"int8":   {math.MinInt8, math.MaxInt8},
+	"uint8":  {0, math.MaxUint8},
+	"int16":  {math.MinInt16, math.MaxInt16},
+	"uint16": {0, math.MaxUint16},
+	"int32":  {math.MinInt32, math.MaxInt32},
+	"uint32": {0, math.MaxUint32},
+}
+
+// maxSafeInteger is the largest integer
+// JavaScript numbers represent exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// bigInt is the JavaScript BigInt passed as its
+// decimal digits because neither GopherJS nor
+// syscall/js convert it to a Go value. 64-bit
+// integers are also decoded as bigInt.
+type bigInt string
+
+// isNull returns true if the value passed
+// from JavaScript is null or undefined.
+// The platform glue replaces it to detect
+// undefined values of its own kind.
+var isNull = func(value interface{}) bool {
+	return value == nil
+}
+
+// fieldError describes the field which
+// couldn't be serialized or deserialized.
+type fieldError struct {
+	field  string
+	offset int
+	cause  error
+}
+
+// Error returns the description of the error.
+func (err *fieldError) Error() string {
+	return fmt.Sprintf("field %s at offset %d: %v",
+		err.field, err.offset, err.cause)
+}
+
+// Unwrap returns the cause of the error.
+func (err *fieldError) Unwrap() error {
+	return err.cause
+}
+
+// field is a message field
+// described in the JS schema.
+type field struct {
+	name string
+	typ  *schema.Type
+}
+
+// messageSchema is the compiled JS schema
+// listing the message fields in the wire
+// order, the same as the Go struct fields
+// are written by kosuzu.Serialize.
+type messageSchema struct {
+	fields []field
+	// types contains the message
+	// types the fields can refer to.
+	types map[string]*messageSchema
+	// wire and message describe the schema
+	// for the kosuzu schema decoder.
+	wire    *schema.Schema
+	message *schema.Message
+}
+
+// compileSchema parses the array of {name, type}
+// objects into the message schema. Field types are
+// written in Go syntax and may refer to the message
+// types described in the types object, which maps
+// type names to arrays of {name, type} objects
+// or compiled schemas. A field with the optional
+// property set to true is the same as the field
+// of the pointer type.
+func compileSchema(fields []interface{}, types interface{}) (*messageSchema, error) {
+	registry := map[string]*messageSchema{}
+	pending := map[string][]interface{}{}
+	names := []string{}
+
+	if !isNull(types) {
+		defs, ok := types.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf(
+				"schema types must be an object mapping names to schemas")
+		}
+
+		for name, def := range defs {
+			typ, err := schema.ParseType(name)
+
+			if err != nil || typ.Kind != schema.Named {
+				return nil, fmt.Errorf("invalid type name: %q", name)
+			}
+
+			if _, ok := jsTypes[name]; ok {
+				return nil, fmt.Errorf("type name is reserved: %s", name)
+			}
+
+			switch d := def.(type) {
+			case *messageSchema:
+				registry[name] = d
+
+			case []interface{}:
+				registry[name] = &messageSchema{types: registry}
+				pending[name] = d
+				names = append(names, name)
+
+			default:
+				return nil, fmt.Errorf(
+					"type %s must be an array of {name, type} objects or a compiled schema",
+					name)
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		compiled, err := compileFields(pending[name], registry)
+
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+
+		registry[name].fields = compiled
+	}
+
+	compiled, err := compileFields(fields, registry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root := &messageSchema{
+		fields: compiled,
+		types:  registry,
+	}
+
+	err = root.checkRecursion(map[*messageSchema]bool{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		err = registry[name].checkRecursion(map[*messageSchema]bool{})
+
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+	}
+
+	root.wire, root.message = root.wireSchema()
+
+	return root, nil
+}
+
+func compileFields(fields []interface{}, types map[string]*messageSchema) ([]field, error) {
+	compiled := make([]field, 0, len(fields))
+	names := map[string]bool{}
+
+	for i, item := range fields {
+		desc, ok := item.(map[string]interface{})
+
+		if !ok {
+			return nil, fmt.Errorf(
+				"schema field %d must be a {name, type} object", i)
+		}
+
+		name, ok := desc["name"].(string)
+
+		if !ok || name == "" {
+			return nil, fmt.Errorf(
+				"schema field %d has no name", i)
+		}
+
+		if names[name] {
+			return nil, fmt.Errorf(
+				"duplicate schema field: %s", name)
+		}
+
+		names[name] = true
+		typName, ok := desc["type"].(string)
+
+		if !ok {
+			return nil, fmt.Errorf(
+				"schema field %s has no type", name)
+		}
+
+		typ, err := schema.ParseType(typName)
+
+		if err != nil {
+			return nil, fmt.Errorf("schema field %s: %w", name, err)
+		}
+
+		if optional, _ := desc["optional"].(bool); optional {
+			typ = &schema.Type{Kind: schema.Pointer, Elem: typ}
+		}
+
+		err = checkType(typ, types)
+
+		if err != nil {
+			return nil, fmt.Errorf("schema field %s: %w", name, err)
+		}
+
+		compiled = append(compiled, field{
+			name: name,
+			typ:  typ,
+		})
+	}
+
+	return compiled, nil
+}
+
+// checkType returns an error if the values
+// of the type can't be serialized from JS.
+func checkType(typ *schema.Type, types map[string]*messageSchema) error {
+	switch typ.Kind {
+	case schema.Slice, schema.Array, schema.Pointer:
+		return checkType(typ.Elem, types)
+
+	case schema.Map:
+		// The keys are sorted like Go sorts them,
+		// so complex numbers can't be keys.
+		if typ.Key.Kind != schema.Named || !new(schema.Schema).IsOrdered(typ.Key.Name) {
+			return fmt.Errorf("map key type is not supported: %s", typ.Key)
+		}
+
+		return checkType(typ.Elem, types)
+
+	default:
+		if _, ok := jsTypes[typ.Name]; ok {
+			return nil
+		}
+
+		if _, ok := types[typ.Name]; ok {
+			return nil
+		}
+
+		return fmt.Errorf("unknown type: %s", typ)
+	}
+}
+
+// checkRecursion returns an error if the message
+// contains itself without a slice, map or pointer
+// in between, so it would take infinite space.
+func (compiled *messageSchema) checkRecursion(visiting map[*messageSchema]bool) error {
+	if visiting[compiled] {
+		return fmt.Errorf("message type contains itself")
+	}
+
+	visiting[compiled] = true
+
+	for _, field := range compiled.fields {
+		typ := field.typ
+
+		for typ.Kind == schema.Array {
+			typ = typ.Elem
+		}
+
+		if nested, ok := compiled.types[typ.Name]; typ.Kind == schema.Named && ok {
+			err := nested.checkRecursion(visiting)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(visiting, compiled)
+
+	return nil
+}
+
+// encoder writes the values described by the JS
+// schema keeping track of the current offset.
+type encoder struct {
+	builder *kosuzu.Builder
+	offset  int
+}
+
+// encode writes the object fields
+// to the builder in the schema order.
+func (compiled *messageSchema) encode(builder *kosuzu.Builder, obj map[string]interface{}) error {
+	enc := &encoder{builder: builder}
+
+	return enc.writeMessage(compiled, obj, "")
+}
+
+func (enc *encoder) writeMessage(compiled *messageSchema, obj map[string]interface{}, path string) error {
+	for _, field := range compiled.fields {
+		fieldPath := field.name
+
+		if path != "" {
+			fieldPath = path + "." + field.name
+		}
+
+		value, ok := obj[field.name]
+
+		if !ok && field.typ.Kind != schema.Pointer {
+			return &fieldError{
+				field:  fieldPath,
+				offset: enc.offset,
+				cause:  fmt.Errorf("missing field"),
+			}
+		}
+
+		err := enc.write(compiled.types, field.typ, value, fieldPath)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write writes the JS value to the builder.
+// Slices are written element by element after
+// their length, which produces the same bytes
+// as the Builder array methods.
+func (enc *encoder) write(types map[string]*messageSchema, typ *schema.Type, value interface{}, path string) error {
+	fail := func(err error) error {
+		return &fieldError{
+			field:  path,
+			offset: enc.offset,
+			cause:  err,
+		}
+	}
+
+	switch typ.Kind {
+	case schema.Slice, schema.Array:
+		if isNull(value) && typ.Kind == schema.Slice {
+			value = []interface{}{}
+		}
+
+		// Strings can be passed for the slices of runes.
+		if str, ok := value.(string); ok && typ.Elem.Name == "rune" {
+			value = []rune(str)
+		}
+
+		elems := reflect.ValueOf(value)
+
+		if elems.Kind() != reflect.Slice {
+			return fail(fmt.Errorf("expected array, got %T", value))
+		}
+
+		if typ.Kind == schema.Array && elems.Len() != typ.Len {
+			return fail(fmt.Errorf("expected %d elements, got %d",
+				typ.Len, elems.Len()))
+		}
+
+		if typ.Kind == schema.Slice {
+			err := enc.builder.AddInt32(int32(elems.Len()))
+
+			if err != nil {
+				return fail(err)
+			}
+
+			enc.offset += 4
+		}
+
+		for i := 0; i < elems.Len(); i++ {
+			err := enc.write(types, typ.Elem, elems.Index(i).Interface(),
+				fmt.Sprintf("%s[%d]", path, i))
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case schema.Map:
+		obj, ok := value.(map[string]interface{})
+
+		if isNull(value) {
+			obj, ok = map[string]interface{}{}, true
+		}
+
+		if !ok {
+			return fail(fmt.Errorf("expected object, got %T", value))
+		}
+
+		keys, err := sortKeys(typ.Key.Name, obj)
+
+		if err != nil {
+			return fail(err)
+		}
+
+		err = enc.builder.AddInt32(int32(len(keys)))
+
+		if err != nil {
+			return fail(err)
+		}
+
+		enc.offset += 4
+
+		for _, key := range keys {
+			keyPath := fmt.Sprintf("%s[%s]", path, key.str)
+			err = enc.write(types, typ.Key, key.value, keyPath)
+
+			if err != nil {
+				return err
+			}
+
+			err = enc.write(types, typ.Elem, obj[key.str], keyPath)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case schema.Pointer:
+		present := !isNull(value)
+		err := enc.builder.AddBool(present)
+
+		if err != nil {
+			return fail(err)
+		}
+
+		enc.offset++
+
+		if !present {
+			return nil
+		}
+
+		return enc.write(types, typ.Elem, value, path)
+	}
+
+	if nested, ok := types[typ.Name]; ok {
+		obj, ok := value.(map[string]interface{})
+
+		if !ok {
+			return fail(fmt.Errorf("expected object, got %T", value))
+		}
+
+		return enc.writeMessage(nested, obj, path)
+	}
+
+	size, err := writePrimitive(enc.builder, typ.Name, value)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	enc.offset += size
+
+	return nil
+}
+
+// writePrimitive writes the JS value of the primitive
+// type to the builder and returns its size in bytes.
+func writePrimitive(builder *kosuzu.Builder, name string, value interface{}) (int, error) {
+	switch name {
+	case "string":
+		str, ok := value.(string)
+
+		if !ok {
+			return 0, fmt.Errorf("expected string, got %T", value)
+		}
+
+		return 4 + len(str), builder.AddString(str)
+
+	case "bool":
+		val, ok := value.(bool)
+
+		if !ok {
+			return 0, fmt.Errorf("expected bool, got %T", value)
+		}
+
+		return 1, builder.AddBool(val)
+
+	case "rune":
+		str, ok := value.(string)
+
+		if !ok {
+			break
+		}
+
+		r, size := utf8.DecodeRuneInString(str)
+
+		// U+FFFD itself decodes to three bytes,
+		// invalid UTF-8 decodes to one or none.
+		if (r == utf8.RuneError && size <= 1) || size != len(str) {
+			return 0, fmt.Errorf("expected single character, got %q", str)
+		}
+
+		return 4, builder.AddRune(r)
+
+	case "int64":
+		digits, err := toDigits(value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		val, err := strconv.ParseInt(digits, 10, 64)
+
+		if err != nil {
+			return 0, fmt.Errorf("int64 out of range: %s", digits)
+		}
+
+		return 8, builder.AddInt64(val)
+
+	case "uint64":
+		digits, err := toDigits(value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		val, err := strconv.ParseUint(digits, 10, 64)
+
+		if err != nil {
+			return 0, fmt.Errorf("uint64 out of range: %s", digits)
+		}
+
+		return 8, builder.AddUint64(val)
+
+	case "complex64":
+		val, err := toComplex(value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		return 8, builder.AddComplex64(complex64(val))
+
+	case "complex128":
+		val, err := toComplex(value)
+
+		if err != nil {
+			return 0, err
+		}
+
+		return 16, builder.AddComplex128(val)
+	}
+
+	num, err := toNumber(value)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if bounds, ok := integerRanges[name]; ok {
+		if num != math.Trunc(num) {
+			return 0, fmt.Errorf("%s is not an integer: %v", name, num)
+		}
+
+		if num < bounds[0] || num > bounds[1] {
+			return 0, fmt.Errorf("%s out of range: %v", name, num)
+		}
+	}
+
+	size := jsTypes[name]
+
+	switch name {
+	case "byte":
+		return size, builder.AddByte(byte(num))
+
+	case "rune":
+		return size, builder.AddRune(rune(num))
+
+	case "int8":
+		return size, builder.AddInt8(int8(num))
+
+	case "uint8":
+		return size, builder.AddUint8(uint8(num))
+
+	case "int16":
+		return size, builder.AddInt16(int16(num))
+
+	case "uint16":
+		return size, builder.AddUint16(uint16(num))
+
+	case "int32":
+		return size, builder.AddInt32(int32(num))
+
+	case "uint32":
+		return size, builder.AddUint32(uint32(num))
+
+	case "float32":
+		return size, builder.AddFloat32(float32(num))
+
+	case "float64":
+		return size, builder.AddFloat64(num)
+	}
+
+	return 0, fmt.Errorf("type is not supported: %s", name)
+}
+
+// toNumber converts the JS number, BigInt
+// or any Go number to float64.
+func toNumber(value interface{}) (float64, error) {
+	if digits, ok := value.(bigInt); ok {
+		return strconv.ParseFloat(string(digits), 64)
+	}
+
+	val := reflect.ValueOf(value)
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return float64(val.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint()), nil
+
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), nil
+
+	default:
+		return 0, fmt.Errorf("expected number, got %T", value)
+	}
+}
+
+// toDigits returns the decimal digits of the
+// BigInt or the integer number. Numbers beyond
+// 2^53 are rejected as they might have already
+// lost precision.
+func toDigits(value interface{}) (string, error) {
+	if digits, ok := value.(bigInt); ok {
+		return string(digits), nil
+	}
+
+	val := reflect.ValueOf(value)
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(val.Uint(), 10), nil
+	}
+
+	num, err := toNumber(value)
+
+	if err != nil {
+		return "", err
+	}
+
+	if num != math.Trunc(num) || math.Abs(num) > maxSafeInteger {
+		return "", fmt.Errorf("%v is not a safe integer, use BigInt", num)
+	}
+
+	return strconv.FormatFloat(num, 'f', -1, 64), nil
+}
+
+// toComplex converts the JS {re, im}
+// object to the complex number.
+func toComplex(value interface{}) (complex128, error) {
+	obj, ok := value.(map[string]interface{})
+
+	if !ok {
+		return 0, fmt.Errorf("expected {re, im} object, got %T", value)
+	}
+
+	re, err := toNumber(obj["re"])
+
+	if err != nil {
+		return 0, fmt.Errorf("re: %w", err)
+	}
+
+	im, err := toNumber(obj["im"])
+
+	if err != nil {
+		return 0, fmt.Errorf("im: %w", err)
+	}
+
+	return complex(re, im), nil
+}
+
+// mapKey is the key of the JS object
+// converted to the map key type.
+type mapKey struct {
+	str   string
+	value interface{}
+	order float64
+}
+
+// sortKeys converts the keys of the JS object to the
+// map key type and sorts them the same way as the Go
+// serializer does, so the maps are written identically.
+func sortKeys(keyType string, obj map[string]interface{}) ([]mapKey, error) {
+	keys := make([]mapKey, 0, len(obj))
+
+	for str := range obj {
+		key := mapKey{str: str, value: str}
+
+		switch keyType {
+		case "string":
+
+		case "bool":
+			val, err := strconv.ParseBool(str)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid bool key: %q", str)
+			}
+
+			key.value = val
+
+			if val {
+				key.order = 1
+			}
+
+		case "int64":
+			val, err := strconv.ParseInt(str, 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid int64 key: %q", str)
+			}
+
+			key.value = val
+
+		case "uint64":
+			val, err := strconv.ParseUint(str, 10, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid uint64 key: %q", str)
+			}
+
+			key.value = val
+
+		default:
+			num, err := strconv.ParseFloat(str, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid number key: %q", str)
+			}
+
+			key.value = num
+			key.order = num
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		switch keyType {
+		case "string":
+			return keys[i].str < keys[j].str
+
+		case "int64":
+			return keys[i].value.(int64) < keys[j].value.(int64)
+
+		case "uint64":
+			return keys[i].value.(uint64) < keys[j].value.(uint64)
+		}
+
+		return keys[i].order < keys[j].order
+	})
+
+	return keys, nil
+}
+
+// wireSchema describes the compiled schema in
+// terms of the kosuzu schema, so the packets are
+// decoded by kosuzu.Decomposer.ReadMessage. The
+// nested compiled schemas may use the same type
+// names for different messages, so the repeated
+// names get a numeric suffix.
+func (compiled *messageSchema) wireSchema() (*schema.Schema, *schema.Message) {
+	wire := new(schema.Schema)
+	names := map[*messageSchema]string{}
+	used := map[string]bool{}
+	var add func(compiled *messageSchema, name string) *schema.Message
+	var rename func(types map[string]*messageSchema, typ *schema.Type) *schema.Type
+
+	add = func(compiled *messageSchema, name string) *schema.Message {
+		wireName := name
+
+		for i := 2; used[wireName]; i++ {
+			wireName = fmt.Sprintf("%s%d", name, i)
+		}
+
+		used[wireName] = true
+		names[compiled] = wireName
+		message := &schema.Message{Name: wireName}
+		wire.Messages = append(wire.Messages, message)
+
+		for _, field := range compiled.fields {
+			message.Fields = append(message.Fields, &schema.Field{
+				Name: field.name,
+				Type: rename(compiled.types, field.typ).String(),
+			})
+		}
+
+		return message
+	}
+
+	rename = func(types map[string]*messageSchema, typ *schema.Type) *schema.Type {
+		renamed := *typ
+
+		if typ.Key != nil {
+			renamed.Key = rename(types, typ.Key)
+		}
+
+		if typ.Elem != nil {
+			renamed.Elem = rename(types, typ.Elem)
+		}
+
+		if nested, ok := types[typ.Name]; ok && typ.Kind == schema.Named {
+			if _, ok := names[nested]; !ok {
+				add(nested, typ.Name)
+			}
+
+			renamed.Name = names[nested]
+		}
+
+		return &renamed
+	}
+
+	return wire, add(compiled, "")
+}
+
+// decode reads the object fields from
+// the decomposer in the schema order.
+func (compiled *messageSchema) decode(decomposer *kosuzu.Decomposer) (map[string]interface{}, error) {
+	obj, err := decomposer.ReadMessage(compiled.wire, compiled.message)
+
+	if err != nil {
+		var decodeErr *kosuzu.DecodeError
+
+		if errors.As(err, &decodeErr) {
+			return nil, &fieldError{
+				field:  decodeErr.Path,
+				offset: int(decodeErr.Offset),
+				cause:  decodeErr.Err,
+			}
+		}
+
+		return nil, err
+	}
+
+	return compiled.fromWire(obj), nil
+}
+
+// fromWire converts the fields read by kosuzu to
+// the values passed to JavaScript: 64-bit integers
+// to bigInt and the slices of the other primitives
+// except strings and complex numbers to Go slices
+// passed as typed arrays.
+func (compiled *messageSchema) fromWire(obj map[string]interface{}) map[string]interface{} {
+	for _, field := range compiled.fields {
+		obj[field.name] = fromWire(compiled.types, field.typ, obj[field.name])
+	}
+
+	return obj
+}
+
+func fromWire(types map[string]*messageSchema, typ *schema.Type, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch typ.Kind {
+	case schema.Slice, schema.Array:
+		elems := value.([]interface{})
+
+		if typ.Kind == schema.Slice && typ.Elem.Kind == schema.Named &&
+			readsAsSlice(typ.Elem.Name) {
+			slice := reflect.MakeSlice(reflect.SliceOf(
+				primitiveTypes[typ.Elem.Name]), len(elems), len(elems))
+
+			for i, elem := range elems {
+				slice.Index(i).Set(reflect.ValueOf(elem))
+			}
+
+			return slice.Interface()
+		}
+
+		for i, elem := range elems {
+			elems[i] = fromWire(types, typ.Elem, elem)
+		}
+
+		return elems
+
+	case schema.Map:
+		obj := value.(map[string]interface{})
+
+		for key, elem := range obj {
+			obj[key] = fromWire(types, typ.Elem, elem)
+		}
+
+		return obj
+
+	case schema.Pointer:
+		return fromWire(types, typ.Elem, value)
+	}
+
+	if nested, ok := types[typ.Name]; ok {
+		return nested.fromWire(value.(map[string]interface{}))
+	}
+
+	switch val := value.(type) {
+	case int64:
+		return bigInt(strconv.FormatInt(val, 10))
+
+	case uint64:
+		return bigInt(strconv.FormatUint(val, 10))
+	}
+
+	return value
+}
+
+// readsAsSlice returns true if the slices of the
+// primitive type are read at once into the Go slice
+// passed to JavaScript as the typed array. The other
+// slices are read element by element.
+func readsAsSlice(name string) bool {
+	switch name {
+	case "string", "int64", "uint64", "complex64", "complex128":
+		return false
+	}
+
+	_, ok := jsTypes[name]
+
+	return ok
+}
+
+// primitiveTypes contains the Go types of the
+// elements of the slices read as typed arrays.
+var primitiveTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"byte":    reflect.TypeOf(byte(0)),
+	"rune":    reflect.TypeOf(rune(0)),
+	"int8":    reflect.TypeOf(int8(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+}
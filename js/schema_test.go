@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type wide struct {
+	Big     int64
+	Huge    uint64
+	Small   int64
+	Phase   complex64
+	Wave    complex128
+	Letter  rune
+	Code    rune
+	Word    []rune
+	Serials []int64
+	Owners  map[int64]string
+}
+
+func compileWide(t *testing.T) *messageSchema {
+	fields := []interface{}{}
+
+	for _, f := range [][2]string{
+		{"Big", "int64"},
+		{"Huge", "uint64"},
+		{"Small", "int64"},
+		{"Phase", "complex64"},
+		{"Wave", "complex128"},
+		{"Letter", "rune"},
+		{"Code", "rune"},
+		{"Word", "[]rune"},
+		{"Serials", "[]int64"},
+		{"Owners", "map[int64]string"},
+	} {
+		fields = append(fields, map[string]interface{}{
+			"name": f[0],
+			"type": f[1],
+		})
+	}
+
+	compiled, err := compileSchema(fields, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return compiled
+}
+
+func TestWideRoundTrip(t *testing.T) {
+	compiled := compileWide(t)
+	value := &wide{
+		Big:     -9007199254740993,
+		Huge:    18446744073709551615,
+		Small:   42,
+		Phase:   1.5 - 2i,
+		Wave:    -0.25 + 8i,
+		Letter:  'ё',
+		Code:    'Z',
+		Word:    []rune("小鈴"),
+		Serials: []int64{9007199254740993, -1},
+		Owners: map[int64]string{
+			9007199254740993: "far",
+			-5:               "near",
+		},
+	}
+
+	expected, err := kosuzu.Serialize(1, value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := map[string]interface{}{
+		"Big":     bigInt("-9007199254740993"),
+		"Huge":    bigInt("18446744073709551615"),
+		"Small":   float64(42),
+		"Phase":   map[string]interface{}{"re": 1.5, "im": float64(-2)},
+		"Wave":    map[string]interface{}{"re": -0.25, "im": float64(8)},
+		"Letter":  "ё",
+		"Code":    float64('Z'),
+		"Word":    "小鈴",
+		"Serials": []interface{}{bigInt("9007199254740993"), float64(-1)},
+		"Owners": map[string]interface{}{
+			"9007199254740993": "far",
+			"-5":               "near",
+		},
+	}
+
+	builder := kosuzu.NewPacketBuilder()
+	err = compiled.encode(builder, obj)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(builder.BuildPacket(1).Payload(), expected.Payload()) {
+		t.Fatalf("payload differs from the Go codec")
+	}
+
+	decoded, err := compiled.decode(kosuzu.NewPacketDecomposer(expected))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"Big":     bigInt("-9007199254740993"),
+		"Huge":    bigInt("18446744073709551615"),
+		"Small":   bigInt("42"),
+		"Phase":   map[string]interface{}{"re": 1.5, "im": float64(-2)},
+		"Wave":    map[string]interface{}{"re": -0.25, "im": float64(8)},
+		"Letter":  'ё',
+		"Code":    'Z',
+		"Word":    []rune("小鈴"),
+		"Serials": []interface{}{bigInt("9007199254740993"), bigInt("-1")},
+		"Owners": map[string]interface{}{
+			"9007199254740993": "far",
+			"-5":               "near",
+		},
+	}
+
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("expected %v, got %v", want, decoded)
+	}
+}
+
+func TestWideErrors(t *testing.T) {
+	compiled := compileWide(t)
+
+	for _, test := range []struct {
+		field string
+		value interface{}
+	}{
+		{"Big", float64(1 << 60)},
+		{"Big", 1.5},
+		{"Big", bigInt("9223372036854775808")},
+		{"Huge", bigInt("-1")},
+		{"Phase", float64(1)},
+		{"Letter", "ab"},
+		{"Letter", ""},
+		{"Letter", "\xff"},
+		{"Code", 1.7},
+		{"Code", float64(1 << 31)},
+	} {
+		obj := map[string]interface{}{
+			"Big":    bigInt("0"),
+			"Huge":   bigInt("0"),
+			"Small":  float64(0),
+			"Phase":  map[string]interface{}{"re": 0.0, "im": 0.0},
+			"Wave":   map[string]interface{}{"re": 0.0, "im": 0.0},
+			"Letter": "a",
+			"Code":   float64(0),
+		}
+		obj[test.field] = test.value
+
+		err := compiled.encode(kosuzu.NewPacketBuilder(), obj)
+		fieldErr, ok := err.(*fieldError)
+
+		if !ok || fieldErr.field != test.field {
+			t.Fatalf("expected error for %s = %v, got %v",
+				test.field, test.value, err)
+		}
+	}
+}
+
+type ranged struct {
+	A int32
+	B uint8
+	C int16
+	D byte
+	E uint32
+	F int8
+	G uint16
+	H rune
+}
+
+func TestIntegerRanges(t *testing.T) {
+	fields := []interface{}{}
+
+	for _, f := range [][2]string{
+		{"A", "int32"},
+		{"B", "uint8"},
+		{"C", "int16"},
+		{"D", "byte"},
+		{"E", "uint32"},
+		{"F", "int8"},
+		{"G", "uint16"},
+		{"H", "rune"},
+	} {
+		fields = append(fields, map[string]interface{}{
+			"name": f[0],
+			"type": f[1],
+		})
+	}
+
+	compiled, err := compileSchema(fields, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The bounds are accepted and encoded
+	// the same way the Go codec encodes them.
+	for _, value := range []ranged{
+		{A: math.MinInt32, B: 0, C: math.MinInt16, D: 0,
+			E: 0, F: math.MinInt8, G: 0, H: '\uFFFD'},
+		{A: math.MaxInt32, B: math.MaxUint8, C: math.MaxInt16, D: math.MaxUint8,
+			E: math.MaxUint32, F: math.MaxInt8, G: math.MaxUint16, H: math.MaxInt32},
+	} {
+		expected, err := kosuzu.Serialize(1, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		obj := map[string]interface{}{
+			"A": float64(value.A),
+			"B": float64(value.B),
+			"C": float64(value.C),
+			"D": float64(value.D),
+			"E": float64(value.E),
+			"F": float64(value.F),
+			"G": float64(value.G),
+			"H": float64(value.H),
+		}
+
+		// The replacement character is a valid
+		// rune when passed as a string as well.
+		if value.H == '\uFFFD' {
+			obj["H"] = "\uFFFD"
+		}
+
+		builder := kosuzu.NewPacketBuilder()
+		err = compiled.encode(builder, obj)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(builder.BuildPacket(1).Payload(), expected.Payload()) {
+			t.Fatalf("%+v: payload differs from the Go codec", value)
+		}
+	}
+
+	for _, test := range []struct {
+		field string
+		value interface{}
+	}{
+		{"A", 3e9},
+		{"A", -2147483649.0},
+		{"B", float64(300)},
+		{"B", float64(-1)},
+		{"C", 1.7},
+		{"C", float64(40000)},
+		{"D", float64(256)},
+		{"E", float64(-1)},
+		{"E", float64(1 << 32)},
+		{"F", float64(128)},
+		{"G", float64(65536)},
+		{"G", math.NaN()},
+		{"H", math.Inf(1)},
+	} {
+		obj := map[string]interface{}{
+			"A": float64(0),
+			"B": float64(0),
+			"C": float64(0),
+			"D": float64(0),
+			"E": float64(0),
+			"F": float64(0),
+			"G": float64(0),
+			"H": float64(0),
+		}
+		obj[test.field] = test.value
+
+		err := compiled.encode(kosuzu.NewPacketBuilder(), obj)
+		fieldErr, ok := err.(*fieldError)
+
+		if !ok || fieldErr.field != test.field {
+			t.Fatalf("expected error for %s = %v, got %v",
+				test.field, test.value, err)
+		}
+	}
+}
+
+func TestComplexMapKeys(t *testing.T) {
+	for _, typ := range []string{"map[complex64]int32", "map[complex128]string"} {
+		_, err := compileSchema([]interface{}{
+			map[string]interface{}{"name": "Lookup", "type": typ},
+		}, nil)
+
+		if err == nil {
+			t.Fatalf("expected %s to be rejected", typ)
+		}
+	}
+}
+
+func TestHostileLengths(t *testing.T) {
+	compiled, err := compileSchema([]interface{}{
+		map[string]interface{}{"name": "Items", "type": "[]Hollow"},
+		map[string]interface{}{"name": "Lookup", "type": "map[int32]Hollow"},
+	}, map[string]interface{}{"Hollow": []interface{}{}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, payload := range [][]byte{
+		{0x7f, 0xff, 0xff, 0xff},
+		{0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff},
+	} {
+		decomposer := kosuzu.NewPacketDecomposer(kosuzu.NewPacket(1, payload))
+		_, err := compiled.decode(decomposer)
+
+		if !errors.Is(err, kosuzu.ErrTruncated) {
+			t.Fatalf("% x: expected truncated payload error, got %v", payload, err)
+		}
+	}
+}
+
+func TestShadowedTypes(t *testing.T) {
+	inner, err := compileSchema([]interface{}{
+		map[string]interface{}{"name": "Item", "type": "Item"},
+	}, map[string]interface{}{"Item": []interface{}{
+		map[string]interface{}{"name": "Count", "type": "uint16"},
+	}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compiled, err := compileSchema([]interface{}{
+		map[string]interface{}{"name": "Inner", "type": "Inner"},
+		map[string]interface{}{"name": "Items", "type": "[]Item"},
+	}, map[string]interface{}{
+		"Inner": inner,
+		"Item": []interface{}{
+			map[string]interface{}{"name": "Name", "type": "string"},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := map[string]interface{}{
+		"Inner": map[string]interface{}{
+			"Item": map[string]interface{}{"Count": float64(3)},
+		},
+		"Items": []interface{}{map[string]interface{}{"Name": "reimu"}},
+	}
+	builder := kosuzu.NewPacketBuilder()
+	err = compiled.encode(builder, obj)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := compiled.decode(kosuzu.NewPacketDecomposer(builder.BuildPacket(1)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"Inner": map[string]interface{}{
+			"Item": map[string]interface{}{"Count": uint16(3)},
+		},
+		"Items": []interface{}{map[string]interface{}{"Name": "reimu"}},
+	}
+
+	if !reflect.DeepEqual(decoded, want) {
+		t.Fatalf("expected %v, got %v", want, decoded)
+	}
+
+	_, err = compiled.decode(kosuzu.NewPacketDecomposer(kosuzu.NewPacket(1, []byte{0, 3, 0, 0, 0, 1, 0, 0, 0, 9})))
+	var fieldErr *fieldError
+
+	if !errors.As(err, &fieldErr) || fieldErr.field != "Items[0].Name" {
+		t.Fatalf("expected error for Items[0].Name, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package kosuzu_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func TestHostileLengths(t *testing.T) {
+	readers := map[string]func(*kosuzu.Decomposer) error{
+		"string": func(d *kosuzu.Decomposer) error {
+			_, err := d.ReadString()
+			return err
+		},
+		"bytes": func(d *kosuzu.Decomposer) error {
+			_, err := d.ReadByteArray()
+			return err
+		},
+		"int64s": func(d *kosuzu.Decomposer) error {
+			_, err := d.ReadInt64Array()
+			return err
+		},
+		"items": func(d *kosuzu.Decomposer) error {
+			var items []Item
+			return d.ReadValue(&items)
+		},
+		"map": func(d *kosuzu.Decomposer) error {
+			var m map[string]int32
+			return d.ReadValue(&m)
+		},
+		"empty structs": func(d *kosuzu.Decomposer) error {
+			var empty []struct{}
+			return d.ReadValue(&empty)
+		},
+		"empty arrays": func(d *kosuzu.Decomposer) error {
+			var empty [][0]int64
+			return d.ReadValue(&empty)
+		},
+	}
+
+	for name, read := range readers {
+		for _, prefix := range [][]byte{
+			{0xff, 0xff, 0xff, 0xfe},
+			{0x7f, 0xff, 0xff, 0xff},
+			{0x00, 0x00, 0x00, 0x09, 1, 2, 3, 4, 5, 6, 7, 8},
+		} {
+			err := read(kosuzu.NewPacketDecomposer(kosuzu.NewPacket(1, prefix)))
+
+			if !errors.Is(err, kosuzu.ErrInvalidLength) && !errors.Is(err, kosuzu.ErrTruncated) {
+				t.Fatalf("%s % x: expected invalid length error, got %v", name, prefix, err)
+			}
+		}
+	}
+}
+
+func TestDecomposerLimits(t *testing.T) {
+	packet, err := kosuzu.Serialize(5, &Inventory{
+		Owner: "kosuzu",
+		Items: []Item{{1, "book"}, {2, "scroll"}, {3, "lamp"}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, limits := range []kosuzu.Limits{
+		{MaxStringLength: 5},
+		{MaxArrayLength: 2},
+		{MaxAllocation: 64},
+	} {
+		decomposer := kosuzu.NewPacketDecomposer(packet)
+		decomposer.SetLimits(limits)
+		err := decomposer.ReadValue(&Inventory{})
+
+		if !errors.Is(err, kosuzu.ErrLimitExceeded) {
+			t.Fatalf("%+v: expected limit error, got %v", limits, err)
+		}
+	}
+
+	decomposer := kosuzu.NewPacketDecomposer(packet)
+	decomposer.SetLimits(kosuzu.Limits{
+		MaxStringLength: 6,
+		MaxArrayLength:  3,
+		MaxAllocation:   1024,
+	})
+
+	if err := decomposer.ReadValue(&Inventory{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type Hollow struct{}
+
+type Hollows struct {
+	Items []Hollow
+}
+
+func TestZeroSizeElements(t *testing.T) {
+	sch, err := kosuzu.SchemaOf(Hollows{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packet := kosuzu.NewPacket(1, []byte{0x7f, 0xff, 0xff, 0xff})
+	decomposer := kosuzu.NewPacketDecomposer(packet)
+	decomposer.SetLimits(kosuzu.Limits{MaxAllocation: 1 << 20})
+	err = decomposer.ReadValue(&Hollows{})
+
+	if !errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected truncated payload error, got %v", err)
+	}
+
+	_, err = kosuzu.DeserializeMap(packet, sch, "Hollows")
+
+	if !errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected truncated payload error, got %v", err)
+	}
+
+	// The empty slice is still read.
+	packet = kosuzu.NewPacket(1, []byte{0, 0, 0, 0})
+	var hollows Hollows
+	err = kosuzu.Deserialize(packet, &hollows)
+
+	if err != nil || len(hollows.Items) != 0 {
+		t.Fatalf("expected no items, got %v, %v", hollows.Items, err)
+	}
+}
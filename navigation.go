@@ -0,0 +1,267 @@
+package kosuzu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Offset returns the number of bytes
+// read from the start of the decomposer.
+// The offset of the sub-decomposer is
+// counted from the start of its own data.
+func (decomposer *Decomposer) Offset() int64 {
+	return decomposer.buffer.Size() - int64(decomposer.buffer.Len())
+}
+
+// Remaining returns the number
+// of bytes left to read.
+func (decomposer *Decomposer) Remaining() int {
+	return decomposer.buffer.Len()
+}
+
+// Done returns an error wrapping ErrTrailingBytes
+// if there are bytes left to read. It's used to check
+// the payload was consumed completely.
+func (decomposer *Decomposer) Done() error {
+	if remaining := decomposer.Remaining(); remaining > 0 {
+		return decomposer.fail(decomposer.offset(), "end of payload",
+			fmt.Errorf("%w: %d bytes left", ErrTrailingBytes, remaining))
+	}
+
+	return nil
+}
+
+// Skip skips n bytes.
+func (decomposer *Decomposer) Skip(n int) error {
+	offset := decomposer.offset()
+
+	if n < 0 {
+		return decomposer.fail(offset, fmt.Sprintf("[%d]byte", n),
+			fmt.Errorf("%w: %d", ErrInvalidLength, n))
+	}
+
+	if n > decomposer.Remaining() {
+		return decomposer.fail(offset, fmt.Sprintf("[%d]byte", n), ErrTruncated)
+	}
+
+	_, err := decomposer.buffer.Seek(int64(n), io.SeekCurrent)
+
+	return err
+}
+
+// SkipString skips the string
+// without allocating it.
+func (decomposer *Decomposer) SkipString() error {
+	return decomposer.SkipArray(1)
+}
+
+// SkipArray skips the length-prefixed array,
+// such as the one written with AddInt32Array,
+// with the elements of elemSize bytes.
+func (decomposer *Decomposer) SkipArray(elemSize int) error {
+	offset := decomposer.offset()
+	typ := fmt.Sprintf("[][%d]byte", elemSize)
+	length, err := decomposer.ReadInt32()
+
+	if err != nil {
+		return decomposer.fail(offset, typ, err)
+	}
+
+	if elemSize < 0 {
+		return decomposer.fail(offset, typ,
+			fmt.Errorf("invalid element size: %d", elemSize))
+	}
+
+	if length < 0 {
+		return decomposer.fail(offset, typ,
+			fmt.Errorf("%w: %d", ErrInvalidLength, length))
+	}
+
+	if int64(length)*int64(elemSize) > int64(decomposer.Remaining()) {
+		return decomposer.fail(offset, typ, ErrTruncated)
+	}
+
+	_, err = decomposer.buffer.Seek(
+		int64(length)*int64(elemSize), io.SeekCurrent)
+
+	return err
+}
+
+// Seek sets the offset for the next read
+// like io.Seeker does. The offset can't
+// go beyond the decomposer data.
+func (decomposer *Decomposer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+
+	case io.SeekCurrent:
+		offset += decomposer.Offset()
+
+	case io.SeekEnd:
+		offset += decomposer.buffer.Size()
+
+	default:
+		return decomposer.Offset(), fmt.Errorf("invalid whence: %d", whence)
+	}
+
+	if offset < 0 || offset > decomposer.buffer.Size() {
+		return decomposer.Offset(), fmt.Errorf(
+			"offset %d is out of range [0, %d]", offset, decomposer.buffer.Size())
+	}
+
+	return decomposer.buffer.Seek(offset, io.SeekStart)
+}
+
+// Sub returns the decomposer reading the
+// next n bytes and skips them. The reads from
+// the sub-decomposer can't go beyond these bytes,
+// which allows to decode the length-delimited
+// parts of the payload separately. It shares
+// the limits, the checks and the allocation
+// count with the parent decomposer.
+func (decomposer *Decomposer) Sub(n int) (*Decomposer, error) {
+	offset := decomposer.Offset()
+	err := decomposer.Skip(n)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := decomposer.data[offset : offset+int64(n)]
+
+	return &Decomposer{
+		buffer:    bytes.NewReader(data),
+		data:      data,
+		opcode:    decomposer.opcode,
+		base:      decomposer.base + offset,
+		limits:    decomposer.limits,
+		allocated: decomposer.allocated,
+		checks:    decomposer.checks,
+	}, nil
+}
+
+// peek returns the function restoring
+// the state of the decomposer, so the value
+// can be read without advancing it.
+func (decomposer *Decomposer) peek() func() {
+	offset := decomposer.Offset()
+	allocated := *decomposer.allocated
+
+	return func() {
+		decomposer.buffer.Seek(offset, io.SeekStart)
+		*decomposer.allocated = allocated
+	}
+}
+
+// PeekBool reads a bool value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekBool() (bool, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadBool()
+}
+
+// PeekRune reads a rune value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekRune() (rune, int, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadRune()
+}
+
+// PeekByte reads a byte value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekByte() (byte, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadByte()
+}
+
+// PeekInt8 reads an int8 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekInt8() (int8, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadInt8()
+}
+
+// PeekUint8 reads a uint8 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekUint8() (uint8, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadUint8()
+}
+
+// PeekInt16 reads an int16 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekInt16() (int16, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadInt16()
+}
+
+// PeekUint16 reads a uint16 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekUint16() (uint16, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadUint16()
+}
+
+// PeekInt32 reads an int32 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekInt32() (int32, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadInt32()
+}
+
+// PeekUint32 reads a uint32 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekUint32() (uint32, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadUint32()
+}
+
+// PeekInt64 reads an int64 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekInt64() (int64, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadInt64()
+}
+
+// PeekUint64 reads a uint64 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekUint64() (uint64, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadUint64()
+}
+
+// PeekFloat32 reads a float32 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekFloat32() (float32, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadFloat32()
+}
+
+// PeekFloat64 reads a float64 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekFloat64() (float64, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadFloat64()
+}
+
+// PeekComplex64 reads a complex64 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekComplex64() (complex64, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadComplex64()
+}
+
+// PeekComplex128 reads a complex128 value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekComplex128() (complex128, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadComplex128()
+}
+
+// PeekString reads a string value
+// without advancing the decomposer.
+func (decomposer *Decomposer) PeekString() (string, error) {
+	defer decomposer.peek()()
+	return decomposer.ReadString()
+}
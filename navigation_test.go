@@ -0,0 +1,105 @@
+package kosuzu_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func TestDecomposerNavigation(t *testing.T) {
+	builder := kosuzu.NewPacketBuilder()
+	builder.AddInt32(7)
+	builder.AddString("reimu")
+	builder.AddInt16Array([]int16{1, 2, 3})
+	builder.AddByteArray([]byte{9, 8, 7})
+	builder.AddFloat64(1.5)
+	decomposer := kosuzu.NewPacketDecomposer(builder.BuildPacket(1))
+
+	if peeked, err := decomposer.PeekInt32(); err != nil || peeked != 7 ||
+		decomposer.Offset() != 0 {
+		t.Fatalf("unexpected peek: %d, %v, offset %d", peeked, err, decomposer.Offset())
+	}
+
+	if err := decomposer.Skip(4); err != nil {
+		t.Fatal(err)
+	}
+
+	if peeked, err := decomposer.PeekString(); err != nil || peeked != "reimu" {
+		t.Fatalf("unexpected peek: %q, %v", peeked, err)
+	}
+
+	if err := decomposer.SkipString(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := decomposer.SkipArray(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if decomposer.Offset() != 4+9+10 || decomposer.Remaining() != 7+8 {
+		t.Fatalf("unexpected position: %d, %d", decomposer.Offset(), decomposer.Remaining())
+	}
+
+	sub, err := decomposer.Sub(7)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := sub.ReadByteArray()
+
+	if err != nil || len(bytes) != 3 || bytes[0] != 9 {
+		t.Fatalf("unexpected bytes: %v, %v", bytes, err)
+	}
+
+	if err := sub.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sub.ReadByte(); !errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected the sub-decomposer to be bounded, got %v", err)
+	}
+
+	if err := decomposer.Done(); !errors.Is(err, kosuzu.ErrTrailingBytes) {
+		t.Fatalf("expected trailing bytes, got %v", err)
+	}
+
+	value, err := decomposer.ReadFloat64()
+
+	if err != nil || value != 1.5 {
+		t.Fatalf("unexpected value: %v, %v", value, err)
+	}
+
+	if err := decomposer.Done(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decomposer.Seek(4, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := decomposer.ReadString(); err != nil || name != "reimu" {
+		t.Fatalf("unexpected string after seek: %q, %v", name, err)
+	}
+
+	if _, err := decomposer.Seek(1, io.SeekEnd); err == nil {
+		t.Fatalf("expected error for seeking beyond the end")
+	}
+
+	if err := decomposer.Skip(1 << 20); !errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected truncated skip, got %v", err)
+	}
+
+	if _, err := decomposer.Seek(4+9, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	err = decomposer.SkipArray(-1)
+
+	if err == nil || !strings.Contains(err.Error(), "element size: -1") {
+		t.Fatalf("expected invalid element size, got %v", err)
+	}
+}
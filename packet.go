@@ -2,18 +2,112 @@ package kosuzu
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 )
 
+const (
+	// flagChecksum marks the packet
+	// followed by a CRC32C trailer.
+	flagChecksum byte = 1 << iota
+	// flagSignature marks the packet
+	// with the key ID in the header
+	// followed by an HMAC-SHA256 tag.
+	flagSignature
+	// flagCorrelation marks the packet
+	// with the correlation ID in the header.
+	flagCorrelation
+)
+
+const (
+	// knownFlags contains all the flags
+	// the packet reader can handle.
+	knownFlags = flagChecksum | flagSignature | flagCorrelation
+	// lengthMask extracts the payload length
+	// from the length field of the header.
+	lengthMask = 1<<56 - 1
+)
+
+// HeaderLength is the number of bytes
+// PacketLength needs to determine the
+// length of the whole packet.
+const HeaderLength = 4 + 8
+
+var (
+	// ErrChecksumMismatch is returned when the
+	// checksum of the packet read from the stream
+	// doesn't match its contents.
+	ErrChecksumMismatch = errors.New("packet checksum mismatch")
+	// ErrSignatureMismatch is returned when the
+	// HMAC tag of the packet is not valid.
+	ErrSignatureMismatch = errors.New("packet signature mismatch")
+	// ErrNotSigned is returned when the packet
+	// expected to be signed has no HMAC tag.
+	ErrNotSigned = errors.New("packet is not signed")
+	// ErrUnknownKey is returned when the packet is
+	// signed with the key absent from the keyring.
+	ErrUnknownKey = errors.New("unknown signing key")
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ChecksumError describes the packet
+// which failed the integrity check.
+type ChecksumError struct {
+	Opcode   int32
+	Expected uint32
+	Actual   uint32
+}
+
+// Error returns the description of the error.
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: opcode %d, expected %08x, got %08x",
+		ErrChecksumMismatch, err.Opcode, err.Expected, err.Actual)
+}
+
+// Unwrap returns ErrChecksumMismatch so
+// the error can be checked with errors.Is.
+func (err *ChecksumError) Unwrap() error {
+	return ErrChecksumMismatch
+}
+
+// Keyring maps key IDs to the secret
+// keys used to sign packets. Keeping
+// several keys allows to rotate them
+// without rejecting packets signed
+// with the previous one.
+type Keyring map[uint32][]byte
+
 // Packet is a byte sequence
 // representing a message
 // serialized to be sent
 // through network.
+//
+// The packet header consists of the
+// opcode (4 bytes), the flags (1 byte)
+// and the payload length (7 bytes).
+// If the packet is signed, the header
+// also contains the key ID (4 bytes),
+// and the payload is followed by
+// the HMAC-SHA256 tag (32 bytes).
+// If the packet has the correlation ID,
+// it's written after the key ID (4 bytes).
+// If the checksum is enabled, the packet
+// ends with the CRC32C of all
+// the preceding bytes (4 bytes).
 type Packet struct {
-	Opcode     int32
-	dataLength int64
-	payload    []byte
+	Opcode        int32
+	flags         byte
+	dataLength    int64
+	keyID         uint32
+	correlationID uint32
+	payload       []byte
+	signature     []byte
 }
 
 // Payload returns the data written
@@ -31,11 +125,189 @@ func (packet *Packet) DataLength() int64 {
 	return packet.dataLength
 }
 
+// SetChecksum enables or disables the
+// CRC32C trailer for the packet. The trailer
+// is verified by ReadPacketFrom, so corrupted
+// packets are rejected before deserialization.
+func (packet *Packet) SetChecksum(enabled bool) {
+	if enabled {
+		packet.flags |= flagChecksum
+	} else {
+		packet.flags &^= flagChecksum
+	}
+}
+
+// HasChecksum returns true if the
+// packet has the CRC32C trailer.
+func (packet *Packet) HasChecksum() bool {
+	return packet.flags&flagChecksum != 0
+}
+
+// Checksum computes the CRC32C of the packet
+// header, payload and signature.
+func (packet *Packet) Checksum() uint32 {
+	hash := crc32.New(crcTable)
+
+	binary.Write(hash, binary.BigEndian, packet.Opcode)
+	binary.Write(hash, binary.BigEndian, packet.lengthField())
+
+	if packet.HasSignature() {
+		binary.Write(hash, binary.BigEndian, packet.keyID)
+	}
+
+	if packet.HasCorrelationID() {
+		binary.Write(hash, binary.BigEndian, packet.correlationID)
+	}
+
+	hash.Write(packet.payload)
+	hash.Write(packet.signature)
+
+	return hash.Sum32()
+}
+
+// Sign appends the HMAC-SHA256 tag of the packet
+// opcode, payload length, key ID, correlation ID
+// and payload to the packet. The key ID is written
+// to the packet header so the receiver can pick
+// the right key from its keyring. The correlation
+// ID must be set before the packet is signed.
+func (packet *Packet) Sign(keyID uint32, key []byte) {
+	packet.flags |= flagSignature
+	packet.keyID = keyID
+	packet.signature = packet.mac(key)
+}
+
+// HasSignature returns true if the
+// packet has the HMAC tag.
+func (packet *Packet) HasSignature() bool {
+	return packet.flags&flagSignature != 0
+}
+
+// KeyID returns the ID of the key
+// the packet was signed with.
+func (packet *Packet) KeyID() uint32 {
+	return packet.keyID
+}
+
+// SetCorrelationID writes the ID to the packet
+// header, so the response can be matched with
+// the request it answers.
+func (packet *Packet) SetCorrelationID(id uint32) {
+	packet.flags |= flagCorrelation
+	packet.correlationID = id
+}
+
+// HasCorrelationID returns true if the
+// packet has the correlation ID.
+func (packet *Packet) HasCorrelationID() bool {
+	return packet.flags&flagCorrelation != 0
+}
+
+// CorrelationID returns the
+// correlation ID of the packet.
+func (packet *Packet) CorrelationID() uint32 {
+	return packet.correlationID
+}
+
+// Verify checks the HMAC tag of the packet
+// using the key from the keyring.
+func (packet *Packet) Verify(keys Keyring) error {
+	if !packet.HasSignature() {
+		return fmt.Errorf("%w: opcode %d",
+			ErrNotSigned, packet.Opcode)
+	}
+
+	key, ok := keys[packet.keyID]
+
+	if !ok {
+		return fmt.Errorf("%w: opcode %d, key %d",
+			ErrUnknownKey, packet.Opcode, packet.keyID)
+	}
+
+	if !hmac.Equal(packet.signature, packet.mac(key)) {
+		return fmt.Errorf("%w: opcode %d, key %d",
+			ErrSignatureMismatch, packet.Opcode, packet.keyID)
+	}
+
+	return nil
+}
+
+// mac computes the HMAC-SHA256 tag
+// of the packet with the given key.
+func (packet *Packet) mac(key []byte) []byte {
+	hash := hmac.New(sha256.New, key)
+
+	binary.Write(hash, binary.BigEndian, packet.Opcode)
+	binary.Write(hash, binary.BigEndian, packet.dataLength)
+	binary.Write(hash, binary.BigEndian, packet.keyID)
+
+	if packet.HasCorrelationID() {
+		binary.Write(hash, binary.BigEndian, packet.correlationID)
+	}
+
+	hash.Write(packet.payload)
+
+	return hash.Sum(nil)
+}
+
+// lengthField returns the packet
+// flags combined with the payload length.
+func (packet *Packet) lengthField() int64 {
+	return int64(packet.flags)<<56 | packet.dataLength
+}
+
+// setLengthField sets the packet flags
+// and the payload length read from
+// the length field of the header.
+func (packet *Packet) setLengthField(lengthField int64) error {
+	packet.flags = byte(uint64(lengthField) >> 56)
+	packet.dataLength = lengthField & lengthMask
+
+	if packet.flags&^knownFlags != 0 {
+		return fmt.Errorf(
+			"unknown packet flags: %08b", packet.flags)
+	}
+
+	return nil
+}
+
+// headerLength returns the number of bytes
+// written before the packet payload.
+func (packet *Packet) headerLength() int64 {
+	length := int64(4 + 8)
+
+	if packet.HasSignature() {
+		length += 4
+	}
+
+	if packet.HasCorrelationID() {
+		length += 4
+	}
+
+	return length
+}
+
+// trailerLength returns the number of bytes
+// written after the packet payload.
+func (packet *Packet) trailerLength() int64 {
+	var length int64
+
+	if packet.HasSignature() {
+		length += sha256.Size
+	}
+
+	if packet.HasChecksum() {
+		length += 4
+	}
+
+	return length
+}
+
 // Bytes returns the raw binary representation
 // of the packet.
 func (packet *Packet) Bytes() ([]byte, error) {
 	buffer := bytes.NewBuffer(make([]byte,
-		4+8+packet.dataLength))
+		packet.headerLength()+packet.dataLength+packet.trailerLength()))
 	buffer.Reset()
 	_, err := packet.WriteTo(buffer)
 
@@ -57,23 +329,69 @@ func (packet *Packet) WriteTo(stream io.Writer) (int64, error) {
 	}
 
 	err = binary.Write(stream,
-		binary.BigEndian, packet.dataLength)
+		binary.BigEndian, packet.lengthField())
 
 	if err != nil {
 		return 12, err
 	}
 
+	if packet.HasSignature() {
+		err = binary.Write(stream,
+			binary.BigEndian, packet.keyID)
+
+		if err != nil {
+			return 16, err
+		}
+	}
+
+	if packet.HasCorrelationID() {
+		err = binary.Write(stream,
+			binary.BigEndian, packet.correlationID)
+
+		if err != nil {
+			return packet.headerLength(), err
+		}
+	}
+
 	n, err := stream.Write(packet.payload)
 
 	if err != nil {
 		return int64(n), err
 	}
 
-	return 12 + packet.dataLength, nil
+	written := packet.headerLength() + packet.dataLength
+
+	if packet.HasSignature() {
+		n, err = stream.Write(packet.signature)
+
+		if err != nil {
+			return written + int64(n), err
+		}
+
+		written += int64(n)
+	}
+
+	if packet.HasChecksum() {
+		err = binary.Write(stream,
+			binary.BigEndian, packet.Checksum())
+
+		if err != nil {
+			return written, err
+		}
+
+		written += 4
+	}
+
+	return written, nil
 }
 
 // ReadPacketFrom reads a new
 // packet from the reader stream.
+// If the packet has the checksum trailer,
+// it's verified, and *ChecksumError
+// is returned on mismatch. The signature
+// is not verified, use ReadVerifiedPacketFrom
+// or Packet.Verify for that.
 func ReadPacketFrom(stream io.Reader) (int64, *Packet, error) {
 	packet := new(Packet)
 
@@ -84,21 +402,154 @@ func ReadPacketFrom(stream io.Reader) (int64, *Packet, error) {
 		return 4, nil, err
 	}
 
+	var lengthField int64
 	err = binary.Read(stream,
-		binary.BigEndian, &packet.dataLength)
+		binary.BigEndian, &lengthField)
 
 	if err != nil {
 		return 12, nil, err
 	}
 
-	packet.payload = make([]byte, packet.dataLength)
-	n, err := stream.Read(packet.payload)
+	err = packet.setLengthField(lengthField)
 
 	if err != nil {
-		return int64(n), nil, err
+		return 12, nil, err
 	}
 
-	return 12 + packet.dataLength, packet, nil
+	if packet.HasSignature() {
+		err = binary.Read(stream,
+			binary.BigEndian, &packet.keyID)
+
+		if err != nil {
+			return 16, nil, err
+		}
+	}
+
+	if packet.HasCorrelationID() {
+		err = binary.Read(stream,
+			binary.BigEndian, &packet.correlationID)
+
+		if err != nil {
+			return packet.headerLength(), nil, err
+		}
+	}
+
+	payload, n, err := readPayload(stream, packet.dataLength)
+
+	if err != nil {
+		return packet.headerLength() + n, nil, err
+	}
+
+	packet.payload = payload
+
+	read := packet.headerLength() + packet.dataLength
+
+	if packet.HasSignature() {
+		packet.signature = make([]byte, sha256.Size)
+		n, err := io.ReadFull(stream, packet.signature)
+
+		if err != nil {
+			return read + int64(n), nil, err
+		}
+
+		read += int64(n)
+	}
+
+	if packet.HasChecksum() {
+		var checksum uint32
+		err = binary.Read(stream,
+			binary.BigEndian, &checksum)
+
+		if err != nil {
+			return read, nil, err
+		}
+
+		read += 4
+
+		if actual := packet.Checksum(); actual != checksum {
+			return read, nil, &ChecksumError{
+				Opcode:   packet.Opcode,
+				Expected: checksum,
+				Actual:   actual,
+			}
+		}
+	}
+
+	return read, packet, nil
+}
+
+// payloadChunk is the size of the payload
+// allocated up front. Larger payloads are read
+// in chunks, so the memory is allocated only for
+// the bytes actually received and not for the
+// length claimed in the header.
+const payloadChunk = 64 << 10
+
+// readPayload reads the payload of the given
+// length and returns the number of bytes read.
+func readPayload(stream io.Reader, length int64) ([]byte, int64, error) {
+	if length <= payloadChunk {
+		payload := make([]byte, length)
+		n, err := io.ReadFull(stream, payload)
+
+		return payload, int64(n), err
+	}
+
+	buffer := bytes.NewBuffer(make([]byte, 0, payloadChunk))
+	n, err := io.CopyN(buffer, stream, length)
+
+	if err == io.EOF && n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return nil, n, err
+	}
+
+	return buffer.Bytes(), n, nil
+}
+
+// PacketLength returns the length of the whole
+// packet, including the header and the trailers,
+// out of its first HeaderLength bytes. It allows
+// to cut packets out of the buffered stream
+// before passing them to PacketFromBytes.
+func PacketLength(header []byte) (int64, error) {
+	if len(header) < HeaderLength {
+		return 0, fmt.Errorf(
+			"packet header is too short: %d bytes", len(header))
+	}
+
+	packet := new(Packet)
+	err := packet.setLengthField(int64(
+		binary.BigEndian.Uint64(header[4:HeaderLength])))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return packet.headerLength() + packet.dataLength +
+		packet.trailerLength(), nil
+}
+
+// ReadVerifiedPacketFrom reads a new packet
+// from the reader stream and verifies its
+// signature with the keys from the keyring.
+// Unsigned packets are rejected with ErrNotSigned.
+func ReadVerifiedPacketFrom(stream io.Reader, keys Keyring) (int64, *Packet, error) {
+	n, packet, err := ReadPacketFrom(stream)
+
+	if err != nil {
+		return n, nil, err
+	}
+
+	err = packet.Verify(keys)
+
+	if err != nil {
+		return n, nil, err
+	}
+
+	return n, packet, nil
 }
 
 // PacketFromBytes creates a new packet
@@ -114,6 +565,20 @@ func PacketFromBytes(data []byte) (*Packet, error) {
 	return packet, nil
 }
 
+// VerifiedPacketFromBytes creates a new packet
+// out of the byte sequence and verifies its
+// signature with the keys from the keyring.
+func VerifiedPacketFromBytes(data []byte, keys Keyring) (*Packet, error) {
+	buffer := bytes.NewBuffer(data)
+	_, packet, err := ReadVerifiedPacketFrom(buffer, keys)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
 // NewPacket creates a new packet
 // with the specified opcode. Opcodes
 // are required to identify the type
@@ -0,0 +1,203 @@
+package kosuzu_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+func TestChecksum(t *testing.T) {
+	packet := kosuzu.NewPacket(42, []byte("suzunaan"))
+	packet.SetChecksum(true)
+	data, err := packet.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := kosuzu.PacketFromBytes(data)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.HasChecksum() || !bytes.Equal(read.Payload(), packet.Payload()) {
+		t.Fatalf("expected the checksummed packet to be read back")
+	}
+
+	// Corrupt the payload and the trailer.
+	for _, index := range []int{kosuzu.HeaderLength + 3, len(data) - 1} {
+		corrupted := append([]byte{}, data...)
+		corrupted[index] ^= 0x10
+
+		_, _, err := kosuzu.ReadPacketFrom(bytes.NewReader(corrupted))
+
+		if !errors.Is(err, kosuzu.ErrChecksumMismatch) {
+			t.Fatalf("byte %d: expected checksum mismatch, got %v", index, err)
+		}
+
+		var checksumErr *kosuzu.ChecksumError
+
+		if !errors.As(err, &checksumErr) || checksumErr.Opcode != 42 {
+			t.Fatalf("byte %d: expected checksum error for opcode 42, got %v", index, err)
+		}
+
+		if checksumErr.Expected == checksumErr.Actual {
+			t.Fatalf("byte %d: expected the checksums to differ", index)
+		}
+	}
+}
+
+func TestReadPacketFromTruncated(t *testing.T) {
+	packet := kosuzu.NewPacket(42, []byte("suzunaan"))
+	data, err := packet.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, _, err := kosuzu.ReadPacketFrom(bytes.NewReader(data[:len(data)-3]))
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+
+	if read != int64(len(data)-3) {
+		t.Fatalf("expected %d bytes read, got %d", len(data)-3, read)
+	}
+}
+
+func TestSignature(t *testing.T) {
+	keys := kosuzu.Keyring{
+		7: []byte("secret"),
+		8: []byte("rotated"),
+	}
+	sign := func(keyID uint32, key []byte, checksum bool) []byte {
+		packet := kosuzu.NewPacket(42, []byte("suzunaan"))
+		packet.Sign(keyID, key)
+		packet.SetChecksum(checksum)
+		data, err := packet.Bytes()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return data
+	}
+
+	for keyID, key := range keys {
+		for _, checksum := range []bool{false, true} {
+			packet, err := kosuzu.VerifiedPacketFromBytes(
+				sign(keyID, key, checksum), keys)
+
+			if err != nil {
+				t.Fatalf("key %d: %v", keyID, err)
+			}
+
+			if packet.KeyID() != keyID || string(packet.Payload()) != "suzunaan" {
+				t.Fatalf("key %d: unexpected packet read", keyID)
+			}
+		}
+	}
+
+	unsigned, err := kosuzu.NewPacket(42, []byte("suzunaan")).Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The key ID takes 4 bytes after the header.
+	tampered := sign(7, keys[7], false)
+	tampered[kosuzu.HeaderLength+4] ^= 0x10
+	retargeted := sign(7, keys[7], false)
+	retargeted[3] ^= 0x01
+
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"tampered payload", tampered, kosuzu.ErrSignatureMismatch},
+		{"tampered opcode", retargeted, kosuzu.ErrSignatureMismatch},
+		{"wrong key", sign(7, []byte("guess"), false), kosuzu.ErrSignatureMismatch},
+		{"unknown key", sign(9, keys[7], false), kosuzu.ErrUnknownKey},
+		{"unsigned", unsigned, kosuzu.ErrNotSigned},
+	} {
+		_, err := kosuzu.VerifiedPacketFromBytes(test.data, keys)
+
+		if !errors.Is(err, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+
+		_, _, err = kosuzu.ReadVerifiedPacketFrom(bytes.NewReader(test.data), keys)
+
+		if !errors.Is(err, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+
+		packet, err := kosuzu.PacketFromBytes(test.data)
+
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if err := packet.Verify(keys); !errors.Is(err, test.expected) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	keys := kosuzu.Keyring{7: []byte("secret")}
+	packet := kosuzu.NewPacket(42, []byte("suzunaan"))
+	packet.SetCorrelationID(0xdeadbeef)
+	packet.Sign(7, keys[7])
+	packet.SetChecksum(true)
+	data, err := packet.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	length, err := kosuzu.PacketLength(data[:kosuzu.HeaderLength])
+
+	if err != nil || length != int64(len(data)) {
+		t.Fatalf("expected packet length %d, got %d, %v", len(data), length, err)
+	}
+
+	read, err := kosuzu.VerifiedPacketFromBytes(data, keys)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !read.HasCorrelationID() || read.CorrelationID() != 0xdeadbeef ||
+		read.KeyID() != 7 || string(read.Payload()) != "suzunaan" {
+		t.Fatalf("unexpected packet read")
+	}
+
+	// The correlation ID follows the key ID.
+	data[kosuzu.HeaderLength+4] ^= 0x10
+	_, err = kosuzu.PacketFromBytes(data)
+
+	if !errors.Is(err, kosuzu.ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	packet.SetChecksum(false)
+	data, err = packet.Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data[kosuzu.HeaderLength+4] ^= 0x10
+	_, err = kosuzu.VerifiedPacketFromBytes(data, keys)
+
+	if !errors.Is(err, kosuzu.ErrSignatureMismatch) {
+		t.Fatalf("expected signature mismatch, got %v", err)
+	}
+}
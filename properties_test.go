@@ -0,0 +1,114 @@
+package kosuzu_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// checkRoundTrip checks the value of the type of
+// the sample is read back by the decomposer method
+// paired with the builder method.
+func checkRoundTrip(t *testing.T, method string, sample interface{}) {
+	typ := reflect.TypeOf(sample)
+	funcTyp := reflect.FuncOf([]reflect.Type{typ},
+		[]reflect.Type{reflect.TypeOf(true)}, false)
+	property := reflect.MakeFunc(funcTyp, func(args []reflect.Value) []reflect.Value {
+		builder := kosuzu.NewPacketBuilder()
+		results := reflect.ValueOf(builder).MethodByName(method).Call(args)
+
+		if err, _ := results[0].Interface().(error); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		packet := builder.BuildPacket(1)
+		decomposer := kosuzu.NewPacketDecomposer(packet)
+
+		if method == "AddBytes" {
+			results = reflect.ValueOf(decomposer).MethodByName("ReadNBytes").
+				Call([]reflect.Value{reflect.ValueOf(args[0].Len())})
+		} else {
+			results = reflect.ValueOf(decomposer).
+				MethodByName(strings.Replace(method, "Add", "Read", 1)).Call(nil)
+		}
+
+		if err, _ := results[len(results)-1].Interface().(error); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+
+		ok := equalValues(args[0], results[0]) && decomposer.Done() == nil
+		return []reflect.Value{reflect.ValueOf(ok)}
+	})
+
+	err := quick.Check(property.Interface(), nil)
+
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+}
+
+// equalValues reports whether the values are equal
+// treating the nil and empty slices the same.
+func equalValues(expected, actual reflect.Value) bool {
+	if expected.Kind() == reflect.Slice && expected.Len() == 0 {
+		return actual.Len() == 0
+	}
+
+	return reflect.DeepEqual(expected.Interface(), actual.Interface())
+}
+
+func TestBuilderDecomposerProperties(t *testing.T) {
+	for _, vector := range builderVectors {
+		checkRoundTrip(t, vector.method, vector.value)
+	}
+}
+
+func TestSerializeProperties(t *testing.T) {
+	properties := []interface{}{
+		func(value Data) bool {
+			var decoded Data
+			return roundTrip(t, &value, &decoded)
+		},
+		func(value Inventory) bool {
+			var decoded Inventory
+			return roundTrip(t, &value, &decoded)
+		},
+		func(value PlayerMovement) bool {
+			var decoded PlayerMovement
+			return roundTrip(t, &value, &decoded)
+		},
+		func(value ProfilesV2) bool {
+			var decoded ProfilesV2
+			return roundTrip(t, &value, &decoded)
+		},
+	}
+
+	for _, property := range properties {
+		err := quick.Check(property, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// roundTrip serializes the value, reads it
+// into decoded and compares them.
+func roundTrip(t *testing.T, value, decoded interface{}) bool {
+	packet, err := kosuzu.Serialize(1, value)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = kosuzu.DeserializeStrict(packet, decoded)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reflect.DeepEqual(value, decoded)
+}
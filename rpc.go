@@ -0,0 +1,379 @@
+package kosuzu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// ErrorOpcode is the opcode of the error
+// response sent by Server. It must not be
+// used by the application messages.
+const ErrorOpcode int32 = math.MinInt32 + 1
+
+// Error codes sent by Server. The codes
+// of the application errors should be
+// non-negative.
+const (
+	// CodeInternal is sent when the handler
+	// returns the error which is not *RemoteError.
+	CodeInternal int32 = -1 - iota
+	// CodeUnknownRequest is sent when no
+	// handler is registered for the opcode.
+	CodeUnknownRequest
+	// CodeBadRequest is sent when the
+	// request can't be deserialized.
+	CodeBadRequest
+)
+
+// ErrClientClosed is returned by Client.Call
+// when the client stops reading responses
+// because its stream fails.
+var ErrClientClosed = errors.New("rpc client is closed")
+
+// Message is the value serialized
+// with the opcode of its type.
+type Message interface {
+	Opcode() int32
+}
+
+// RemoteError is the error response
+// sent by the server to the client.
+// The handler returns it to send the
+// code and the message of its own.
+type RemoteError struct {
+	Code    int32
+	Message string
+}
+
+// Error returns the description of the error.
+func (err *RemoteError) Error() string {
+	return fmt.Sprintf("remote error %d: %s", err.Code, err.Message)
+}
+
+// Client sends requests over the stream and
+// matches the responses with them by the
+// correlation ID in the packet header.
+type Client struct {
+	stream    io.ReadWriter
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	nextID    uint32
+	pending   map[uint32]chan *Packet
+	done      chan struct{}
+	err       error
+}
+
+// NewClient creates a new client and starts
+// reading the responses from the stream. The
+// client reads until the stream fails, so the
+// stream should be closed to stop the client.
+// Responses to the calls no longer waited for
+// are discarded, as well as the packets with
+// no correlation ID.
+func NewClient(stream io.ReadWriter) *Client {
+	client := &Client{
+		stream:  stream,
+		pending: map[uint32]chan *Packet{},
+		done:    make(chan struct{}),
+	}
+
+	go client.readResponses()
+
+	return client
+}
+
+// Call sends the request and waits for the
+// response to be deserialized into the response
+// value. If the response value is a Message,
+// the opcode of the response must match it.
+// The error response is returned as *RemoteError.
+//
+// The context bounds the wait for the response.
+// Writing the request isn't interrupted by the
+// context, so the stream should have a write
+// deadline if the peer may stop reading.
+func (client *Client) Call(ctx context.Context, request Message, response interface{}) error {
+	packet, err := Serialize(request.Opcode(), request)
+
+	if err != nil {
+		return err
+	}
+
+	reply := make(chan *Packet, 1)
+	client.lock.Lock()
+
+	if client.err != nil {
+		client.lock.Unlock()
+		return client.err
+	}
+
+	id := client.nextID
+	client.nextID++
+
+	for client.pending[id] != nil {
+		id = client.nextID
+		client.nextID++
+	}
+
+	client.pending[id] = reply
+	client.lock.Unlock()
+
+	defer func() {
+		client.lock.Lock()
+		delete(client.pending, id)
+		client.lock.Unlock()
+	}()
+
+	packet.SetCorrelationID(id)
+	client.writeLock.Lock()
+	_, err = packet.WriteTo(client.stream)
+	client.writeLock.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("write request %d: %w", request.Opcode(), err)
+	}
+
+	select {
+	case packet = <-reply:
+
+	case <-ctx.Done():
+		return fmt.Errorf("call %d: %w", request.Opcode(), ctx.Err())
+
+	case <-client.done:
+		return client.err
+	}
+
+	if packet.Opcode == ErrorOpcode {
+		remote := new(RemoteError)
+		err = Deserialize(packet, remote)
+
+		if err != nil {
+			return fmt.Errorf("read error response: %w", err)
+		}
+
+		return remote
+	}
+
+	if msg, ok := response.(Message); ok && msg.Opcode() != packet.Opcode {
+		return fmt.Errorf("expected response opcode %d, got %d",
+			msg.Opcode(), packet.Opcode)
+	}
+
+	return Deserialize(packet, response)
+}
+
+// readResponses passes the responses
+// to the calls waiting for them.
+func (client *Client) readResponses() {
+	for {
+		_, packet, err := ReadPacketFrom(client.stream)
+
+		if err != nil {
+			client.lock.Lock()
+			client.err = fmt.Errorf("%w: %v", ErrClientClosed, err)
+			client.lock.Unlock()
+			close(client.done)
+
+			return
+		}
+
+		if !packet.HasCorrelationID() {
+			continue
+		}
+
+		client.lock.Lock()
+		reply := client.pending[packet.CorrelationID()]
+		delete(client.pending, packet.CorrelationID())
+		client.lock.Unlock()
+
+		if reply != nil {
+			reply <- packet
+		}
+	}
+}
+
+// Handler handles the request
+// and returns the response.
+type Handler func(ctx context.Context, request Message) (Message, error)
+
+// handler is the handler registered
+// along with the type of its requests.
+type handler struct {
+	typ    reflect.Type
+	handle Handler
+}
+
+// Server reads the requests from the stream
+// and calls the handlers registered for their
+// opcodes. The responses are written with the
+// correlation IDs of the requests.
+type Server struct {
+	handlers map[int32]handler
+}
+
+// NewServer creates a new server
+// with no handlers registered.
+func NewServer() *Server {
+	return &Server{
+		handlers: map[int32]handler{},
+	}
+}
+
+// Handle registers the handler for the requests
+// of the type of the given value. The requests
+// are deserialized into the new values of the
+// type and passed to the handler, so the handler
+// can assert the request back to the type.
+func (server *Server) Handle(request Message, handle Handler) error {
+	opcode := request.Opcode()
+
+	if opcode == HandshakeOpcode || opcode == ErrorOpcode {
+		return fmt.Errorf("opcode %d is reserved", opcode)
+	}
+
+	if _, ok := server.handlers[opcode]; ok {
+		return fmt.Errorf("duplicate handler for opcode %d", opcode)
+	}
+
+	server.handlers[opcode] = handler{
+		typ:    reflect.TypeOf(request),
+		handle: handle,
+	}
+
+	return nil
+}
+
+// Serve reads the requests from the stream and
+// handles each of them in its own goroutine until
+// reading fails or the context is done. The handlers
+// get the context canceled when Serve returns. The
+// requests with no correlation ID are not answered.
+//
+// If the stream has the SetDeadline method, like
+// net.Conn, the pending read is interrupted when
+// the context is done. Otherwise the stream must
+// be closed to stop Serve. Serve waits for the
+// handlers to return, so it never writes to the
+// stream after returning.
+func (server *Server) Serve(ctx context.Context, stream io.ReadWriter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var writeLock sync.Mutex
+	var handlers sync.WaitGroup
+
+	defer handlers.Wait()
+	defer cancel()
+
+	if conn, ok := stream.(deadliner); ok {
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.SetDeadline(aLongTimeAgo)
+
+			case <-stop:
+			}
+		}()
+	}
+
+	for {
+		_, packet, err := ReadPacketFrom(stream)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		if !packet.HasCorrelationID() {
+			continue
+		}
+
+		handlers.Add(1)
+
+		go func() {
+			defer handlers.Done()
+
+			response := server.handle(ctx, packet)
+			response.SetCorrelationID(packet.CorrelationID())
+			writeLock.Lock()
+			defer writeLock.Unlock()
+
+			// The failed write breaks the stream,
+			// so the next read reports it.
+			response.WriteTo(stream)
+		}()
+	}
+}
+
+// handle calls the handler of the request
+// and returns the response packet.
+func (server *Server) handle(ctx context.Context, packet *Packet) *Packet {
+	h, ok := server.handlers[packet.Opcode]
+
+	if !ok {
+		return errorPacket(CodeUnknownRequest,
+			fmt.Sprintf("no handler for opcode %d", packet.Opcode))
+	}
+
+	var request reflect.Value
+
+	if h.typ.Kind() == reflect.Ptr {
+		request = reflect.New(h.typ.Elem())
+	} else {
+		request = reflect.New(h.typ)
+	}
+
+	err := Deserialize(packet, request.Interface())
+
+	if err != nil {
+		return errorPacket(CodeBadRequest, err.Error())
+	}
+
+	if h.typ.Kind() != reflect.Ptr {
+		request = request.Elem()
+	}
+
+	response, err := h.handle(ctx, request.Interface().(Message))
+
+	if err != nil {
+		var remote *RemoteError
+
+		if errors.As(err, &remote) {
+			return errorPacket(remote.Code, remote.Message)
+		}
+
+		return errorPacket(CodeInternal, err.Error())
+	}
+
+	if response == nil {
+		return errorPacket(CodeInternal, "handler returned no response")
+	}
+
+	reply, err := Serialize(response.Opcode(), response)
+
+	if err != nil {
+		return errorPacket(CodeInternal, err.Error())
+	}
+
+	return reply
+}
+
+// errorPacket returns the error
+// response with the code and message.
+func errorPacket(code int32, message string) *Packet {
+	packet, _ := Serialize(ErrorOpcode, &RemoteError{
+		Code:    code,
+		Message: message,
+	})
+
+	return packet
+}
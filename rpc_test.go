@@ -0,0 +1,243 @@
+package kosuzu_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type Sum struct {
+	Terms []int32
+}
+
+func (Sum) Opcode() int32 {
+	return 40
+}
+
+type Total struct {
+	Value int32
+}
+
+func (*Total) Opcode() int32 {
+	return 41
+}
+
+type Hang struct {
+	ID int32
+}
+
+func (*Hang) Opcode() int32 {
+	return 42
+}
+
+// rpc starts serving the requests with the server
+// and returns the client connected to it, the client
+// connection and the function stopping the server
+// and returning the error Serve returned.
+func rpc(t *testing.T, server *kosuzu.Server) (*kosuzu.Client, net.Conn, func() error) {
+	clientConn, serverConn := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	var once sync.Once
+	var err error
+
+	go func() {
+		served <- server.Serve(ctx, serverConn)
+	}()
+
+	stop := func() error {
+		once.Do(func() {
+			cancel()
+			err = <-served
+			clientConn.Close()
+			serverConn.Close()
+		})
+
+		return err
+	}
+
+	t.Cleanup(func() { stop() })
+
+	return kosuzu.NewClient(clientConn), clientConn, stop
+}
+
+func sumServer(t *testing.T) *kosuzu.Server {
+	server := kosuzu.NewServer()
+	err := server.Handle(Sum{}, func(ctx context.Context, request kosuzu.Message) (kosuzu.Message, error) {
+		sum := request.(Sum)
+
+		if len(sum.Terms) == 0 {
+			return nil, &kosuzu.RemoteError{Code: 7, Message: "no terms"}
+		}
+
+		total := &Total{}
+
+		for _, term := range sum.Terms {
+			if term < 0 {
+				return nil, errors.New("negative term")
+			}
+
+			total.Value += term
+		}
+
+		return total, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func TestRPC(t *testing.T) {
+	server := sumServer(t)
+
+	if err := server.Handle(Sum{}, nil); err == nil {
+		t.Fatalf("expected error for the duplicate handler")
+	}
+
+	client, _, stop := rpc(t, server)
+	var total Total
+	err := client.Call(context.Background(), Sum{Terms: []int32{1, 2, 3}}, &total)
+
+	if err != nil || total.Value != 6 {
+		t.Fatalf("unexpected response: %+v, %v", total, err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		request kosuzu.Message
+		code    int32
+	}{
+		{"remote error", Sum{}, 7},
+		{"internal error", Sum{Terms: []int32{1, -1}}, kosuzu.CodeInternal},
+		{"unknown request", PlayerMovement{}, kosuzu.CodeUnknownRequest},
+	} {
+		err := client.Call(context.Background(), test.request, &total)
+		var remote *kosuzu.RemoteError
+
+		if !errors.As(err, &remote) || remote.Code != test.code {
+			t.Fatalf("%s: expected remote error %d, got %v", test.name, test.code, err)
+		}
+	}
+
+	err = client.Call(context.Background(), Sum{Terms: []int32{1}}, &Hang{})
+
+	if err == nil {
+		t.Fatalf("expected error for the unexpected response opcode")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	for i := int32(0); i < 16; i++ {
+		wg.Add(1)
+
+		go func(i int32) {
+			defer wg.Done()
+
+			var total Total
+			err := client.Call(context.Background(), Sum{Terms: []int32{i, i}}, &total)
+
+			if err == nil && total.Value != 2*i {
+				err = errors.New("response to another request")
+			}
+
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := stop(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Serve to be canceled, got %v", err)
+	}
+}
+
+func TestRPCContext(t *testing.T) {
+	server := sumServer(t)
+	entered := make(chan int32)
+	release := make(chan struct{})
+	err := server.Handle(&Hang{}, func(ctx context.Context, request kosuzu.Message) (kosuzu.Message, error) {
+		entered <- request.(*Hang).ID
+
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+
+		return &Total{}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, conn, _ := rpc(t, server)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	called := make(chan error, 1)
+
+	go func() {
+		called <- client.Call(ctx, &Hang{ID: 1}, &Total{})
+	}()
+
+	<-entered
+
+	if err := <-called; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+
+	go func() {
+		called <- client.Call(ctx, &Hang{ID: 2}, &Total{})
+	}()
+
+	<-entered
+	cancel()
+
+	if err := <-called; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+
+	// The late responses are discarded.
+	release <- struct{}{}
+	release <- struct{}{}
+	var total Total
+	err = client.Call(context.Background(), Sum{Terms: []int32{4}}, &total)
+
+	if err != nil || total.Value != 4 {
+		t.Fatalf("unexpected response: %+v, %v", total, err)
+	}
+
+	go func() {
+		called <- client.Call(context.Background(), &Hang{ID: 3}, &Total{})
+	}()
+
+	<-entered
+	conn.Close()
+
+	if err := <-called; !errors.Is(err, kosuzu.ErrClientClosed) {
+		t.Fatalf("expected closed client, got %v", err)
+	}
+
+	err = client.Call(context.Background(), Sum{Terms: []int32{4}}, &total)
+
+	if !errors.Is(err, kosuzu.ErrClientClosed) {
+		t.Fatalf("expected closed client, got %v", err)
+	}
+}
@@ -0,0 +1,384 @@
+package kosuzu
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// SchemaOf describes the wire layout Serialize
+// uses for the struct type of the value: its fields
+// in the wire order with their types, struct tags
+// and the opcode returned by the Opcode() int32
+// method if the type has one. The message for the
+// value type comes first, followed by the messages
+// for the nested struct types.
+//
+// The schema can be marshaled with encoding/json,
+// read back with schema.ParseJSON and used to decode
+// the packets with DeserializeMap without the Go types.
+func SchemaOf(value interface{}) (*schema.Schema, error) {
+	return schema.Reflect(value)
+}
+
+// DeserializeMap decodes the packet payload using
+// the schema alone. The message is looked up by its
+// name or, if the name is empty, by the packet opcode.
+//
+// Message values are decoded as map[string]interface{},
+// slices and arrays as []interface{}, maps as
+// map[string]interface{} with the keys formatted
+// like JavaScript formats numbers and booleans,
+// complex numbers as {"re": ..., "im": ...} maps,
+// nil pointers as nil and the other primitives as
+// the Go values of their types, so the result can be
+// marshaled with encoding/json. Enums are decoded as
+// their underlying types, byte as uint8 and rune as
+// int32. The fields of the versioned messages missing
+// in the packet are absent from the map.
+func DeserializeMap(packet *Packet, sch *schema.Schema, message string) (map[string]interface{}, error) {
+	var msg *schema.Message
+
+	if message == "" {
+		for _, candidate := range sch.Messages {
+			if candidate.Opcode != nil && *candidate.Opcode == packet.Opcode {
+				msg = candidate
+				break
+			}
+		}
+
+		if msg == nil {
+			return nil, fmt.Errorf(
+				"no message with opcode %d in the schema", packet.Opcode)
+		}
+	} else {
+		msg = sch.Message(message)
+
+		if msg == nil {
+			return nil, fmt.Errorf("no message %s in the schema", message)
+		}
+	}
+
+	obj, err := readMessage(NewPacketDecomposer(packet), sch, msg)
+
+	if err != nil {
+		return nil, withPath(err, msg.Name)
+	}
+
+	return obj, nil
+}
+
+// ReadMessage reads the message of the schema
+// from the payload the way DeserializeMap does.
+// The paths of the returned *DecodeError start
+// with the field names of the message.
+func (decomposer *Decomposer) ReadMessage(sch *schema.Schema, message *schema.Message) (map[string]interface{}, error) {
+	obj, err := readMessage(decomposer, sch, message)
+
+	if err != nil {
+		var decodeErr *DecodeError
+
+		if errors.As(err, &decodeErr) {
+			decodeErr.Path = strings.TrimPrefix(decodeErr.Path, ".")
+		}
+
+		return nil, err
+	}
+
+	return obj, nil
+}
+
+// readMessage reads the message
+// fields in the wire order.
+func readMessage(decomposer *Decomposer, sch *schema.Schema, message *schema.Message) (map[string]interface{}, error) {
+	obj := make(map[string]interface{}, len(message.Fields))
+	var version uint8
+
+	if message.Version != nil {
+		var err error
+		version, decomposer, err = readVersioned(decomposer)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, field := range message.Fields {
+		if field.Since > version {
+			continue
+		}
+
+		typ, err := schema.ParseType(field.Type)
+
+		if err != nil {
+			return nil, withPath(decomposer.fail(
+				decomposer.offset(), field.Type, err), "."+field.Name)
+		}
+
+		value, err := readSchemaValue(decomposer, sch, typ)
+
+		if err != nil {
+			return nil, withPath(err, "."+field.Name)
+		}
+
+		obj[field.Name] = value
+	}
+
+	return obj, nil
+}
+
+// readSchemaValue reads the value of the
+// schema type the same way Deserialize reads
+// the value of the equivalent Go type.
+func readSchemaValue(decomposer *Decomposer, sch *schema.Schema, typ *schema.Type) (interface{}, error) {
+	switch typ.Kind {
+	case schema.Slice:
+		length, err := decomposer.readLength(
+			decomposer.offset(), typ.String(),
+			decomposer.limits.MaxArrayLength,
+			schemaWireSize(sch, typ.Elem), interfaceSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return readSchemaValues(decomposer, sch, typ.Elem, length)
+
+	case schema.Array:
+		return readSchemaValues(decomposer, sch, typ.Elem, typ.Len)
+
+	case schema.Map:
+		length, err := decomposer.readLength(
+			decomposer.offset(), typ.String(),
+			decomposer.limits.MaxArrayLength,
+			schemaWireSize(sch, typ.Key)+schemaWireSize(sch, typ.Elem),
+			2*interfaceSize)
+
+		if err != nil {
+			return nil, err
+		}
+
+		m := map[string]interface{}{}
+
+		for i := 0; i < length; i++ {
+			key, err := readSchemaValue(decomposer, sch, typ.Key)
+
+			if err != nil {
+				return nil, withPath(err, fmt.Sprintf("[#%d key]", i))
+			}
+
+			str := formatKey(key)
+			val, err := readSchemaValue(decomposer, sch, typ.Elem)
+
+			if err != nil {
+				return nil, withPath(err, fmt.Sprintf("[%s]", str))
+			}
+
+			m[str] = val
+		}
+
+		return m, nil
+
+	case schema.Pointer:
+		present, err := decomposer.ReadBool()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !present {
+			return nil, nil
+		}
+
+		return readSchemaValue(decomposer, sch, typ.Elem)
+	}
+
+	if message := sch.Message(typ.Name); message != nil {
+		return readMessage(decomposer, sch, message)
+	}
+
+	name := typ.Name
+
+	if enum := sch.Enum(name); enum != nil {
+		name = enum.Type
+	}
+
+	switch name {
+	case "bool":
+		return decomposer.ReadBool()
+
+	case "int8":
+		return decomposer.ReadInt8()
+
+	case "byte", "uint8":
+		return decomposer.ReadUint8()
+
+	case "int16":
+		return decomposer.ReadInt16()
+
+	case "uint16":
+		return decomposer.ReadUint16()
+
+	case "rune", "int32":
+		return decomposer.ReadInt32()
+
+	case "uint32":
+		return decomposer.ReadUint32()
+
+	case "int64":
+		return decomposer.ReadInt64()
+
+	case "uint64":
+		return decomposer.ReadUint64()
+
+	case "float32":
+		return decomposer.ReadFloat32()
+
+	case "float64":
+		return decomposer.ReadFloat64()
+
+	case "complex64":
+		val, err := decomposer.ReadComplex64()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return complexValue(complex128(val)), nil
+
+	case "complex128":
+		val, err := decomposer.ReadComplex128()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return complexValue(val), nil
+
+	case "string":
+		return decomposer.ReadString()
+
+	default:
+		return nil, decomposer.fail(decomposer.offset(), typ.String(),
+			fmt.Errorf("unknown type: %s", typ))
+	}
+}
+
+// formatKey returns the map key as the string
+// JavaScript makes the property name of it.
+func formatKey(key interface{}) string {
+	val := reflect.ValueOf(key)
+
+	switch val.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(val.Int(), 10)
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(val.Uint(), 10)
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(val.Float(), 'g', -1, 64)
+
+	case reflect.Bool:
+		return strconv.FormatBool(val.Bool())
+
+	default:
+		return val.String()
+	}
+}
+
+// complexValue returns the complex number
+// as the map encoding/json can marshal.
+func complexValue(val complex128) map[string]interface{} {
+	return map[string]interface{}{
+		"re": real(val),
+		"im": imag(val),
+	}
+}
+
+// interfaceSize is the number of bytes
+// the decoded value takes in the slice
+// or map of the interface{} values.
+var interfaceSize = int64(reflect.TypeOf((*interface{})(nil)).Elem().Size())
+
+// schemaWireSize returns the minimum number
+// of bytes the value of the schema type takes
+// in the packet, like wireSize does for Go types.
+func schemaWireSize(sch *schema.Schema, typ *schema.Type) int64 {
+	switch typ.Kind {
+	case schema.Slice, schema.Map:
+		return 4
+
+	case schema.Pointer:
+		return 1
+
+	case schema.Array:
+		return int64(typ.Len) * schemaWireSize(sch, typ.Elem)
+	}
+
+	if message := sch.Message(typ.Name); message != nil {
+		if message.Version != nil {
+			return 1 + 4
+		}
+
+		var size int64
+
+		for _, field := range message.Fields {
+			fieldType, err := schema.ParseType(field.Type)
+
+			if err == nil {
+				size += schemaWireSize(sch, fieldType)
+			}
+		}
+
+		return size
+	}
+
+	name := typ.Name
+
+	if enum := sch.Enum(name); enum != nil {
+		name = enum.Type
+	}
+
+	switch name {
+	case "bool", "byte", "int8", "uint8":
+		return 1
+
+	case "int16", "uint16":
+		return 2
+
+	case "rune", "int32", "uint32", "float32", "string":
+		return 4
+
+	case "int64", "uint64", "float64", "complex64":
+		return 8
+
+	case "complex128":
+		return 16
+
+	default:
+		return 0
+	}
+}
+
+// readSchemaValues reads the
+// given number of values.
+func readSchemaValues(decomposer *Decomposer, sch *schema.Schema, typ *schema.Type, length int) ([]interface{}, error) {
+	values := []interface{}{}
+
+	for i := 0; i < length; i++ {
+		value, err := readSchemaValue(decomposer, sch, typ)
+
+		if err != nil {
+			return nil, withPath(err, fmt.Sprintf("[%d]", i))
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,367 @@
+package schema
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+// Change is the difference between two versions
+// of the schema that makes the packets encoded with
+// one of them unreadable or misread with the other.
+type Change struct {
+	// Type is the name of the message
+	// or enum the change concerns.
+	Type string
+	// Field is the name of the changed field
+	// or enum value. It's empty if the change
+	// concerns the whole type.
+	Field string
+	// Reason describes the change.
+	Reason string
+}
+
+// String returns the description of the change.
+func (change Change) String() string {
+	if change.Field == "" {
+		return fmt.Sprintf("%s: %s", change.Type, change.Reason)
+	}
+
+	return fmt.Sprintf("%s.%s: %s", change.Type, change.Field, change.Reason)
+}
+
+// Compare returns the breaking changes made in the
+// new version of the schema comparing to the old one:
+// removed messages, removed and changed enum values,
+// changed and reused opcodes, removed, added, reordered
+// and retyped fields. Since the fields are written to
+// the packet one after another without names,
+// adding a field anywhere is a breaking change too,
+// except appending the field added since the newer
+// version to the versioned message.
+//
+// Types are compared by their wire representation,
+// so replacing an integer field with the enum of the
+// same underlying type or byte with uint8 is not
+// reported. Enums are only compared if the fields of
+// the old messages use them, renaming the enum value
+// is not reported either. Both schemas must be valid.
+func Compare(old, new *Schema) []Change {
+	changes := []Change{}
+	used := usedEnums(old)
+
+	for _, enum := range old.Enums {
+		// Removing the enum is only visible on the wire
+		// through the fields that used it, and they are
+		// compared by their wire types below.
+		if !used[enum.Name] || new.Enum(enum.Name) == nil {
+			continue
+		}
+
+		changes = append(changes, compareEnums(enum, new.Enum(enum.Name))...)
+	}
+
+	opcodes := map[int32]string{}
+
+	for _, message := range old.Messages {
+		if message.Opcode != nil {
+			opcodes[*message.Opcode] = message.Name
+		}
+	}
+
+	for _, message := range old.Messages {
+		changes = append(changes,
+			compareMessages(old, new, message, new.Message(message.Name))...)
+	}
+
+	for _, message := range new.Messages {
+		if message.Opcode == nil {
+			continue
+		}
+
+		other, ok := opcodes[*message.Opcode]
+
+		if ok && other != message.Name {
+			changes = append(changes, Change{
+				Type: message.Name,
+				Reason: fmt.Sprintf("opcode %d is reused, it belonged to %s",
+					*message.Opcode, other),
+			})
+		}
+	}
+
+	return changes
+}
+
+// usedEnums returns the names of the
+// enums used by the message fields.
+func usedEnums(schema *Schema) map[string]bool {
+	used := map[string]bool{}
+
+	var visit func(typ *Type)
+	visit = func(typ *Type) {
+		if typ.Key != nil {
+			visit(typ.Key)
+		}
+
+		if typ.Elem != nil {
+			visit(typ.Elem)
+		}
+
+		if typ.Kind == Named && schema.Enum(typ.Name) != nil {
+			used[typ.Name] = true
+		}
+	}
+
+	for _, message := range schema.Messages {
+		for _, field := range message.Fields {
+			typ, err := ParseType(field.Type)
+
+			if err == nil {
+				visit(typ)
+			}
+		}
+	}
+
+	return used
+}
+
+func compareEnums(old, new *Enum) []Change {
+	changes := []Change{}
+	oldNames := map[string]bool{}
+	renamed := map[int64]bool{}
+
+	for _, value := range old.Values {
+		oldNames[value.Name] = true
+	}
+
+	// The values added under the new names
+	// for the old numbers are the renamed ones.
+	for _, value := range new.Values {
+		if !oldNames[value.Name] {
+			renamed[value.Value] = true
+		}
+	}
+
+	for _, value := range old.Values {
+		var found *EnumValue
+
+		for _, candidate := range new.Values {
+			if candidate.Name == value.Name {
+				found = candidate
+				break
+			}
+		}
+
+		switch {
+		case found == nil && renamed[value.Value]:
+
+		case found == nil:
+			changes = append(changes, Change{
+				Type: old.Name, Field: value.Name,
+				Reason: "enum value is removed",
+			})
+
+		case found.Value != value.Value:
+			changes = append(changes, Change{
+				Type: old.Name, Field: value.Name,
+				Reason: fmt.Sprintf("enum value is changed from %d to %d",
+					value.Value, found.Value),
+			})
+		}
+	}
+
+	return changes
+}
+
+func compareMessages(oldSchema, newSchema *Schema, old, new *Message) []Change {
+	if new == nil {
+		return []Change{{Type: old.Name, Reason: "message is removed"}}
+	}
+
+	changes := []Change{}
+
+	switch {
+	case old.Opcode != nil && new.Opcode == nil:
+		changes = append(changes, Change{
+			Type:   old.Name,
+			Reason: fmt.Sprintf("opcode %d is removed", *old.Opcode),
+		})
+
+	case old.Opcode != nil && *old.Opcode != *new.Opcode:
+		changes = append(changes, Change{
+			Type: old.Name,
+			Reason: fmt.Sprintf("opcode is changed from %d to %d",
+				*old.Opcode, *new.Opcode),
+		})
+	}
+
+	versioned := old.Version != nil && new.Version != nil
+
+	switch {
+	case old.Version == nil && new.Version != nil:
+		changes = append(changes, Change{
+			Type: old.Name, Reason: "message is made versioned",
+		})
+
+	case old.Version != nil && new.Version == nil:
+		changes = append(changes, Change{
+			Type: old.Name, Reason: "message is no longer versioned",
+		})
+	}
+
+	oldFields := map[string]*Field{}
+	newFields := map[string]*Field{}
+	common := []string{}
+
+	for _, field := range old.Fields {
+		oldFields[field.Name] = field
+	}
+
+	for _, field := range new.Fields {
+		newFields[field.Name] = field
+	}
+
+	for _, field := range old.Fields {
+		if newFields[field.Name] == nil {
+			changes = append(changes, Change{
+				Type: old.Name, Field: field.Name,
+				Reason: "field is removed",
+			})
+
+			continue
+		}
+
+		common = append(common, field.Name)
+	}
+
+	i := 0
+
+	for _, field := range new.Fields {
+		oldField := oldFields[field.Name]
+
+		if oldField == nil {
+			if versioned && i == len(common) && field.Since > *old.Version {
+				continue
+			}
+
+			changes = append(changes, Change{
+				Type: old.Name, Field: field.Name,
+				Reason: "field is added",
+			})
+
+			continue
+		}
+
+		if common[i] != field.Name {
+			changes = append(changes, Change{
+				Type: old.Name, Field: field.Name,
+				Reason: "field is moved",
+			})
+		}
+
+		i++
+
+		if oldField.Since != field.Since {
+			changes = append(changes, Change{
+				Type: old.Name, Field: field.Name,
+				Reason: fmt.Sprintf("field version is changed from %d to %d",
+					oldField.Since, field.Since),
+			})
+		}
+
+		oldType := wireType(oldSchema, oldField.Type)
+		newType := wireType(newSchema, field.Type)
+
+		if oldType != newType {
+			changes = append(changes, Change{
+				Type: old.Name, Field: field.Name,
+				Reason: fmt.Sprintf("type is changed from %s to %s",
+					oldField.Type, field.Type),
+			})
+		}
+	}
+
+	return changes
+}
+
+// wireType returns the type expression with
+// the enums replaced with their underlying types,
+// byte with uint8 and rune with int32, so the types
+// written the same way have the same expressions.
+func wireType(schema *Schema, expr string) string {
+	typ, err := ParseType(expr)
+
+	if err != nil {
+		return expr
+	}
+
+	var resolve func(typ *Type)
+	resolve = func(typ *Type) {
+		if typ.Key != nil {
+			resolve(typ.Key)
+		}
+
+		if typ.Elem != nil {
+			resolve(typ.Elem)
+		}
+
+		if typ.Kind != Named {
+			return
+		}
+
+		if enum := schema.Enum(typ.Name); enum != nil {
+			typ.Name = enum.Type
+		}
+
+		switch typ.Name {
+		case "byte":
+			typ.Name = "uint8"
+
+		case "rune":
+			typ.Name = "int32"
+		}
+	}
+
+	resolve(typ)
+
+	return typ.String()
+}
+
+// Fingerprint returns the SHA-256 hash of the wire
+// layout of the schema: message names, opcodes and
+// versions and the wire types of the fields in their
+// order. Field names, enum values and the order of
+// the messages don't affect it, so the peers with the
+// same fingerprint encode the messages the same way.
+func (schema *Schema) Fingerprint() [sha256.Size]byte {
+	messages := make([]*Message, len(schema.Messages))
+	copy(messages, schema.Messages)
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Name < messages[j].Name
+	})
+
+	buf := new(bytes.Buffer)
+
+	for _, message := range messages {
+		fmt.Fprintf(buf, "message %s", message.Name)
+
+		if message.Opcode != nil {
+			fmt.Fprintf(buf, " = %d", *message.Opcode)
+		}
+
+		if message.Version != nil {
+			fmt.Fprintf(buf, " version %d", *message.Version)
+		}
+
+		fmt.Fprintf(buf, "\n")
+
+		for _, field := range message.Fields {
+			fmt.Fprintf(buf, "\t%s since %d\n",
+				wireType(schema, field.Type), field.Since)
+		}
+	}
+
+	return sha256.Sum256(buf.Bytes())
+}
@@ -0,0 +1,214 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	old, err := Parse("old", strings.NewReader(`
+enum Team : uint8 {
+	Red = 0
+	Blue = 1
+	Green = 2
+}
+
+message Position {
+	X float64
+	Y float64
+}
+
+message PlayerMovement = 32 {
+	ID int32
+	Team Team
+	Position Position
+	Speed float32
+}
+
+message Chat = 33 {
+	Text string
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same, err := Parse("same", strings.NewReader(`
+message Position {
+	X float64
+	Y float64
+}
+
+message PlayerMovement = 32 {
+	ID int32
+	Team uint8
+	Position Position
+	Speed float32
+}
+
+message Chat = 33 {
+	Text string
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	new, err := Parse("new", strings.NewReader(`
+enum Team : uint8 {
+	Red = 0
+	Blue = 2
+}
+
+message Position {
+	Y float64
+	X float64
+}
+
+message PlayerMovement = 32 {
+	ID int64
+	Team Team
+	Position Position
+	Name string
+}
+
+message Whisper = 33 {
+	Text string
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Compare(same, old)
+
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+
+	expected := []string{
+		"Team.Blue: enum value is changed from 1 to 2",
+		"Team.Green: enum value is removed",
+		"Position.Y: field is moved",
+		"Position.X: field is moved",
+		"PlayerMovement.Speed: field is removed",
+		"PlayerMovement.ID: type is changed from int32 to int64",
+		"PlayerMovement.Name: field is added",
+		"Chat: message is removed",
+		"Whisper: opcode 33 is reused, it belonged to Chat",
+	}
+	changes = Compare(old, new)
+
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+
+	for i, change := range changes {
+		if change.String() != expected[i] {
+			t.Fatalf("change %d: expected %q, got %q", i, expected[i], change)
+		}
+	}
+}
+
+func TestCompareEnums(t *testing.T) {
+	old, err := Parse("old", strings.NewReader(`
+enum Team : uint8 {
+	Red = 0
+	Blue = 1
+	Green = 2
+}
+
+enum Unused : int32 {
+	A = 1
+	B = 2
+}
+
+enum Gone : int16 {
+	C = 1
+}
+
+message Player = 1 {
+	Team Team
+	Teams map[Team]string
+	Rank Gone
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	new, err := Parse("new", strings.NewReader(`
+enum Team : uint8 {
+	Red = 0
+	Azure = 1
+	Yellow = 3
+}
+
+enum Unused : int32 {
+	A = 3
+}
+
+message Player = 1 {
+	Team Team
+	Teams map[Team]string
+	Rank int16
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Compare(old, new)
+
+	if len(changes) != 1 || changes[0].String() != "Team.Green: enum value is removed" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+}
+
+func TestCompareVersioned(t *testing.T) {
+	old, err := ParseJSON("old", strings.NewReader(`{"messages": [
+		{"name": "Profile", "version": 1, "fields": [
+			{"name": "ID", "type": "int32"},
+			{"name": "Name", "type": "string"}
+		]},
+		{"name": "Score", "fields": [{"name": "Value", "type": "int32"}]}
+	]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	new, err := ParseJSON("new", strings.NewReader(`{"messages": [
+		{"name": "Profile", "version": 2, "fields": [
+			{"name": "ID", "type": "int32"},
+			{"name": "Name", "type": "string"},
+			{"name": "Level", "type": "uint16", "since": 2}
+		]},
+		{"name": "Score", "version": 1, "fields": [{"name": "Value", "type": "int32"}]}
+	]}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Compare(old, new)
+
+	if len(changes) != 1 || changes[0].String() != "Score: message is made versioned" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	_, err = ParseJSON("invalid", strings.NewReader(`{"messages": [
+		{"name": "Profile", "version": 1, "fields": [
+			{"name": "Level", "type": "uint16", "since": 2}
+		]}
+	]}`))
+
+	if err == nil {
+		t.Fatalf("expected error for the field added after the message version")
+	}
+}
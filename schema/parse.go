@@ -0,0 +1,506 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// token is a lexical token
+// of the schema source.
+type token struct {
+	text string
+	line int
+	col  int
+}
+
+// parser reads the schema
+// out of the token stream.
+type parser struct {
+	name   string
+	tokens []token
+	pos    int
+}
+
+// Parse reads the schema written in the kosuzu
+// schema language from the reader. The name is
+// used in error messages to identify the source.
+//
+// The schema consists of an optional package
+// clause followed by enum and message declarations:
+//
+//	package game
+//
+//	enum Team : uint8 {
+//		Red = 0
+//		Blue = 1
+//	}
+//
+//	message Position {
+//		X float64
+//		Y float64
+//	}
+//
+//	message PlayerMovement = 32 {
+//		ID int32
+//		Team Team
+//		Position Position
+//		Path []Position
+//		Target *Position
+//	}
+//
+//	message Profile = 33 version 2 {
+//		Name string
+//		Level uint16 since 2
+//	}
+//
+// Field types are written in Go syntax and may refer
+// to other messages declared in the schema. The number
+// after the message name is its opcode. The version
+// makes the message versioned, and the fields added
+// in the later versions are marked with since.
+// Comments start with // and last until the end of the line.
+func Parse(name string, reader io.Reader) (*Schema, error) {
+	data, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenize(name, string(data))
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{
+		name:   name,
+		tokens: tokens,
+	}
+	schema, err := p.parseSchema()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = schema.Validate()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return schema, nil
+}
+
+// ParseJSON reads the schema encoded as JSON, e.g.
+// the one produced by kosuzu.SchemaOf and marshaled
+// with encoding/json. The name is used in error
+// messages to identify the source.
+func ParseJSON(name string, reader io.Reader) (*Schema, error) {
+	schema := new(Schema)
+	err := json.NewDecoder(reader).Decode(schema)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	err = schema.Validate()
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return schema, nil
+}
+
+// ParseFile reads the schema from the file.
+// Files with the .json extension are read
+// with ParseJSON, others with Parse.
+func ParseFile(path string) (*Schema, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(path, file)
+	}
+
+	return Parse(path, file)
+}
+
+func tokenize(name, src string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(src)
+	line, col := 1, 1
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+
+		switch {
+		case c == '\n':
+			line++
+			col = 1
+			i++
+
+		case unicode.IsSpace(c) || c == ';':
+			col++
+			i++
+
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-':
+			start := i
+
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '-' ||
+				unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+
+			tokens = append(tokens, token{
+				text: string(runes[start:i]),
+				line: line,
+				col:  col,
+			})
+			col += i - start
+
+		case strings.ContainsRune("{}[]=:*", c):
+			tokens = append(tokens, token{
+				text: string(c),
+				line: line,
+				col:  col,
+			})
+			col++
+			i++
+
+		default:
+			return nil, fmt.Errorf("%s:%d:%d: unexpected character %q",
+				name, line, col, c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	tok := token{line: 1, col: 1}
+
+	if p.pos < len(p.tokens) {
+		tok = p.tokens[p.pos]
+	} else if len(p.tokens) > 0 {
+		tok = p.tokens[len(p.tokens)-1]
+	}
+
+	return fmt.Errorf("%s:%d:%d: %s", p.name,
+		tok.line, tok.col, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.pos].text
+}
+
+func (p *parser) next() string {
+	text := p.peek()
+	p.pos++
+
+	return text
+}
+
+func (p *parser) expect(text string) error {
+	if p.peek() != text {
+		return p.errorf("expected %q, got %q", text, p.peek())
+	}
+
+	p.pos++
+
+	return nil
+}
+
+func (p *parser) ident() (string, error) {
+	if !isIdent(p.peek()) {
+		return "", p.errorf("expected identifier, got %q", p.peek())
+	}
+
+	return p.next(), nil
+}
+
+func (p *parser) integer(bitSize int) (int64, error) {
+	value, err := strconv.ParseInt(p.peek(), 0, bitSize)
+
+	if err != nil {
+		return 0, p.errorf("expected %d-bit integer, got %q", bitSize, p.peek())
+	}
+
+	p.pos++
+
+	return value, nil
+}
+
+func (p *parser) version() (uint8, error) {
+	value, err := strconv.ParseUint(p.peek(), 0, 8)
+
+	if err != nil {
+		return 0, p.errorf("expected version from 0 to 255, got %q", p.peek())
+	}
+
+	p.pos++
+
+	return uint8(value), nil
+}
+
+func (p *parser) parseSchema() (*Schema, error) {
+	schema := new(Schema)
+
+	if p.peek() == "package" {
+		p.pos++
+		name, err := p.ident()
+
+		if err != nil {
+			return nil, err
+		}
+
+		schema.Package = name
+	}
+
+	for p.pos < len(p.tokens) {
+		switch p.peek() {
+		case "enum":
+			enum, err := p.parseEnum()
+
+			if err != nil {
+				return nil, err
+			}
+
+			schema.Enums = append(schema.Enums, enum)
+
+		case "message":
+			message, err := p.parseMessage()
+
+			if err != nil {
+				return nil, err
+			}
+
+			schema.Messages = append(schema.Messages, message)
+
+		default:
+			return nil, p.errorf(
+				"expected enum or message declaration, got %q", p.peek())
+		}
+	}
+
+	return schema, nil
+}
+
+func (p *parser) parseEnum() (*Enum, error) {
+	p.pos++
+	enum := new(Enum)
+	name, err := p.ident()
+
+	if err != nil {
+		return nil, err
+	}
+
+	enum.Name = name
+	err = p.expect(":")
+
+	if err != nil {
+		return nil, err
+	}
+
+	enum.Type, err = p.ident()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.expect("{")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() != "}" {
+		value := new(EnumValue)
+		value.Name, err = p.ident()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = p.expect("=")
+
+		if err != nil {
+			return nil, err
+		}
+
+		value.Value, err = p.integer(64)
+
+		if err != nil {
+			return nil, err
+		}
+
+		enum.Values = append(enum.Values, value)
+	}
+
+	p.pos++
+
+	return enum, nil
+}
+
+func (p *parser) parseMessage() (*Message, error) {
+	p.pos++
+	message := new(Message)
+	name, err := p.ident()
+
+	if err != nil {
+		return nil, err
+	}
+
+	message.Name = name
+
+	if p.peek() == "=" {
+		p.pos++
+		opcode, err := p.integer(32)
+
+		if err != nil {
+			return nil, err
+		}
+
+		message.Opcode = new(int32)
+		*message.Opcode = int32(opcode)
+	}
+
+	if p.peek() == "version" {
+		p.pos++
+		version, err := p.version()
+
+		if err != nil {
+			return nil, err
+		}
+
+		message.Version = &version
+	}
+
+	err = p.expect("{")
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() != "}" {
+		field := new(Field)
+		field.Name, err = p.ident()
+
+		if err != nil {
+			return nil, err
+		}
+
+		field.Type, err = p.parseType()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.peek() == "since" {
+			p.pos++
+			field.Since, err = p.version()
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		message.Fields = append(message.Fields, field)
+	}
+
+	p.pos++
+
+	return message, nil
+}
+
+func (p *parser) parseType() (string, error) {
+	switch p.peek() {
+	case "[":
+		p.pos++
+		length := ""
+
+		if p.peek() != "]" {
+			n, err := p.integer(32)
+
+			if err != nil {
+				return "", err
+			}
+
+			length = strconv.FormatInt(n, 10)
+		}
+
+		err := p.expect("]")
+
+		if err != nil {
+			return "", err
+		}
+
+		elem, err := p.parseType()
+
+		if err != nil {
+			return "", err
+		}
+
+		return "[" + length + "]" + elem, nil
+
+	case "*":
+		p.pos++
+		elem, err := p.parseType()
+
+		if err != nil {
+			return "", err
+		}
+
+		return "*" + elem, nil
+
+	case "map":
+		p.pos++
+		err := p.expect("[")
+
+		if err != nil {
+			return "", err
+		}
+
+		key, err := p.parseType()
+
+		if err != nil {
+			return "", err
+		}
+
+		err = p.expect("]")
+
+		if err != nil {
+			return "", err
+		}
+
+		elem, err := p.parseType()
+
+		if err != nil {
+			return "", err
+		}
+
+		return "map[" + key + "]" + elem, nil
+	}
+
+	return p.ident()
+}
@@ -0,0 +1,132 @@
+package schema
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	schema, err := Parse("game", strings.NewReader(`
+package game
+
+// The comment.
+enum Team : uint8 {
+	Red = 0
+	Blue = 1
+}
+
+message Position {
+	X float64
+	Y float64
+}
+
+message Profile = 33 version 2 {
+	Name string
+	Team Team
+	Level uint16 since 1
+	Path []Position since 2
+	Owners map[int32]*Position since 2
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profile := schema.Message("Profile")
+
+	if schema.Package != "game" || schema.Enum("Team") == nil || profile == nil {
+		t.Fatalf("unexpected schema: %+v", schema)
+	}
+
+	if *profile.Opcode != 33 || profile.Version == nil || *profile.Version != 2 {
+		t.Fatalf("unexpected message: %+v", profile)
+	}
+
+	expected := []Field{
+		{Name: "Name", Type: "string"},
+		{Name: "Team", Type: "Team"},
+		{Name: "Level", Type: "uint16", Since: 1},
+		{Name: "Path", Type: "[]Position", Since: 2},
+		{Name: "Owners", Type: "map[int32]*Position", Since: 2},
+	}
+
+	for i, field := range profile.Fields {
+		if *field != expected[i] {
+			t.Fatalf("field %d: expected %+v, got %+v", i, expected[i], *field)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		src    string
+		errMsg string
+	}{
+		{"character", "message A { X int32 # }", "1:21: unexpected character '#'"},
+		{"declaration", "struct A {}", `1:1: expected enum or message declaration, got "struct"`},
+		{"message name", "message 1 {}", `expected identifier, got "1"`},
+		{"missing brace", "message A = 1 X int32 }", `expected "{", got "X"`},
+		{"unclosed message", "message A { X int32", `expected identifier, got ""`},
+		{"opcode", "message A = 1x {}", `expected 32-bit integer, got "1x"`},
+		{"opcode overflow", "message A = 2147483648 {}", "expected 32-bit integer"},
+		{"version", "message A version 256 {}", `expected version from 0 to 255, got "256"`},
+		{"since", "message A version 1 { X int32 since -1 }", `expected version from 0 to 255, got "-1"`},
+		{"enum colon", "enum Team uint8 { Red = 0 }", `expected ":", got "uint8"`},
+		{"enum value", "enum Team : uint8 { Red 0 }", `expected "=", got "0"`},
+		{"map", "message A { X map int32 }", `expected "[", got "int32"`},
+		{"array", "message A { X [4 int32 }", `expected "]", got "int32"`},
+		{"duplicate opcode", "message A = 1 {}\nmessage B = 1 {}", "messages A and B have the same opcode 1"},
+		{"duplicate message", "message A {}\nmessage A {}", "duplicate type name: A"},
+		{"duplicate enum", "enum A : int8 {}\nmessage A {}", "duplicate type name: A"},
+		{"duplicate field", "message A { X int32\nX string }", "message A: duplicate field name: X"},
+		{"duplicate value", "enum A : int8 { X = 1\nX = 2 }", "enum A: duplicate value name: X"},
+		{"recursive", "message A { B B }\nmessage B { A A }", "contains itself"},
+		{"self", "message A { A [2]A }", "message A contains itself"},
+		{"unknown type", "message A { X Position }", "message A: field X: unknown type: Position"},
+		{"unknown elem", "message A { X []Position }", "unknown type: Position"},
+		{"map key", "message A { X map[complex64]int32 }", "map key type is not supported: complex64"},
+		{"enum overflow", "enum A : uint8 { X = 256 }", "enum A: value X = 256 overflows uint8"},
+		{"enum underflow", "enum A : int8 { X = -129 }", "enum A: value X = -129 overflows int8"},
+		{"enum type", "enum A : string { X = 1 }", "underlying type must be an integer type"},
+		{"unexported field", "message A { x int32 }", "field name must be an exported identifier"},
+		{"unversioned since", "message A { X int32 since 1 }", "only versioned messages"},
+		{"late since", "message A version 1 { X int32 since 2 }", "added since 2, after the message version 1"},
+		{"misordered since", "message A version 2 { X int32 since 2\nY int32 }", "must follow the fields added since 2"},
+	} {
+		_, err := Parse("test", strings.NewReader(test.src))
+
+		if err == nil || !strings.Contains(err.Error(), test.errMsg) {
+			t.Fatalf("%s: expected error %q, got %v", test.name, test.errMsg, err)
+		}
+	}
+}
+
+func TestParseType(t *testing.T) {
+	for _, expr := range []string{
+		"int32", "[]string", "[4]float64", "map[string][]int32",
+		"*Position", "[2]map[uint8]*[]Position",
+	} {
+		typ, err := ParseType(expr)
+
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+
+		if typ.String() != expr {
+			t.Fatalf("expected %s, got %s", expr, typ)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "[", "[]", "[-1]int32", "[x]int32", "map[string]",
+		"map[]int32", "map[string", "*", "1abc", "int32 int32",
+	} {
+		_, err := ParseType(expr)
+
+		if err == nil {
+			t.Fatalf("%q: expected error", expr)
+		}
+	}
+}
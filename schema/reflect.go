@@ -0,0 +1,231 @@
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// opcoder is implemented by the message types
+// generated by kosuzuc for messages with opcodes.
+type opcoder interface {
+	Opcode() int32
+}
+
+// versioner is implemented by the message
+// types encoded in the versioned format.
+type versioner interface {
+	Version() uint8
+}
+
+// Since returns the version the field of the
+// versioned struct was added in. It's set with
+// the kosuzu:"since=N" tag, fields without
+// the tag or with the empty one are present
+// since version 0.
+func Since(field reflect.StructField) (uint8, error) {
+	tag, ok := field.Tag.Lookup("kosuzu")
+
+	if !ok || strings.TrimSpace(tag) == "" {
+		return 0, nil
+	}
+
+	var since uint8
+
+	for _, option := range strings.Split(tag, ",") {
+		option = strings.TrimSpace(option)
+
+		if !strings.HasPrefix(option, "since=") {
+			return 0, fmt.Errorf("unknown kosuzu tag option: %q", option)
+		}
+
+		version, err := strconv.ParseUint(option[len("since="):], 10, 8)
+
+		if err != nil {
+			return 0, fmt.Errorf("invalid version in the kosuzu tag: %q", option)
+		}
+
+		since = uint8(version)
+	}
+
+	return since, nil
+}
+
+// Reflect builds the schema out of the Go
+// struct values passed to kosuzu.Serialize.
+// Nested struct types are added to the schema
+// as messages as well. Named integer types are
+// described by their underlying types since
+// the values of Go constants are not available
+// through reflection. If the value has
+// the Opcode() int32 method, its result
+// is used as the message opcode, and if it has
+// the Version() uint8 method, the message is
+// versioned.
+func Reflect(values ...interface{}) (*Schema, error) {
+	reflector := &reflector{
+		schema: new(Schema),
+		types:  map[string]reflect.Type{},
+	}
+
+	for _, value := range values {
+		typ := reflect.TypeOf(value)
+
+		if typ == nil {
+			return nil, fmt.Errorf("cannot reflect nil value")
+		}
+
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		if typ.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("message must be a struct, got %v", typ)
+		}
+
+		_, err := reflector.message(typ)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := reflector.schema.Validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reflector.schema, nil
+}
+
+// reflector collects the messages
+// for the struct types it visits.
+type reflector struct {
+	schema *Schema
+	types  map[string]reflect.Type
+}
+
+// message adds the struct type to the
+// schema and returns the message name.
+func (r *reflector) message(typ reflect.Type) (string, error) {
+	name := typ.Name()
+
+	if name == "" {
+		return "", fmt.Errorf("anonymous structs are not supported: %v", typ)
+	}
+
+	if known, ok := r.types[name]; ok {
+		if known != typ {
+			return "", fmt.Errorf(
+				"different types have the same name: %v and %v", known, typ)
+		}
+
+		return name, nil
+	}
+
+	r.types[name] = typ
+	message := &Message{
+		Name: name,
+	}
+	r.schema.Messages = append(r.schema.Messages, message)
+
+	if opcoder, ok := reflect.New(typ).Interface().(opcoder); ok {
+		message.Opcode = new(int32)
+		*message.Opcode = opcoder.Opcode()
+	}
+
+	if versioner, ok := reflect.New(typ).Interface().(versioner); ok {
+		message.Version = new(uint8)
+		*message.Version = versioner.Version()
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldType, err := r.typeExpr(field.Type)
+
+		if err != nil {
+			return "", fmt.Errorf("%v: field %s: %w", typ, field.Name, err)
+		}
+
+		since, err := Since(field)
+
+		if err != nil {
+			return "", fmt.Errorf("%v: field %s: %w", typ, field.Name, err)
+		}
+
+		message.Fields = append(message.Fields, &Field{
+			Name:  field.Name,
+			Type:  fieldType,
+			Tag:   string(field.Tag),
+			Since: since,
+		})
+	}
+
+	return name, nil
+}
+
+// typeExpr returns the schema type
+// expression for the Go type using the
+// same rules as kosuzu.Serialize.
+func (r *reflector) typeExpr(typ reflect.Type) (string, error) {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int8, reflect.Uint8,
+		reflect.Int16, reflect.Uint16,
+		reflect.Int32, reflect.Uint32,
+		reflect.Int64, reflect.Uint64,
+		reflect.Float32, reflect.Float64,
+		reflect.Complex64, reflect.Complex128:
+		return typ.Kind().String(), nil
+
+	case reflect.Slice:
+		elem, err := r.typeExpr(typ.Elem())
+
+		if err != nil {
+			return "", err
+		}
+
+		return "[]" + elem, nil
+
+	case reflect.Array:
+		elem, err := r.typeExpr(typ.Elem())
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("[%d]%s", typ.Len(), elem), nil
+
+	case reflect.Map:
+		key, err := r.typeExpr(typ.Key())
+
+		if err != nil {
+			return "", err
+		}
+
+		elem, err := r.typeExpr(typ.Elem())
+
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("map[%s]%s", key, elem), nil
+
+	case reflect.Ptr:
+		elem, err := r.typeExpr(typ.Elem())
+
+		if err != nil {
+			return "", err
+		}
+
+		return "*" + elem, nil
+
+	case reflect.Struct:
+		return r.message(typ)
+
+	default:
+		return "", fmt.Errorf("the field type is unsupported: %v", typ)
+	}
+}
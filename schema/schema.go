@@ -0,0 +1,521 @@
+// Package schema describes the layout of kosuzu
+// network messages in a language-independent way.
+// Field order in the schema is the wire order, so
+// the described messages are encoded exactly like
+// the equivalent Go structs passed to kosuzu.Serialize.
+package schema
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// primitives contains the names of the types
+// supported by kosuzu Builder and Decomposer.
+var primitives = map[string]bool{
+	"bool":       true,
+	"byte":       true,
+	"rune":       true,
+	"int8":       true,
+	"uint8":      true,
+	"int16":      true,
+	"uint16":     true,
+	"int32":      true,
+	"uint32":     true,
+	"int64":      true,
+	"uint64":     true,
+	"float32":    true,
+	"float64":    true,
+	"complex64":  true,
+	"complex128": true,
+	"string":     true,
+}
+
+// integers contains the names of the types
+// that can be used as enum underlying types
+// along with their value ranges.
+var integers = map[string][2]int64{
+	"byte":   {0, 1<<8 - 1},
+	"int8":   {-1 << 7, 1<<7 - 1},
+	"uint8":  {0, 1<<8 - 1},
+	"int16":  {-1 << 15, 1<<15 - 1},
+	"uint16": {0, 1<<16 - 1},
+	"int32":  {-1 << 31, 1<<31 - 1},
+	"uint32": {0, 1<<32 - 1},
+	"int64":  {-1 << 63, 1<<63 - 1},
+	"uint64": {0, 1<<63 - 1},
+}
+
+// IsPrimitive returns true if the type
+// with the given name is a primitive type.
+func IsPrimitive(name string) bool {
+	return primitives[name]
+}
+
+// TypeKind is the kind of the type expression.
+type TypeKind int
+
+const (
+	// Named is a primitive, enum or message type.
+	Named TypeKind = iota
+	// Slice is a sequence of values
+	// prefixed with its int32 length.
+	Slice
+	// Array is a sequence of values
+	// of the fixed length.
+	Array
+	// Map is a sequence of key-value
+	// pairs prefixed with its int32 length
+	// and sorted by keys.
+	Map
+	// Pointer is an optional value
+	// prefixed with a bool telling
+	// if the value is present.
+	Pointer
+)
+
+// Type is the parsed type expression
+// of the message field.
+type Type struct {
+	Kind TypeKind
+	// Name is the name of the named type.
+	Name string
+	// Len is the length of the array.
+	Len int
+	// Key is the key type of the map.
+	Key *Type
+	// Elem is the element type of the slice,
+	// array or map, or the type the pointer
+	// points to.
+	Elem *Type
+}
+
+// String returns the type expression.
+func (typ *Type) String() string {
+	switch typ.Kind {
+	case Slice:
+		return "[]" + typ.Elem.String()
+
+	case Array:
+		return fmt.Sprintf("[%d]%s", typ.Len, typ.Elem)
+
+	case Map:
+		return fmt.Sprintf("map[%s]%s", typ.Key, typ.Elem)
+
+	case Pointer:
+		return "*" + typ.Elem.String()
+
+	default:
+		return typ.Name
+	}
+}
+
+// ParseType parses the type expression written
+// in Go syntax, e.g. "int32", "[]float64", "[4]byte",
+// "map[string]Item" or "*Position".
+func ParseType(expr string) (*Type, error) {
+	expr = strings.TrimSpace(expr)
+
+	switch {
+	case strings.HasPrefix(expr, "[]"):
+		elem, err := ParseType(expr[2:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Type{Kind: Slice, Elem: elem}, nil
+
+	case strings.HasPrefix(expr, "["):
+		end := strings.Index(expr, "]")
+
+		if end < 0 {
+			return nil, fmt.Errorf("invalid type expression: %q", expr)
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(expr[1:end]))
+
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid array length: %q", expr)
+		}
+
+		elem, err := ParseType(expr[end+1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Type{Kind: Array, Len: length, Elem: elem}, nil
+
+	case strings.HasPrefix(expr, "map["):
+		depth := 0
+		end := -1
+
+		for i := 3; i < len(expr) && end < 0; i++ {
+			switch expr[i] {
+			case '[':
+				depth++
+
+			case ']':
+				depth--
+
+				if depth == 0 {
+					end = i
+				}
+			}
+		}
+
+		if end < 0 {
+			return nil, fmt.Errorf("invalid type expression: %q", expr)
+		}
+
+		key, err := ParseType(expr[4:end])
+
+		if err != nil {
+			return nil, err
+		}
+
+		elem, err := ParseType(expr[end+1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Type{Kind: Map, Key: key, Elem: elem}, nil
+
+	case strings.HasPrefix(expr, "*"):
+		elem, err := ParseType(expr[1:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Type{Kind: Pointer, Elem: elem}, nil
+	}
+
+	if !isIdent(expr) {
+		return nil, fmt.Errorf("invalid type expression: %q", expr)
+	}
+
+	return &Type{Kind: Named, Name: expr}, nil
+}
+
+// Schema describes the messages
+// exchanged through the network.
+type Schema struct {
+	Package  string     `json:"package,omitempty"`
+	Enums    []*Enum    `json:"enums,omitempty"`
+	Messages []*Message `json:"messages"`
+}
+
+// Enum is a named integer type
+// with a set of named values.
+type Enum struct {
+	Name   string       `json:"name"`
+	Type   string       `json:"type"`
+	Values []*EnumValue `json:"values"`
+}
+
+// EnumValue is a named value of the enum.
+type EnumValue struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// Message is a struct type sent
+// through the network in a packet.
+type Message struct {
+	Name string `json:"name"`
+	// Opcode identifies the message in the
+	// network packet. It's nil if the message
+	// has no opcode assigned.
+	Opcode *int32 `json:"opcode,omitempty"`
+	// Version is the version of the message
+	// encoded in the versioned format: the version
+	// byte and the int32 length precede the fields,
+	// so the readers of the other versions can skip
+	// unknown fields and leave missing ones zero.
+	// It's nil if the message is not versioned.
+	Version *uint8   `json:"version,omitempty"`
+	Fields  []*Field `json:"fields"`
+}
+
+// Field is a message field.
+// Fields are written to the packet
+// in the order they are declared.
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Tag is the tag of the Go struct field
+	// the field was reflected from. It doesn't
+	// affect the encoding.
+	Tag string `json:"tag,omitempty"`
+	// Since is the version of the versioned
+	// message the field was added in.
+	Since uint8 `json:"since,omitempty"`
+}
+
+// Enum returns the enum with the given
+// name or nil if there's no such enum.
+func (schema *Schema) Enum(name string) *Enum {
+	for _, enum := range schema.Enums {
+		if enum.Name == name {
+			return enum
+		}
+	}
+
+	return nil
+}
+
+// Message returns the message with the given
+// name or nil if there's no such message.
+func (schema *Schema) Message(name string) *Message {
+	for _, message := range schema.Messages {
+		if message.Name == name {
+			return message
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the schema for duplicate
+// names and opcodes and for the field types
+// not supported by the kosuzu wire format.
+func (schema *Schema) Validate() error {
+	names := map[string]bool{}
+
+	for _, enum := range schema.Enums {
+		if names[enum.Name] {
+			return fmt.Errorf("duplicate type name: %s", enum.Name)
+		}
+
+		names[enum.Name] = true
+		err := enum.validate()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	opcodes := map[int32]string{}
+
+	for _, message := range schema.Messages {
+		if names[message.Name] {
+			return fmt.Errorf("duplicate type name: %s", message.Name)
+		}
+
+		names[message.Name] = true
+
+		if message.Opcode != nil {
+			if other, ok := opcodes[*message.Opcode]; ok {
+				return fmt.Errorf(
+					"messages %s and %s have the same opcode %d",
+					other, message.Name, *message.Opcode)
+			}
+
+			opcodes[*message.Opcode] = message.Name
+		}
+
+		err := schema.validateMessage(message)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, message := range schema.Messages {
+		err := schema.checkRecursion(message, map[string]bool{})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (enum *Enum) validate() error {
+	if !isIdent(enum.Name) || IsPrimitive(enum.Name) {
+		return fmt.Errorf("invalid enum name: %q", enum.Name)
+	}
+
+	limits, ok := integers[enum.Type]
+
+	if !ok {
+		return fmt.Errorf(
+			"enum %s: underlying type must be an integer type, got %s",
+			enum.Name, enum.Type)
+	}
+
+	names := map[string]bool{}
+
+	for _, value := range enum.Values {
+		if !isIdent(value.Name) {
+			return fmt.Errorf("enum %s: invalid value name: %q",
+				enum.Name, value.Name)
+		}
+
+		if names[value.Name] {
+			return fmt.Errorf("enum %s: duplicate value name: %s",
+				enum.Name, value.Name)
+		}
+
+		names[value.Name] = true
+
+		if value.Value < limits[0] || value.Value > limits[1] {
+			return fmt.Errorf("enum %s: value %s = %d overflows %s",
+				enum.Name, value.Name, value.Value, enum.Type)
+		}
+	}
+
+	return nil
+}
+
+func (schema *Schema) validateMessage(message *Message) error {
+	if !isIdent(message.Name) || IsPrimitive(message.Name) {
+		return fmt.Errorf("invalid message name: %q", message.Name)
+	}
+
+	names := map[string]bool{}
+	var since uint8
+
+	for _, field := range message.Fields {
+		if !isExported(field.Name) {
+			return fmt.Errorf(
+				"message %s: field name must be an exported identifier: %q",
+				message.Name, field.Name)
+		}
+
+		if names[field.Name] {
+			return fmt.Errorf("message %s: duplicate field name: %s",
+				message.Name, field.Name)
+		}
+
+		names[field.Name] = true
+
+		switch {
+		case message.Version == nil && field.Since != 0:
+			return fmt.Errorf(
+				"message %s: field %s: only versioned messages can have fields added since a version",
+				message.Name, field.Name)
+
+		case message.Version != nil && field.Since > *message.Version:
+			return fmt.Errorf(
+				"message %s: field %s: added since %d, after the message version %d",
+				message.Name, field.Name, field.Since, *message.Version)
+
+		case field.Since < since:
+			return fmt.Errorf(
+				"message %s: field %s: added since %d must follow the fields added since %d",
+				message.Name, field.Name, field.Since, since)
+		}
+
+		since = field.Since
+		typ, err := ParseType(field.Type)
+
+		if err != nil {
+			return fmt.Errorf("message %s: field %s: %w",
+				message.Name, field.Name, err)
+		}
+
+		err = schema.checkFieldType(typ)
+
+		if err != nil {
+			return fmt.Errorf("message %s: field %s: %w",
+				message.Name, field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkFieldType returns an error if the
+// type cannot be written to the packet.
+func (schema *Schema) checkFieldType(typ *Type) error {
+	switch typ.Kind {
+	case Slice, Array, Pointer:
+		return schema.checkFieldType(typ.Elem)
+
+	case Map:
+		if typ.Key.Kind != Named || !schema.IsOrdered(typ.Key.Name) {
+			return fmt.Errorf("map key type is not supported: %s", typ.Key)
+		}
+
+		return schema.checkFieldType(typ.Elem)
+
+	default:
+		if IsPrimitive(typ.Name) || schema.Enum(typ.Name) != nil ||
+			schema.Message(typ.Name) != nil {
+			return nil
+		}
+
+		return fmt.Errorf("unknown type: %s", typ)
+	}
+}
+
+// IsOrdered returns true if the named type
+// can be used as a map key: booleans, integers,
+// floats, strings and enums.
+func (schema *Schema) IsOrdered(name string) bool {
+	if schema.Enum(name) != nil {
+		return true
+	}
+
+	return IsPrimitive(name) && name != "complex64" && name != "complex128"
+}
+
+// checkRecursion returns an error if the message
+// contains itself without a slice, map or pointer
+// in between, so it would take infinite space.
+func (schema *Schema) checkRecursion(message *Message, visiting map[string]bool) error {
+	if visiting[message.Name] {
+		return fmt.Errorf("message %s contains itself", message.Name)
+	}
+
+	visiting[message.Name] = true
+
+	for _, field := range message.Fields {
+		typ, err := ParseType(field.Type)
+
+		if err != nil {
+			return err
+		}
+
+		for typ.Kind == Array {
+			typ = typ.Elem
+		}
+
+		if nested := schema.Message(typ.Name); typ.Kind == Named && nested != nil {
+			err = schema.checkRecursion(nested, visiting)
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	delete(visiting, message.Name)
+
+	return nil
+}
+
+func isIdent(str string) bool {
+	if str == "" {
+		return false
+	}
+
+	for i, c := range str {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			i > 0 && c >= '0' && c <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isExported(str string) bool {
+	return isIdent(str) && str[0] >= 'A' && str[0] <= 'Z'
+}
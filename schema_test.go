@@ -0,0 +1,214 @@
+package kosuzu_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+	"github.com/zergon321/kosuzu/schema"
+)
+
+type Team uint8
+
+type Position struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type PlayerMovement struct {
+	ID       int32 `json:"id"`
+	Team     Team
+	Name     string
+	Position Position
+	Path     []Position
+	Target   *Position
+	Missing  *Position
+	Scores   map[string]uint16
+	Color    [3]byte
+	Phase    complex64
+}
+
+func (PlayerMovement) Opcode() int32 {
+	return 32
+}
+
+func TestSchemaOf(t *testing.T) {
+	sch, err := kosuzu.SchemaOf(&PlayerMovement{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := sch.Messages[0]
+
+	if message.Name != "PlayerMovement" || message.Opcode == nil || *message.Opcode != 32 {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+
+	expected := []schema.Field{
+		{Name: "ID", Type: "int32", Tag: `json:"id"`},
+		{Name: "Team", Type: "uint8"},
+		{Name: "Name", Type: "string"},
+		{Name: "Position", Type: "Position"},
+		{Name: "Path", Type: "[]Position"},
+		{Name: "Target", Type: "*Position"},
+		{Name: "Missing", Type: "*Position"},
+		{Name: "Scores", Type: "map[string]uint16"},
+		{Name: "Color", Type: "[3]uint8"},
+		{Name: "Phase", Type: "complex64"},
+	}
+
+	if len(message.Fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %d", len(expected), len(message.Fields))
+	}
+
+	for i, field := range message.Fields {
+		if *field != expected[i] {
+			t.Fatalf("field %d: expected %+v, got %+v", i, expected[i], *field)
+		}
+	}
+}
+
+func TestDeserializeMap(t *testing.T) {
+	movement := &PlayerMovement{
+		ID:       7,
+		Team:     2,
+		Name:     "reimu",
+		Position: Position{X: 1.5, Y: -2},
+		Path:     []Position{{X: 1}, {Y: 2}},
+		Target:   &Position{X: 3, Y: 4},
+		Scores:   map[string]uint16{"b": 2, "a": 1},
+		Color:    [3]byte{255, 128, 0},
+		Phase:    1 + 2i,
+	}
+	packet, err := kosuzu.Serialize(movement.Opcode(), movement)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err := kosuzu.SchemaOf(movement)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(sch)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sch, err = schema.ParseJSON("schema.json", bytes.NewReader(data))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := kosuzu.DeserializeMap(packet, sch, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"ID":       int32(7),
+		"Team":     uint8(2),
+		"Name":     "reimu",
+		"Position": map[string]interface{}{"X": 1.5, "Y": -2.0},
+		"Path": []interface{}{
+			map[string]interface{}{"X": 1.0, "Y": 0.0},
+			map[string]interface{}{"X": 0.0, "Y": 2.0},
+		},
+		"Target":  map[string]interface{}{"X": 3.0, "Y": 4.0},
+		"Missing": nil,
+		"Scores":  map[string]interface{}{"a": uint16(1), "b": uint16(2)},
+		"Color":   []interface{}{uint8(255), uint8(128), uint8(0)},
+		"Phase":   map[string]interface{}{"re": 1.0, "im": 2.0},
+	}
+
+	if !reflect.DeepEqual(obj, expected) {
+		t.Fatalf("expected %v, got %v", expected, obj)
+	}
+
+	_, err = json.Marshal(obj)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = kosuzu.DeserializeMap(kosuzu.NewPacket(33, packet.Payload()), sch, "")
+
+	if err == nil {
+		t.Fatalf("expected error for the unknown opcode")
+	}
+
+	_, err = kosuzu.DeserializeMap(kosuzu.NewPacket(32, packet.Payload()[:5]), sch, "PlayerMovement")
+
+	if err == nil {
+		t.Fatalf("expected error for the truncated payload")
+	}
+}
+
+func TestReadMessageKeys(t *testing.T) {
+	sch, err := schema.Parse("keys", strings.NewReader(`
+message Keys {
+	Numbers map[int64]string
+	Floats map[float32]bool
+	Flags map[bool]uint8
+}
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := kosuzu.NewPacketBuilder()
+	builder.AddInt32(2)
+	builder.AddInt64(-1 << 40)
+	builder.AddString("low")
+	builder.AddInt64(3)
+	builder.AddString("three")
+	builder.AddInt32(1)
+	builder.AddFloat32(0.5)
+	builder.AddBool(true)
+	builder.AddInt32(1)
+	builder.AddBool(false)
+	builder.AddUint8(9)
+	decomposer := kosuzu.NewPacketDecomposer(builder.BuildPacket(1))
+	obj, err := decomposer.ReadMessage(sch, sch.Message("Keys"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"Flags":{"false":9},"Floats":{"0.5":true},` +
+		`"Numbers":{"-1099511627776":"low","3":"three"}}`
+
+	if string(data) != expected {
+		t.Fatalf("expected %s, got %s", expected, data)
+	}
+
+	builder = kosuzu.NewPacketBuilder()
+	builder.AddInt32(1)
+	builder.AddInt64(3)
+	builder.AddInt32(10)
+	decomposer = kosuzu.NewPacketDecomposer(builder.BuildPacket(1))
+	_, err = decomposer.ReadMessage(sch, sch.Message("Keys"))
+	var decodeErr *kosuzu.DecodeError
+
+	if !errors.As(err, &decodeErr) || decodeErr.Path != "Numbers[3]" ||
+		!errors.Is(err, kosuzu.ErrTruncated) {
+		t.Fatalf("expected truncated Numbers[3], got %v", err)
+	}
+}
@@ -0,0 +1,379 @@
+// Code generated by kosuzuc. DO NOT EDIT.
+
+package kosuzu_test
+
+import (
+	"fmt"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// Message opcodes.
+const (
+	OpcodeBenchSmall  int32 = 101
+	OpcodeBenchMedium int32 = 102
+	OpcodeBenchLarge  int32 = 103
+)
+
+type BenchSmall struct {
+	ID    int32
+	X     float64
+	Y     float64
+	Alive bool
+}
+
+// Build writes the BenchSmall fields to the packet builder.
+func (msg *BenchSmall) Build(builder *kosuzu.Builder) error {
+	var err error
+
+	err = builder.AddInt32(msg.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.X)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.Y)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddBool(msg.Alive)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Decompose reads the BenchSmall fields from the packet decomposer.
+func (msg *BenchSmall) Decompose(decomposer *kosuzu.Decomposer) error {
+	var err error
+
+	msg.ID, err = decomposer.ReadInt32()
+
+	if err != nil {
+		return err
+	}
+
+	msg.X, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Y, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Alive, err = decomposer.ReadBool()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Opcode returns the opcode of the BenchSmall packet.
+func (msg *BenchSmall) Opcode() int32 {
+	return OpcodeBenchSmall
+}
+
+// Serialize creates a new BenchSmall packet.
+func (msg *BenchSmall) Serialize() (*kosuzu.Packet, error) {
+	builder := kosuzu.NewPacketBuilder()
+	err := msg.Build(builder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.BuildPacket(OpcodeBenchSmall), nil
+}
+
+// Deserialize reads the BenchSmall from the packet.
+func (msg *BenchSmall) Deserialize(packet *kosuzu.Packet) error {
+	if packet.Opcode != OpcodeBenchSmall {
+		return fmt.Errorf("expected opcode %d, got %d", OpcodeBenchSmall, packet.Opcode)
+	}
+
+	return msg.Decompose(kosuzu.NewPacketDecomposer(packet))
+}
+
+type BenchMedium struct {
+	ID        int32
+	Name      string
+	Health    uint16
+	X         float64
+	Y         float64
+	Path      []float32
+	Inventory []int32
+	Avatar    []byte
+}
+
+// Build writes the BenchMedium fields to the packet builder.
+func (msg *BenchMedium) Build(builder *kosuzu.Builder) error {
+	var err error
+
+	err = builder.AddInt32(msg.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddString(msg.Name)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddUint16(msg.Health)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.X)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64(msg.Y)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat32Array(msg.Path)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddInt32Array(msg.Inventory)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddByteArray(msg.Avatar)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Decompose reads the BenchMedium fields from the packet decomposer.
+func (msg *BenchMedium) Decompose(decomposer *kosuzu.Decomposer) error {
+	var err error
+
+	msg.ID, err = decomposer.ReadInt32()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Name, err = decomposer.ReadString()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Health, err = decomposer.ReadUint16()
+
+	if err != nil {
+		return err
+	}
+
+	msg.X, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Y, err = decomposer.ReadFloat64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Path, err = decomposer.ReadFloat32Array()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Inventory, err = decomposer.ReadInt32Array()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Avatar, err = decomposer.ReadByteArray()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Opcode returns the opcode of the BenchMedium packet.
+func (msg *BenchMedium) Opcode() int32 {
+	return OpcodeBenchMedium
+}
+
+// Serialize creates a new BenchMedium packet.
+func (msg *BenchMedium) Serialize() (*kosuzu.Packet, error) {
+	builder := kosuzu.NewPacketBuilder()
+	err := msg.Build(builder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.BuildPacket(OpcodeBenchMedium), nil
+}
+
+// Deserialize reads the BenchMedium from the packet.
+func (msg *BenchMedium) Deserialize(packet *kosuzu.Packet) error {
+	if packet.Opcode != OpcodeBenchMedium {
+		return fmt.Errorf("expected opcode %d, got %d", OpcodeBenchMedium, packet.Opcode)
+	}
+
+	return msg.Decompose(kosuzu.NewPacketDecomposer(packet))
+}
+
+type BenchLarge struct {
+	ID       int64
+	Label    string
+	Samples  []float64
+	Counters []uint32
+	Phases   []complex64
+	Blob     []byte
+}
+
+// Build writes the BenchLarge fields to the packet builder.
+func (msg *BenchLarge) Build(builder *kosuzu.Builder) error {
+	var err error
+
+	err = builder.AddInt64(msg.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddString(msg.Label)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddFloat64Array(msg.Samples)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddUint32Array(msg.Counters)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddComplex64Array(msg.Phases)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddByteArray(msg.Blob)
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Decompose reads the BenchLarge fields from the packet decomposer.
+func (msg *BenchLarge) Decompose(decomposer *kosuzu.Decomposer) error {
+	var err error
+
+	msg.ID, err = decomposer.ReadInt64()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Label, err = decomposer.ReadString()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Samples, err = decomposer.ReadFloat64Array()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Counters, err = decomposer.ReadUint32Array()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Phases, err = decomposer.ReadComplex64Array()
+
+	if err != nil {
+		return err
+	}
+
+	msg.Blob, err = decomposer.ReadByteArray()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Opcode returns the opcode of the BenchLarge packet.
+func (msg *BenchLarge) Opcode() int32 {
+	return OpcodeBenchLarge
+}
+
+// Serialize creates a new BenchLarge packet.
+func (msg *BenchLarge) Serialize() (*kosuzu.Packet, error) {
+	builder := kosuzu.NewPacketBuilder()
+	err := msg.Build(builder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return builder.BuildPacket(OpcodeBenchLarge), nil
+}
+
+// Deserialize reads the BenchLarge from the packet.
+func (msg *BenchLarge) Deserialize(packet *kosuzu.Packet) error {
+	if packet.Opcode != OpcodeBenchLarge {
+		return fmt.Errorf("expected opcode %d, got %d", OpcodeBenchLarge, packet.Opcode)
+	}
+
+	return msg.Decompose(kosuzu.NewPacketDecomposer(packet))
+}
@@ -1,6 +1,11 @@
 package kosuzu_test
 
+//go:generate go run github.com/zergon321/kosuzu/cmd/kosuzuc -o serialize-benchmark-messages_test.go testdata/benchmark.kosuzu
+
 import (
+	"bytes"
+	"net"
+	"reflect"
 	"testing"
 
 	"github.com/zergon321/kosuzu"
@@ -12,74 +17,331 @@ type Choice struct {
 	Parameters []complex128
 }
 
-func BenchmarkSerializeReflect(b *testing.B) {
-	choice := &Choice{
-		Parameter:  34,
-		Numbers:    []int64{13, 14, 15, 16, 18},
-		Parameters: []complex128{2 + 3i, 3 + 1i, 2 + 5i},
-	}
+// benchMessage is implemented by the
+// messages generated from benchmark.kosuzu.
+type benchMessage interface {
+	Build(builder *kosuzu.Builder) error
+	Decompose(decomposer *kosuzu.Decomposer) error
+	Opcode() int32
+	Serialize() (*kosuzu.Packet, error)
+	Deserialize(packet *kosuzu.Packet) error
+}
 
-	kosuzu.Serialize(18, choice)
+// benchCase is the message encoded by
+// the reflective, manual and generated codecs.
+type benchCase struct {
+	name  string
+	value benchMessage
+	// empty returns the new message
+	// to read the packet into.
+	empty func() benchMessage
+	// build and decompose are the
+	// codec written by hand.
+	build     func(builder *kosuzu.Builder, msg benchMessage)
+	decompose func(decomposer *kosuzu.Decomposer) benchMessage
 }
 
-func BenchmarkSerializeCustom(b *testing.B) {
-	serialize := func(opcode int32, choice *Choice) *kosuzu.Packet {
-		builder := kosuzu.NewPacketBuilder()
+func benchCases() []benchCase {
+	medium := &BenchMedium{
+		ID:        132,
+		Name:      "Motoori Kosuzu",
+		Health:    100,
+		X:         116.198,
+		Y:         20.07,
+		Path:      make([]float32, 32),
+		Inventory: make([]int32, 16),
+		Avatar:    make([]byte, 256),
+	}
+	large := &BenchLarge{
+		ID:       1 << 40,
+		Label:    "Suzunaan",
+		Samples:  make([]float64, 4096),
+		Counters: make([]uint32, 4096),
+		Phases:   make([]complex64, 1024),
+		Blob:     make([]byte, 64<<10),
+	}
 
-		builder.AddInt32(choice.Parameter)
-		builder.AddInt64Array(choice.Numbers)
-		builder.AddComplex128Array(choice.Parameters)
+	for i := range large.Samples {
+		large.Samples[i] = float64(i) / 3
+		large.Counters[i] = uint32(i * i)
+	}
 
-		return builder.BuildPacket(opcode)
+	for i := range large.Phases {
+		large.Phases[i] = complex(float32(i), -float32(i))
 	}
 
-	choice := &Choice{
-		Parameter:  34,
-		Numbers:    []int64{13, 14, 15, 16, 18},
-		Parameters: []complex128{2 + 3i, 3 + 1i, 2 + 5i},
+	for i := range large.Blob {
+		large.Blob[i] = byte(i)
 	}
 
-	serialize(18, choice)
+	return []benchCase{
+		{
+			name:  "small",
+			value: &BenchSmall{ID: 132, X: 116.198, Y: 20.07, Alive: true},
+			empty: func() benchMessage { return new(BenchSmall) },
+			build: func(builder *kosuzu.Builder, msg benchMessage) {
+				small := msg.(*BenchSmall)
+
+				builder.AddInt32(small.ID)
+				builder.AddFloat64(small.X)
+				builder.AddFloat64(small.Y)
+				builder.AddBool(small.Alive)
+			},
+			decompose: func(decomposer *kosuzu.Decomposer) benchMessage {
+				small := new(BenchSmall)
+
+				small.ID, _ = decomposer.ReadInt32()
+				small.X, _ = decomposer.ReadFloat64()
+				small.Y, _ = decomposer.ReadFloat64()
+				small.Alive, _ = decomposer.ReadBool()
+
+				return small
+			},
+		},
+		{
+			name:  "medium",
+			value: medium,
+			empty: func() benchMessage { return new(BenchMedium) },
+			build: func(builder *kosuzu.Builder, msg benchMessage) {
+				medium := msg.(*BenchMedium)
+
+				builder.AddInt32(medium.ID)
+				builder.AddString(medium.Name)
+				builder.AddUint16(medium.Health)
+				builder.AddFloat64(medium.X)
+				builder.AddFloat64(medium.Y)
+				builder.AddFloat32Array(medium.Path)
+				builder.AddInt32Array(medium.Inventory)
+				builder.AddByteArray(medium.Avatar)
+			},
+			decompose: func(decomposer *kosuzu.Decomposer) benchMessage {
+				medium := new(BenchMedium)
+
+				medium.ID, _ = decomposer.ReadInt32()
+				medium.Name, _ = decomposer.ReadString()
+				medium.Health, _ = decomposer.ReadUint16()
+				medium.X, _ = decomposer.ReadFloat64()
+				medium.Y, _ = decomposer.ReadFloat64()
+				medium.Path, _ = decomposer.ReadFloat32Array()
+				medium.Inventory, _ = decomposer.ReadInt32Array()
+				medium.Avatar, _ = decomposer.ReadByteArray()
+
+				return medium
+			},
+		},
+		{
+			name:  "large",
+			value: large,
+			empty: func() benchMessage { return new(BenchLarge) },
+			build: func(builder *kosuzu.Builder, msg benchMessage) {
+				large := msg.(*BenchLarge)
+
+				builder.AddInt64(large.ID)
+				builder.AddString(large.Label)
+				builder.AddFloat64Array(large.Samples)
+				builder.AddUint32Array(large.Counters)
+				builder.AddComplex64Array(large.Phases)
+				builder.AddByteArray(large.Blob)
+			},
+			decompose: func(decomposer *kosuzu.Decomposer) benchMessage {
+				large := new(BenchLarge)
+
+				large.ID, _ = decomposer.ReadInt64()
+				large.Label, _ = decomposer.ReadString()
+				large.Samples, _ = decomposer.ReadFloat64Array()
+				large.Counters, _ = decomposer.ReadUint32Array()
+				large.Phases, _ = decomposer.ReadComplex64Array()
+				large.Blob, _ = decomposer.ReadByteArray()
+
+				return large
+			},
+		},
+	}
 }
 
-func BenchmarkDeserializeReflect(b *testing.B) {
-	choice := &Choice{
-		Parameter:  34,
-		Numbers:    []int64{13, 14, 15, 16, 18},
-		Parameters: []complex128{2 + 3i, 3 + 1i, 2 + 5i},
+// packet returns the packet with the message
+// and reports its payload size as the number
+// of bytes processed per iteration.
+func (bench benchCase) packet(b *testing.B) *kosuzu.Packet {
+	packet, err := bench.value.Serialize()
+
+	if err != nil {
+		b.Fatal(err)
 	}
 
-	packet, _ := kosuzu.Serialize(18, choice)
-	restored := new(Choice)
-	kosuzu.Deserialize(packet, &restored)
+	b.SetBytes(packet.DataLength())
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	return packet
 }
 
-func BenchmarkDeserializeCustom(b *testing.B) {
-	serialize := func(opcode int32, choice *Choice) *kosuzu.Packet {
-		builder := kosuzu.NewPacketBuilder()
+func BenchmarkSerialize(b *testing.B) {
+	for _, bench := range benchCases() {
+		bench := bench
+
+		b.Run(bench.name+"/reflect", func(b *testing.B) {
+			bench.packet(b)
 
-		builder.AddInt32(choice.Parameter)
-		builder.AddInt64Array(choice.Numbers)
+			for i := 0; i < b.N; i++ {
+				_, err := kosuzu.Serialize(bench.value.Opcode(), bench.value)
 
-		return builder.BuildPacket(opcode)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(bench.name+"/manual", func(b *testing.B) {
+			bench.packet(b)
+
+			for i := 0; i < b.N; i++ {
+				builder := kosuzu.NewPacketBuilder()
+				bench.build(builder, bench.value)
+				builder.BuildPacket(bench.value.Opcode())
+			}
+		})
+
+		b.Run(bench.name+"/generated", func(b *testing.B) {
+			bench.packet(b)
+
+			for i := 0; i < b.N; i++ {
+				_, err := bench.value.Serialize()
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
-	deserialize := func(packet *kosuzu.Packet) *Choice {
-		decomposer := kosuzu.NewPacketDecomposer(packet)
-		choice := new(Choice)
+}
+
+func BenchmarkDeserialize(b *testing.B) {
+	for _, bench := range benchCases() {
+		bench := bench
 
-		choice.Parameter, _ = decomposer.ReadInt32()
-		choice.Numbers, _ = decomposer.ReadInt64Array()
-		choice.Parameters, _ = decomposer.ReadComplex128Array()
+		b.Run(bench.name+"/reflect", func(b *testing.B) {
+			packet := bench.packet(b)
 
-		return choice
+			for i := 0; i < b.N; i++ {
+				err := kosuzu.Deserialize(packet, bench.empty())
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(bench.name+"/manual", func(b *testing.B) {
+			packet := bench.packet(b)
+
+			for i := 0; i < b.N; i++ {
+				bench.decompose(kosuzu.NewPacketDecomposer(packet))
+			}
+		})
+
+		b.Run(bench.name+"/generated", func(b *testing.B) {
+			packet := bench.packet(b)
+
+			for i := 0; i < b.N; i++ {
+				err := bench.empty().Deserialize(packet)
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
 	}
+}
+
+// BenchmarkFraming measures writing the packets
+// to the connection and reading them back
+// with ReadPacketFrom.
+func BenchmarkFraming(b *testing.B) {
+	for _, bench := range benchCases() {
+		for _, checksum := range []bool{false, true} {
+			bench := bench
+			checksum := checksum
+			name := bench.name + "/plain"
+
+			if checksum {
+				name = bench.name + "/checksum"
+			}
+
+			b.Run(name, func(b *testing.B) {
+				packet := bench.packet(b)
+				packet.SetChecksum(checksum)
+				client, server := net.Pipe()
+				written := make(chan error, 1)
+
+				defer client.Close()
+				defer server.Close()
+
+				go func() {
+					for i := 0; i < b.N; i++ {
+						_, err := packet.WriteTo(client)
+
+						if err != nil {
+							written <- err
+							return
+						}
+					}
+
+					written <- nil
+				}()
 
-	choice := &Choice{
-		Parameter:  34,
-		Numbers:    []int64{13, 14, 15, 16, 18},
-		Parameters: []complex128{2 + 3i, 3 + 1i, 2 + 5i},
+				for i := 0; i < b.N; i++ {
+					_, _, err := kosuzu.ReadPacketFrom(server)
+
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				err := <-written
+
+				if err != nil {
+					b.Fatal(err)
+				}
+			})
+		}
 	}
+}
 
-	packet := serialize(18, choice)
-	deserialize(packet)
+// TestBenchCodecs checks the codecs
+// measured by the benchmarks agree.
+func TestBenchCodecs(t *testing.T) {
+	for _, bench := range benchCases() {
+		expected, err := kosuzu.Serialize(bench.value.Opcode(), bench.value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		builder := kosuzu.NewPacketBuilder()
+		bench.build(builder, bench.value)
+		manual := builder.BuildPacket(bench.value.Opcode())
+		generated, err := bench.value.Serialize()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(manual.Payload(), expected.Payload()) ||
+			!bytes.Equal(generated.Payload(), expected.Payload()) {
+			t.Fatalf("%s: codecs produce different payloads", bench.name)
+		}
+
+		decoded := bench.empty()
+		err = kosuzu.Deserialize(expected, decoded)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(decoded, bench.value) ||
+			!reflect.DeepEqual(bench.decompose(kosuzu.NewPacketDecomposer(expected)), bench.value) {
+			t.Fatalf("%s: codecs read different values", bench.name)
+		}
+	}
 }
@@ -3,6 +3,7 @@ package kosuzu
 import (
 	"fmt"
 	"reflect"
+	"sort"
 )
 
 func readFromPacket(decomposer *Decomposer, fieldVal *reflect.Value, fieldTyp reflect.Type) error {
@@ -253,13 +254,100 @@ func readFromPacket(decomposer *Decomposer, fieldVal *reflect.Value, fieldTyp re
 			fieldVal.Set(reflect.ValueOf(slice))
 
 		default:
-			return fmt.Errorf(
-				"slice type is not supported: %v", fieldTyp)
+			length, err := decomposer.readLength(
+				decomposer.offset(), fieldTyp.String(),
+				decomposer.limits.MaxArrayLength,
+				wireSize(fieldTyp.Elem()), int64(fieldTyp.Elem().Size()))
+
+			if err != nil {
+				return err
+			}
+
+			slice := reflect.MakeSlice(fieldTyp, length, length)
+
+			for i := 0; i < slice.Len(); i++ {
+				elem := slice.Index(i)
+				err = readFromPacket(decomposer, &elem, fieldTyp.Elem())
+
+				if err != nil {
+					return withPath(err, fmt.Sprintf("[%d]", i))
+				}
+			}
+
+			fieldVal.Set(slice)
+		}
+
+	case reflect.Array:
+		for i := 0; i < fieldVal.Len(); i++ {
+			elem := fieldVal.Index(i)
+			err := readFromPacket(decomposer, &elem, fieldTyp.Elem())
+
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[%d]", i))
+			}
+		}
+
+	case reflect.Map:
+		length, err := decomposer.readLength(
+			decomposer.offset(), fieldTyp.String(),
+			decomposer.limits.MaxArrayLength,
+			wireSize(fieldTyp.Key())+wireSize(fieldTyp.Elem()),
+			int64(fieldTyp.Key().Size()+fieldTyp.Elem().Size()))
+
+		if err != nil {
+			return err
+		}
+
+		m := reflect.MakeMapWithSize(fieldTyp, length)
+
+		for i := 0; i < length; i++ {
+			key := reflect.New(fieldTyp.Key()).Elem()
+			err = readFromPacket(decomposer, &key, fieldTyp.Key())
+
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[#%d key]", i))
+			}
+
+			val := reflect.New(fieldTyp.Elem()).Elem()
+			err = readFromPacket(decomposer, &val, fieldTyp.Elem())
+
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[%v]", key.Interface()))
+			}
+
+			m.SetMapIndex(key, val)
+		}
+
+		fieldVal.Set(m)
+
+	case reflect.Ptr:
+		present, err := decomposer.ReadBool()
+
+		if err != nil {
+			return err
+		}
+
+		if !present {
+			fieldVal.Set(reflect.Zero(fieldTyp))
+			break
+		}
+
+		ptr := reflect.New(fieldTyp.Elem())
+		elem := ptr.Elem()
+		err = readFromPacket(decomposer, &elem, fieldTyp.Elem())
+
+		if err != nil {
+			return err
 		}
 
+		fieldVal.Set(ptr)
+
+	case reflect.Struct:
+		return readStruct(decomposer, fieldVal, fieldTyp)
+
 	default:
-		return fmt.Errorf(
-			"the field type is unsupported: %s", fieldTyp.Kind())
+		return decomposer.fail(decomposer.offset(), fieldTyp.String(),
+			fmt.Errorf("the field type is unsupported: %s", fieldTyp.Kind()))
 	}
 
 	return nil
@@ -459,10 +547,79 @@ func writeToPacket(builder *Builder, fieldVal reflect.Value, fieldTyp reflect.Ty
 			}
 
 		default:
-			return fmt.Errorf(
-				"slice type is not supported: %v", fieldTyp)
+			err := builder.AddInt32(int32(fieldVal.Len()))
+
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < fieldVal.Len(); i++ {
+				err = writeToPacket(builder,
+					fieldVal.Index(i), fieldTyp.Elem())
+
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+	case reflect.Array:
+		for i := 0; i < fieldVal.Len(); i++ {
+			err := writeToPacket(builder,
+				fieldVal.Index(i), fieldTyp.Elem())
+
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		keys, err := sortedKeys(fieldVal)
+
+		if err != nil {
+			return err
+		}
+
+		err = builder.AddInt32(int32(len(keys)))
+
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			err = writeToPacket(builder, key, fieldTyp.Key())
+
+			if err != nil {
+				return err
+			}
+
+			err = writeToPacket(builder,
+				fieldVal.MapIndex(key), fieldTyp.Elem())
+
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Ptr:
+		err := builder.AddBool(!fieldVal.IsNil())
+
+		if err != nil {
+			return err
+		}
+
+		if !fieldVal.IsNil() {
+			err = writeToPacket(builder,
+				fieldVal.Elem(), fieldTyp.Elem())
+
+			if err != nil {
+				return err
+			}
 		}
 
+	case reflect.Struct:
+		return writeStruct(builder, fieldVal, fieldTyp)
+
 	default:
 		return fmt.Errorf(
 			"the field type is unsupported: %s", fieldTyp.Kind())
@@ -471,8 +628,90 @@ func writeToPacket(builder *Builder, fieldVal reflect.Value, fieldTyp reflect.Ty
 	return nil
 }
 
+// wireSize returns the minimum number of
+// bytes the value of the type takes in the
+// packet. It's used to check the length prefixes
+// before allocating slices and maps.
+func wireSize(typ reflect.Type) int64 {
+	switch typ.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return 4
+
+	case reflect.Ptr:
+		return 1
+
+	case reflect.Array:
+		return int64(typ.Len()) * wireSize(typ.Elem())
+
+	case reflect.Struct:
+		// The older versions of the versioned
+		// struct may have no fields at all.
+		if _, ok := reflect.New(typ).Interface().(Versioned); ok {
+			return 1 + 4
+		}
+
+		var size int64
+
+		for i := 0; i < typ.NumField(); i++ {
+			size += wireSize(typ.Field(i).Type)
+		}
+
+		return size
+
+	default:
+		return int64(typ.Size())
+	}
+}
+
+// sortedKeys returns the keys of the map
+// in ascending order, so the map is always
+// written to the packet the same way.
+func sortedKeys(m reflect.Value) ([]reflect.Value, error) {
+	keys := m.MapKeys()
+	var less func(a, b reflect.Value) bool
+
+	switch m.Type().Key().Kind() {
+	case reflect.Bool:
+		less = func(a, b reflect.Value) bool { return !a.Bool() && b.Bool() }
+
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		less = func(a, b reflect.Value) bool { return a.Int() < b.Int() }
+
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		less = func(a, b reflect.Value) bool { return a.Uint() < b.Uint() }
+
+	case reflect.Float32, reflect.Float64:
+		less = func(a, b reflect.Value) bool { return a.Float() < b.Float() }
+
+	case reflect.String:
+		less = func(a, b reflect.Value) bool { return a.String() < b.String() }
+
+	default:
+		return nil, fmt.Errorf(
+			"map key type is not supported: %v", m.Type().Key())
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+
+	return keys, nil
+}
+
 // Serialize serializes the given object
 // and creates a network packet from it.
+//
+// Struct fields are written in the order
+// they are declared, nested structs are
+// written inline. Slices and maps are prefixed
+// with their int32 length, and map entries are
+// written in the ascending order of their keys.
+// Arrays are written without the length.
+// Pointers are written as a bool telling
+// if the pointer is not nil followed by
+// the value it points to. Structs implementing
+// Versioned are prefixed with their version
+// and length.
 func Serialize(opcode int32, value interface{}) (*Packet, error) {
 	builder := NewPacketBuilder()
 	val := reflect.ValueOf(value)
@@ -481,59 +720,66 @@ func Serialize(opcode int32, value interface{}) (*Packet, error) {
 		val = val.Elem()
 	}
 
-	if val.Kind() == reflect.Struct {
-		for i := 0; i < val.NumField(); i++ {
-			fieldVal := val.Field(i)
-			fieldTyp := val.Field(i).Type()
+	err := writeToPacket(builder,
+		val, val.Type())
 
-			err := writeToPacket(builder,
-				fieldVal, fieldTyp)
-
-			if err != nil {
-				return nil, err
-			}
-		}
-	} else {
-		err := writeToPacket(builder,
-			val, val.Type())
-
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return nil, err
 	}
 
 	return builder.BuildPacket(opcode), nil
 }
 
 // Deserialize deserializes the packet
-// into the given object.
+// into the given object. The fields of
+// the versioned structs missing in the
+// packet are set to zero. If the value
+// can't be read, the *DecodeError telling
+// the path of the field is returned.
 func Deserialize(packet *Packet, obj interface{}) error {
+	return NewPacketDecomposer(packet).ReadValue(obj)
+}
+
+// DeserializeStrict deserializes the packet
+// like Deserialize but fails if the payload
+// has bytes left after the last field or
+// the bools are encoded other than as 0 or 1.
+// Pass CheckUTF8 to also require the strings
+// to be valid UTF-8.
+func DeserializeStrict(packet *Packet, obj interface{}, checks ...Check) error {
 	decomposer := NewPacketDecomposer(packet)
+	strict := CheckBools
+
+	for _, check := range checks {
+		strict |= check
+	}
+
+	decomposer.SetChecks(strict)
+	err := decomposer.ReadValue(obj)
+
+	if err != nil {
+		return err
+	}
+
+	return decomposer.Done()
+}
+
+// ReadValue reads the object from the packet
+// the same way Deserialize does. It allows
+// to deserialize the packet with the limits
+// set for the decomposer.
+func (decomposer *Decomposer) ReadValue(obj interface{}) error {
 	val := reflect.ValueOf(obj)
 
 	for val.Kind() == reflect.Ptr {
 		val = val.Elem()
 	}
 
-	if val.Kind() == reflect.Struct {
-		for i := 0; i < val.NumField(); i++ {
-			fieldVal := val.Field(i)
-			fieldTyp := val.Field(i).Type()
+	err := readFromPacket(decomposer,
+		&val, val.Type())
 
-			err := readFromPacket(decomposer,
-				&fieldVal, fieldTyp)
-
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		err := readFromPacket(decomposer,
-			&val, val.Type())
-
-		if err != nil {
-			return err
-		}
+	if err != nil {
+		return withPath(err, val.Type().Name())
 	}
 
 	return nil
@@ -0,0 +1,135 @@
+package kosuzu_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type Scroll struct {
+	Title string
+	Pages int16
+}
+
+type Shelf struct {
+	Label    string
+	Featured Scroll
+	Scrolls  []Scroll
+	Corners  [4]int32
+	Slots    [2]Scroll
+	Stock    map[string]int32
+	Tags     map[int8][]string
+	Borrowed *Scroll
+	Reserved *Scroll
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	shelves := []Shelf{
+		{},
+		{
+			Label:    "Suzunaan",
+			Featured: Scroll{Title: "Hyakki Yagyou Emaki", Pages: 12},
+			Scrolls: []Scroll{
+				{Title: "Grimoire of Marisa", Pages: 200},
+				{Title: "Kojiki", Pages: 300},
+			},
+			Corners:  [4]int32{1, -2, 3, -4},
+			Slots:    [2]Scroll{{Title: "left"}, {Title: "right", Pages: 1}},
+			Stock:    map[string]int32{"scrolls": 42, "books": 7, "": -1},
+			Tags:     map[int8][]string{-3: {"youkai"}, 5: {"rare", "old"}},
+			Borrowed: &Scroll{Title: "Yomiuri", Pages: 4},
+		},
+	}
+
+	for _, shelf := range shelves {
+		packet, err := kosuzu.Serialize(10, shelf)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Shelf
+		err = kosuzu.Deserialize(packet, &decoded)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Empty slices and maps are read back
+		// empty, but not nil.
+		if len(shelf.Scrolls) == 0 && len(decoded.Scrolls) == 0 {
+			decoded.Scrolls = shelf.Scrolls
+		}
+
+		if len(shelf.Stock) == 0 && len(decoded.Stock) == 0 {
+			decoded.Stock = shelf.Stock
+		}
+
+		if len(shelf.Tags) == 0 && len(decoded.Tags) == 0 {
+			decoded.Tags = shelf.Tags
+		}
+
+		if !reflect.DeepEqual(decoded, shelf) {
+			t.Fatalf("expected %+v, got %+v", shelf, decoded)
+		}
+
+		if decoded.Reserved != nil {
+			t.Fatal("the nil pointer is read back as not nil")
+		}
+	}
+}
+
+func TestSerializeLayout(t *testing.T) {
+	value := struct {
+		Inner    Scroll
+		Corners  [2]int32
+		Stock    map[string]int32
+		Borrowed *Scroll
+		Reserved *Scroll
+	}{
+		Inner:    Scroll{Title: "Kojiki", Pages: 3},
+		Corners:  [2]int32{5, 6},
+		Stock:    map[string]int32{"c": 3, "a": 1, "b": 2},
+		Borrowed: &Scroll{Title: "Yomiuri", Pages: 4},
+	}
+
+	builder := kosuzu.NewPacketBuilder()
+	// The nested struct is written inline.
+	builder.AddString("Kojiki")
+	builder.AddInt16(3)
+	// The array is written without the length.
+	builder.AddInt32(5)
+	builder.AddInt32(6)
+	// The map is prefixed with its length
+	// and written in the ascending key order.
+	builder.AddInt32(3)
+	builder.AddString("a")
+	builder.AddInt32(1)
+	builder.AddString("b")
+	builder.AddInt32(2)
+	builder.AddString("c")
+	builder.AddInt32(3)
+	// The pointers are written as a presence
+	// bool followed by the value.
+	builder.AddBool(true)
+	builder.AddString("Yomiuri")
+	builder.AddInt16(4)
+	builder.AddBool(false)
+	expected := builder.BuildPacket(10).Payload()
+
+	// Go randomizes the map iteration order,
+	// so the map is written several times.
+	for i := 0; i < 16; i++ {
+		packet, err := kosuzu.Serialize(10, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(packet.Payload(), expected) {
+			t.Fatalf("expected %x, got %x", expected, packet.Payload())
+		}
+	}
+}
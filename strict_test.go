@@ -0,0 +1,72 @@
+package kosuzu_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type Flags struct {
+	Name    string
+	Enabled bool
+	Bits    []bool
+}
+
+func TestDeserializeStrict(t *testing.T) {
+	packet, err := kosuzu.Serialize(1, &Flags{
+		Name:    "kosuzu",
+		Enabled: true,
+		Bits:    []bool{true, false},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := packet.Payload()
+
+	if err := kosuzu.DeserializeStrict(packet, &Flags{}, kosuzu.CheckUTF8); err != nil {
+		t.Fatal(err)
+	}
+
+	trailing := kosuzu.NewPacket(1, append(append([]byte{}, payload...), 0))
+
+	if err := kosuzu.Deserialize(trailing, &Flags{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := kosuzu.DeserializeStrict(trailing, &Flags{}); !errors.Is(err, kosuzu.ErrTrailingBytes) {
+		t.Fatalf("expected trailing bytes, got %v", err)
+	}
+
+	// Name (4 + 6 bytes), then Enabled.
+	nonCanonical := append([]byte{}, payload...)
+	nonCanonical[10] = 2
+	err = kosuzu.DeserializeStrict(kosuzu.NewPacket(1, nonCanonical), &Flags{})
+
+	var decodeErr *kosuzu.DecodeError
+
+	if !errors.As(err, &decodeErr) || !errors.Is(err, kosuzu.ErrNonCanonical) ||
+		decodeErr.Path != "Flags.Enabled" {
+		t.Fatalf("expected non-canonical Flags.Enabled, got %v", err)
+	}
+
+	nonCanonical = append([]byte{}, payload...)
+	nonCanonical[len(nonCanonical)-1] = 0xff
+
+	if err := kosuzu.DeserializeStrict(kosuzu.NewPacket(1, nonCanonical), &Flags{}); !errors.Is(err, kosuzu.ErrNonCanonical) {
+		t.Fatalf("expected non-canonical bool slice, got %v", err)
+	}
+
+	invalid := append([]byte{}, payload...)
+	invalid[4] = 0xff
+
+	if err := kosuzu.DeserializeStrict(kosuzu.NewPacket(1, invalid), &Flags{}); err != nil {
+		t.Fatalf("expected UTF-8 not to be checked by default, got %v", err)
+	}
+
+	if err := kosuzu.DeserializeStrict(kosuzu.NewPacket(1, invalid), &Flags{}, kosuzu.CheckUTF8); !errors.Is(err, kosuzu.ErrNonCanonical) {
+		t.Fatalf("expected invalid UTF-8, got %v", err)
+	}
+}
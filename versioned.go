@@ -0,0 +1,210 @@
+package kosuzu
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/zergon321/kosuzu/schema"
+)
+
+// Versioned is implemented by the structs
+// encoded in the versioned format, which allows
+// adding fields to the message without breaking
+// the peers using its older versions.
+//
+// The versioned struct is written as the version
+// returned by Version, the int32 length of its fields
+// and the fields themselves. The fields added after
+// the first version are tagged with kosuzu:"since=N"
+// and must be declared after the older ones.
+// When the packet of the older version is read,
+// the fields added since the newer versions are
+// left zero. When the packet of the newer version
+// is read, the unknown fields at its end are skipped.
+type Versioned interface {
+	Version() uint8
+}
+
+// structVersions caches the results of
+// structVersion for every struct type,
+// as it's called for every struct value
+// written or read.
+var structVersions sync.Map
+
+// structLayout is the result
+// of parsing the struct type.
+type structLayout struct {
+	version uint8
+	since   []uint8
+	ok      bool
+	err     error
+}
+
+// structVersion returns the version of the struct
+// type and the versions its fields were added in.
+// The struct is not versioned if ok is false.
+// The since slice is shared and must not be modified.
+func structVersion(typ reflect.Type) (version uint8, since []uint8, ok bool, err error) {
+	if cached, found := structVersions.Load(typ); found {
+		layout := cached.(*structLayout)
+		return layout.version, layout.since, layout.ok, layout.err
+	}
+
+	layout := new(structLayout)
+	layout.version, layout.since, layout.ok, layout.err = parseStructVersion(typ)
+	structVersions.Store(typ, layout)
+
+	return layout.version, layout.since, layout.ok, layout.err
+}
+
+// parseStructVersion parses the kosuzu tags
+// of the struct fields for structVersion.
+func parseStructVersion(typ reflect.Type) (version uint8, since []uint8, ok bool, err error) {
+	versioned, ok := reflect.New(typ).Interface().(Versioned)
+
+	if ok {
+		version = versioned.Version()
+	}
+
+	since = make([]uint8, typ.NumField())
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		since[i], err = schema.Since(field)
+
+		if err != nil {
+			return 0, nil, false, fmt.Errorf("%v: field %s: %w", typ, field.Name, err)
+		}
+
+		switch {
+		case !ok && since[i] != 0:
+			return 0, nil, false, fmt.Errorf(
+				"%v: field %s: only versioned structs can have fields added since a version",
+				typ, field.Name)
+
+		case since[i] > version:
+			return 0, nil, false, fmt.Errorf(
+				"%v: field %s: added since %d, after the struct version %d",
+				typ, field.Name, since[i], version)
+
+		case i > 0 && since[i] < since[i-1]:
+			return 0, nil, false, fmt.Errorf(
+				"%v: field %s: added since %d must follow the fields added since %d",
+				typ, field.Name, since[i], since[i-1])
+		}
+	}
+
+	return version, since, ok, nil
+}
+
+// writeStruct writes the struct fields
+// in the order they are declared, prefixed
+// with the version and the length if the
+// struct is versioned.
+func writeStruct(builder *Builder, fieldVal reflect.Value, fieldTyp reflect.Type) error {
+	version, _, versioned, err := structVersion(fieldTyp)
+
+	if err != nil {
+		return err
+	}
+
+	body := builder
+
+	if versioned {
+		body = NewPacketBuilder()
+	}
+
+	for i := 0; i < fieldVal.NumField(); i++ {
+		err := writeToPacket(body,
+			fieldVal.Field(i), fieldTyp.Field(i).Type)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if !versioned {
+		return nil
+	}
+
+	err = builder.AddUint8(version)
+
+	if err != nil {
+		return err
+	}
+
+	err = builder.AddInt32(int32(body.buffer.Len()))
+
+	if err != nil {
+		return err
+	}
+
+	return builder.AddBytes(body.buffer.Bytes())
+}
+
+// readStruct reads the struct fields written
+// by writeStruct. The fields of the versioned
+// struct added since the newer version than
+// the one written are set to zero.
+func readStruct(decomposer *Decomposer, fieldVal *reflect.Value, fieldTyp reflect.Type) error {
+	_, since, versioned, err := structVersion(fieldTyp)
+
+	if err != nil {
+		return decomposer.fail(decomposer.offset(), fieldTyp.String(), err)
+	}
+
+	body := decomposer
+	var version uint8
+
+	if versioned {
+		version, body, err = readVersioned(decomposer)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < fieldVal.NumField(); i++ {
+		field := fieldVal.Field(i)
+
+		if since[i] > version {
+			field.Set(reflect.Zero(field.Type()))
+			continue
+		}
+
+		err := readFromPacket(body, &field, field.Type())
+
+		if err != nil {
+			return withPath(err, "."+fieldTyp.Field(i).Name)
+		}
+	}
+
+	return nil
+}
+
+// readVersioned reads the version and the
+// length of the versioned struct and returns
+// the decomposer reading its fields.
+func readVersioned(decomposer *Decomposer) (uint8, *Decomposer, error) {
+	version, err := decomposer.ReadUint8()
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, err := decomposer.readLength(
+		decomposer.offset(), "versioned struct", 0, 1, 0)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	body, err := decomposer.Sub(length)
+
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return version, body, nil
+}
@@ -0,0 +1,269 @@
+package kosuzu_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/zergon321/kosuzu"
+)
+
+type ProfileV1 struct {
+	ID   int32
+	Name string
+}
+
+func (ProfileV1) Version() uint8 {
+	return 1
+}
+
+type ProfileV2 struct {
+	ID    int32
+	Name  string
+	Level uint16   `kosuzu:"since=2"`
+	Tags  []string `kosuzu:"since=2"`
+}
+
+func (ProfileV2) Version() uint8 {
+	return 2
+}
+
+type ProfilesV1 struct {
+	Profiles []ProfileV1
+	Count    int32
+}
+
+type ProfilesV2 struct {
+	Profiles []ProfileV2
+	Count    int32
+}
+
+func TestVersionedForward(t *testing.T) {
+	packet, err := kosuzu.Serialize(1, &ProfilesV2{
+		Profiles: []ProfileV2{
+			{ID: 1, Name: "reimu", Level: 3, Tags: []string{"shrine"}},
+			{ID: 2, Name: "marisa", Level: 5},
+		},
+		Count: 2,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profiles ProfilesV1
+	err = kosuzu.Deserialize(packet, &profiles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ProfilesV1{
+		Profiles: []ProfileV1{{ID: 1, Name: "reimu"}, {ID: 2, Name: "marisa"}},
+		Count:    2,
+	}
+
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profiles)
+	}
+}
+
+func TestVersionedBackward(t *testing.T) {
+	packet, err := kosuzu.Serialize(1, &ProfilesV1{
+		Profiles: []ProfileV1{{ID: 1, Name: "reimu"}},
+		Count:    1,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles := ProfilesV2{
+		Profiles: []ProfileV2{{Level: 7, Tags: []string{"stale"}}},
+	}
+	err = kosuzu.Deserialize(packet, &profiles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ProfilesV2{
+		Profiles: []ProfileV2{{ID: 1, Name: "reimu"}},
+		Count:    1,
+	}
+
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profiles)
+	}
+
+	sch, err := kosuzu.SchemaOf(ProfilesV2{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := kosuzu.DeserializeMap(packet, sch, "ProfilesV2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedMap := map[string]interface{}{
+		"Profiles": []interface{}{
+			map[string]interface{}{"ID": int32(1), "Name": "reimu"},
+		},
+		"Count": int32(1),
+	}
+
+	if !reflect.DeepEqual(obj, expectedMap) {
+		t.Fatalf("expected %v, got %v", expectedMap, obj)
+	}
+}
+
+type unversioned struct {
+	Level uint16 `kosuzu:"since=2"`
+}
+
+func TestVersionedBackwardCollections(t *testing.T) {
+	packet, err := kosuzu.Serialize(1, &ProfilesV1{
+		Profiles: []ProfileV1{
+			{ID: 1, Name: "r"},
+			{ID: 2, Name: "m"},
+			{ID: 3, Name: "s"},
+		},
+		Count: 3,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var profiles ProfilesV2
+	err = kosuzu.Deserialize(packet, &profiles)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ProfilesV2{
+		Profiles: []ProfileV2{
+			{ID: 1, Name: "r"},
+			{ID: 2, Name: "m"},
+			{ID: 3, Name: "s"},
+		},
+		Count: 3,
+	}
+
+	if !reflect.DeepEqual(profiles, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, profiles)
+	}
+
+	sch, err := kosuzu.SchemaOf(ProfilesV2{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := kosuzu.DeserializeMap(packet, sch, "ProfilesV2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if profiles := obj["Profiles"].([]interface{}); len(profiles) != 3 {
+		t.Fatalf("expected 3 profiles, got %d", len(profiles))
+	}
+
+	packet, err = kosuzu.Serialize(1, &struct {
+		Profiles map[string]ProfileV1
+	}{
+		Profiles: map[string]ProfileV1{
+			"a": {ID: 1, Name: "r"},
+			"b": {ID: 2, Name: "m"},
+			"c": {ID: 3, Name: "s"},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lookup struct {
+		Profiles map[string]ProfileV2
+	}
+
+	err = kosuzu.Deserialize(packet, &lookup)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLookup := map[string]ProfileV2{
+		"a": {ID: 1, Name: "r"},
+		"b": {ID: 2, Name: "m"},
+		"c": {ID: 3, Name: "s"},
+	}
+
+	if !reflect.DeepEqual(lookup.Profiles, expectedLookup) {
+		t.Fatalf("expected %+v, got %+v", expectedLookup, lookup.Profiles)
+	}
+}
+
+type misordered struct {
+	Level uint16 `kosuzu:"since=2"`
+	Name  string
+}
+
+func (misordered) Version() uint8 {
+	return 2
+}
+
+type unreleased struct {
+	Level uint16 `kosuzu:"since=3"`
+}
+
+func (unreleased) Version() uint8 {
+	return 2
+}
+
+func TestVersionedErrors(t *testing.T) {
+	for _, value := range []interface{}{
+		&unversioned{}, &misordered{}, &unreleased{},
+	} {
+		_, err := kosuzu.Serialize(1, value)
+
+		if err == nil {
+			t.Fatalf("%T: expected error", value)
+		}
+	}
+
+	packet, err := kosuzu.Serialize(1, &ProfileV2{Name: "reimu"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truncated := kosuzu.NewPacket(1, packet.Payload()[:len(packet.Payload())-1])
+
+	if err := kosuzu.Deserialize(truncated, &ProfileV2{}); err == nil {
+		t.Fatalf("expected error for the truncated payload")
+	}
+}
+
+type emptyTag struct {
+	Name string `kosuzu:""`
+}
+
+func TestVersionedEmptyTag(t *testing.T) {
+	packet, err := kosuzu.Serialize(1, &emptyTag{Name: "reimu"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded emptyTag
+	err = kosuzu.Deserialize(packet, &decoded)
+
+	if err != nil || decoded.Name != "reimu" {
+		t.Fatalf("unexpected value: %+v, %v", decoded, err)
+	}
+}
@@ -0,0 +1,698 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zergon321/kosuzu"
+)
+
+// Frame opcodes.
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xa
+)
+
+// Status codes sent in the close frames.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseInvalidPayload  = 1007
+	CloseMessageTooBig   = 1009
+)
+
+// maxControlPayload is the maximum
+// payload length of the control frames.
+const maxControlPayload = 125
+
+// closeTimeout bounds writing the
+// close frame by Close.
+const closeTimeout = time.Second
+
+var (
+	// ErrMessageTooBig is returned when the message
+	// read from the peer or the packet written to it
+	// exceeds the maximum message size.
+	ErrMessageTooBig = errors.New("websocket message is too big")
+	// ErrProtocol is returned when
+	// the peer violates RFC 6455.
+	ErrProtocol = errors.New("websocket protocol error")
+
+	// aLongTimeAgo is the deadline which
+	// interrupts the pending operations.
+	aLongTimeAgo = time.Unix(1, 0)
+)
+
+// CloseError is returned when
+// the peer closes the connection
+// with the abnormal status code.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error returns the description of the error.
+func (err *CloseError) Error() string {
+	return fmt.Sprintf("websocket closed with status %d: %s",
+		err.Code, err.Reason)
+}
+
+// Conn is the WebSocket connection carrying
+// kosuzu packets in binary messages. It implements
+// net.Conn, so it can be passed to kosuzu.Handshake,
+// kosuzu.NewClient and Server.Serve, and the packets
+// can be read with kosuzu.ReadPacketFrom.
+//
+// The frames are read by the goroutine of the
+// connection, which answers the pings and closes
+// the connection if the peer stops responding.
+// The messages are passed to Read one at a time,
+// so the peer is blocked until they are read.
+type Conn struct {
+	raw            net.Conn
+	reader         *bufio.Reader
+	client         bool
+	maxMessageSize int64
+	pongWait       time.Duration
+
+	writeLock sync.Mutex
+	closeSent bool
+	pending   []byte
+	writeErr  error
+
+	messages     chan []byte
+	message      []byte
+	readDeadline deadline
+	done         chan struct{}
+	err          error
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// newConn creates the connection over the raw
+// one after the opening handshake. The client
+// masks the frames it sends.
+func newConn(raw net.Conn, reader *bufio.Reader, client bool, options *Options) *Conn {
+	pingInterval, pongTimeout := options.keepalive()
+	conn := &Conn{
+		raw:            raw,
+		reader:         reader,
+		client:         client,
+		maxMessageSize: options.maxMessageSize(),
+		messages:       make(chan []byte),
+		readDeadline:   deadline{changed: make(chan struct{})},
+		done:           make(chan struct{}),
+		closed:         make(chan struct{}),
+	}
+
+	if pingInterval > 0 {
+		conn.pongWait = pingInterval + pongTimeout
+		go conn.ping(pingInterval)
+	}
+
+	go conn.readMessages()
+
+	return conn
+}
+
+// Read reads the contents of the binary messages
+// as the continuous stream. It returns io.EOF
+// when the peer closes the connection normally.
+func (conn *Conn) Read(p []byte) (int, error) {
+	for len(conn.message) == 0 {
+		message, err := conn.nextMessage()
+
+		if err != nil {
+			return 0, err
+		}
+
+		conn.message = message
+	}
+
+	n := copy(p, conn.message)
+	conn.message = conn.message[n:]
+
+	return n, nil
+}
+
+// ReadPacket reads the packet from the
+// next binary message. The message must
+// contain exactly one packet.
+func (conn *Conn) ReadPacket() (*kosuzu.Packet, error) {
+	message := conn.message
+	conn.message = nil
+
+	if len(message) == 0 {
+		var err error
+		message, err = conn.nextMessage()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	length, err := kosuzu.PacketLength(message)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if length != int64(len(message)) {
+		return nil, fmt.Errorf(
+			"message of %d bytes contains the packet of %d bytes",
+			len(message), length)
+	}
+
+	return kosuzu.PacketFromBytes(message)
+}
+
+// nextMessage waits for the next message
+// until the read deadline is exceeded.
+func (conn *Conn) nextMessage() ([]byte, error) {
+	for {
+		select {
+		case <-conn.closed:
+			return nil, net.ErrClosed
+
+		default:
+		}
+
+		at, changed := conn.readDeadline.get()
+		timer := &time.Timer{}
+
+		if !at.IsZero() {
+			wait := time.Until(at)
+
+			if wait <= 0 {
+				return nil, os.ErrDeadlineExceeded
+			}
+
+			timer = time.NewTimer(wait)
+		}
+
+		select {
+		case message := <-conn.messages:
+			stopTimer(timer)
+			return message, nil
+
+		case <-conn.done:
+			stopTimer(timer)
+			return nil, conn.err
+
+		case <-conn.closed:
+			stopTimer(timer)
+			return nil, net.ErrClosed
+
+		case <-timer.C:
+			return nil, os.ErrDeadlineExceeded
+
+		case <-changed:
+			stopTimer(timer)
+		}
+	}
+}
+
+// stopTimer stops the timer
+// if it was started.
+func stopTimer(timer *time.Timer) {
+	if timer.C != nil {
+		timer.Stop()
+	}
+}
+
+// Write buffers the bytes until they make up
+// whole packets and sends every packet as one
+// binary message, so kosuzu.Packet.WriteTo
+// can write to the connection directly.
+// The packets larger than the maximum
+// message size are rejected.
+func (conn *Conn) Write(p []byte) (int, error) {
+	conn.writeLock.Lock()
+	defer conn.writeLock.Unlock()
+
+	if conn.writeErr != nil {
+		return 0, conn.writeErr
+	}
+
+	conn.pending = append(conn.pending, p...)
+
+	for len(conn.pending) >= kosuzu.HeaderLength {
+		length, err := kosuzu.PacketLength(conn.pending)
+
+		if err == nil && length > conn.maxMessageSize {
+			err = fmt.Errorf("%w: packet of %d bytes exceeds %d",
+				ErrMessageTooBig, length, conn.maxMessageSize)
+		}
+
+		if err != nil {
+			// The rest of the stream can't be
+			// split into packets anymore.
+			conn.writeErr = err
+			conn.pending = nil
+
+			return 0, err
+		}
+
+		if int64(len(conn.pending)) < length {
+			break
+		}
+
+		err = conn.writeFrame(opBinary, conn.pending[:length])
+
+		if err != nil {
+			conn.writeErr = err
+			conn.pending = nil
+
+			return 0, err
+		}
+
+		conn.pending = append(conn.pending[:0], conn.pending[length:]...)
+	}
+
+	return len(p), nil
+}
+
+// WritePacket sends the packet
+// as one binary message.
+func (conn *Conn) WritePacket(packet *kosuzu.Packet) error {
+	data, err := packet.Bytes()
+
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(data)
+
+	return err
+}
+
+// Close sends the close frame to the peer
+// without waiting for its one and closes
+// the underlying connection.
+func (conn *Conn) Close() error {
+	err := net.ErrClosed
+
+	conn.closeOnce.Do(func() {
+		close(conn.closed)
+
+		// The pending write holds the lock until
+		// the connection is closed, so the close
+		// frame is only sent if there's none.
+		if conn.writeLock.TryLock() {
+			conn.raw.SetWriteDeadline(time.Now().Add(closeTimeout))
+			conn.writeClose(CloseNormal, "")
+			conn.writeLock.Unlock()
+		}
+
+		err = conn.raw.Close()
+	})
+
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (conn *Conn) LocalAddr() net.Addr {
+	return conn.raw.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (conn *Conn) RemoteAddr() net.Addr {
+	return conn.raw.RemoteAddr()
+}
+
+// SetDeadline sets the read
+// and write deadlines.
+func (conn *Conn) SetDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+
+	return conn.raw.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline
+// for the pending and future Read calls.
+func (conn *Conn) SetReadDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+
+	return nil
+}
+
+// SetWriteDeadline sets the deadline
+// for the pending and future Write calls.
+func (conn *Conn) SetWriteDeadline(t time.Time) error {
+	return conn.raw.SetWriteDeadline(t)
+}
+
+// ping sends the pings to the peer until
+// the connection is closed or broken.
+func (conn *Conn) ping(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			conn.writeLock.Lock()
+			err := conn.writeFrame(opPing, nil)
+			conn.writeLock.Unlock()
+
+			if err != nil {
+				return
+			}
+
+		case <-conn.done:
+			return
+
+		case <-conn.closed:
+			return
+		}
+	}
+}
+
+// readMessages reads the frames until
+// the connection is closed or broken.
+func (conn *Conn) readMessages() {
+	err := conn.readFrames()
+
+	if errors.Is(err, net.ErrClosed) {
+		select {
+		case <-conn.closed:
+			err = net.ErrClosed
+
+		default:
+		}
+	}
+
+	conn.err = err
+	close(conn.done)
+	conn.raw.Close()
+}
+
+// readFrames passes the data messages to Read
+// and answers the control frames.
+func (conn *Conn) readFrames() error {
+	var message []byte
+	fragmented := false
+
+	for {
+		if conn.pongWait > 0 {
+			conn.raw.SetReadDeadline(time.Now().Add(conn.pongWait))
+		}
+
+		fin, opcode, payload, err := conn.readFrame(int64(len(message)))
+
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case opPing:
+			conn.writeLock.Lock()
+			err = conn.writeFrame(opPong, payload)
+			conn.writeLock.Unlock()
+
+			if err != nil {
+				return err
+			}
+
+		case opPong:
+
+		case opClose:
+			return conn.readClose(payload)
+
+		case opText:
+			return conn.fail(CloseUnsupportedData,
+				"text messages are not supported")
+
+		case opBinary, opContinuation:
+			if (opcode == opContinuation) != fragmented {
+				return conn.fail(CloseProtocolError,
+					"unexpected continuation frame")
+			}
+
+			message = append(message, payload...)
+			fragmented = !fin
+
+			if fragmented {
+				continue
+			}
+
+			select {
+			case conn.messages <- message:
+				message = nil
+
+			case <-conn.closed:
+				return net.ErrClosed
+			}
+
+		default:
+			return conn.fail(CloseProtocolError,
+				fmt.Sprintf("unknown opcode %d", opcode))
+		}
+	}
+}
+
+// readFrame reads the frame. The size is the
+// length of the message fragments read before,
+// so the message is checked against the maximum
+// size before its payload is allocated.
+func (conn *Conn) readFrame(size int64) (bool, byte, []byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(conn.reader, header[:])
+
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, conn.fail(CloseProtocolError,
+			"reserved bits are set")
+	}
+
+	if masked == conn.client {
+		return false, 0, nil, conn.fail(CloseProtocolError,
+			"frames must be masked by the client only")
+	}
+
+	switch length {
+	case 126:
+		var extended uint16
+		err = binary.Read(conn.reader, binary.BigEndian, &extended)
+		length = int64(extended)
+
+	case 127:
+		var extended uint64
+		err = binary.Read(conn.reader, binary.BigEndian, &extended)
+		length = int64(extended)
+	}
+
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	if length < 0 {
+		return false, 0, nil, conn.fail(CloseProtocolError,
+			"invalid payload length")
+	}
+
+	if opcode >= opClose {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, conn.fail(CloseProtocolError,
+				"control frames must not be fragmented or longer than 125 bytes")
+		}
+	} else if size+length > conn.maxMessageSize {
+		conn.fail(CloseMessageTooBig, "message is too big")
+
+		return false, 0, nil, fmt.Errorf("%w: %d bytes exceed %d",
+			ErrMessageTooBig, size+length, conn.maxMessageSize)
+	}
+
+	var mask [4]byte
+
+	if masked {
+		_, err = io.ReadFull(conn.reader, mask[:])
+
+		if err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(conn.reader, payload)
+
+	if err != nil {
+		return false, 0, nil, err
+	}
+
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// readClose answers the close frame of the peer
+// and returns the error Read reports afterwards.
+func (conn *Conn) readClose(payload []byte) error {
+	code := CloseNoStatus
+	reason := ""
+
+	if len(payload) == 1 {
+		return conn.fail(CloseProtocolError, "invalid close frame")
+	}
+
+	if len(payload) >= 2 {
+		code = int(binary.BigEndian.Uint16(payload))
+		reason = string(payload[2:])
+
+		if !utf8.ValidString(reason) {
+			return conn.fail(CloseInvalidPayload, "close reason is not UTF-8")
+		}
+	}
+
+	conn.writeLock.Lock()
+
+	if code == CloseNoStatus {
+		conn.writeClose(CloseNormal, "")
+	} else {
+		conn.writeClose(code, "")
+	}
+
+	conn.writeLock.Unlock()
+
+	if code == CloseNormal || code == CloseGoingAway || code == CloseNoStatus {
+		return io.EOF
+	}
+
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// fail sends the close frame with the code
+// and returns the protocol error.
+func (conn *Conn) fail(code int, reason string) error {
+	conn.writeLock.Lock()
+	conn.writeClose(code, reason)
+	conn.writeLock.Unlock()
+
+	return fmt.Errorf("%w: %s", ErrProtocol, reason)
+}
+
+// writeClose sends the close frame unless it's
+// already sent. The write lock must be held.
+func (conn *Conn) writeClose(code int, reason string) {
+	if conn.closeSent {
+		return
+	}
+
+	conn.closeSent = true
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	conn.writeFrame(opClose, append(payload, reason...))
+}
+
+// writeFrame writes the frame with the FIN bit
+// set to the peer. The write lock must be held.
+func (conn *Conn) writeFrame(opcode byte, payload []byte) error {
+	if conn.closeSent && opcode != opClose {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	var maskBit byte
+
+	if conn.client {
+		maskBit = 0x80
+	}
+
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, maskBit|byte(length))
+
+	case length <= 0xffff:
+		var extended [2]byte
+		binary.BigEndian.PutUint16(extended[:], uint16(length))
+		frame = append(frame, maskBit|126)
+		frame = append(frame, extended[:]...)
+
+	default:
+		var extended [8]byte
+		binary.BigEndian.PutUint64(extended[:], uint64(length))
+		frame = append(frame, maskBit|127)
+		frame = append(frame, extended[:]...)
+	}
+
+	if conn.client {
+		var mask [4]byte
+		_, err := rand.Read(mask[:])
+
+		if err != nil {
+			return err
+		}
+
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := conn.raw.Write(frame)
+
+	return err
+}
+
+// deadline is the read deadline
+// which changes wake up the Read
+// waiting for the message.
+type deadline struct {
+	lock    sync.Mutex
+	at      time.Time
+	changed chan struct{}
+}
+
+// get returns the deadline and
+// the channel closed when it changes.
+func (d *deadline) get() (time.Time, <-chan struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.at, d.changed
+}
+
+// set changes the deadline.
+func (d *deadline) set(at time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.at = at
+	close(d.changed)
+	d.changed = make(chan struct{})
+}
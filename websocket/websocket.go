@@ -0,0 +1,365 @@
+// Package websocket carries kosuzu packets over
+// WebSocket connections, one packet per binary
+// message. It implements the opening handshake
+// and the framing of RFC 6455 on top of net/http,
+// so browser clients can talk to kosuzu servers
+// without a third-party WebSocket library.
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultMaxMessageSize is the maximum size of
+// the message used when Options doesn't set one.
+const DefaultMaxMessageSize = 1 << 20
+
+// acceptGUID is appended to the key
+// of the client to compute the accept
+// key of the server.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrBadHandshake is returned when the
+// opening handshake doesn't follow RFC 6455.
+var ErrBadHandshake = errors.New("bad websocket handshake")
+
+// Options configures the connection.
+type Options struct {
+	// MaxMessageSize is the maximum size
+	// of the message read from the peer and
+	// of the packet written to it. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int64
+	// PingInterval is the interval of the
+	// pings sent to the peer. Zero disables
+	// the pings.
+	PingInterval time.Duration
+	// PongTimeout is how long the connection
+	// waits for any frame from the peer after
+	// the ping interval before it's considered
+	// dead and closed. Zero means PingInterval.
+	PongTimeout time.Duration
+	// CheckOrigin returns true if the request
+	// may be upgraded. If it's nil, the requests
+	// with the Origin header are upgraded only
+	// if the origin host matches the Host header.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// maxMessageSize returns the
+// maximum size of the message.
+func (options *Options) maxMessageSize() int64 {
+	if options == nil || options.MaxMessageSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+
+	return options.MaxMessageSize
+}
+
+// keepalive returns the ping interval and
+// the time to wait for the frames after it.
+func (options *Options) keepalive() (time.Duration, time.Duration) {
+	if options == nil || options.PingInterval <= 0 {
+		return 0, 0
+	}
+
+	if options.PongTimeout <= 0 {
+		return options.PingInterval, options.PingInterval
+	}
+
+	return options.PingInterval, options.PongTimeout
+}
+
+// Handler returns the HTTP handler upgrading
+// the requests to WebSocket connections and
+// passing them to serve. The connection is
+// closed when serve returns.
+func Handler(serve func(conn *Conn), options *Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, options)
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		serve(conn)
+	})
+}
+
+// Upgrade performs the server side of the opening
+// handshake and returns the connection. If the
+// request can't be upgraded, the error response
+// is written and the error is returned.
+func Upgrade(w http.ResponseWriter, r *http.Request, options *Options) (*Conn, error) {
+	fail := func(status int, reason string) (*Conn, error) {
+		http.Error(w, reason, status)
+
+		return nil, fmt.Errorf("%w: %s", ErrBadHandshake, reason)
+	}
+
+	if r.Method != http.MethodGet {
+		return fail(http.StatusMethodNotAllowed, "method is not GET")
+	}
+
+	if !hasToken(r.Header, "Connection", "upgrade") ||
+		!hasToken(r.Header, "Upgrade", "websocket") {
+		return fail(http.StatusBadRequest, "not a websocket upgrade request")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+
+		return fail(http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	checkOrigin := sameOrigin
+
+	if options != nil && options.CheckOrigin != nil {
+		checkOrigin = options.CheckOrigin
+	}
+
+	if !checkOrigin(r) {
+		return fail(http.StatusForbidden, "origin is not allowed")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+
+	if !ok {
+		return fail(http.StatusInternalServerError, "connection can't be hijacked")
+	}
+
+	raw, buffered, err := hijacker.Hijack()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The server may have set the deadlines
+	// for the request, they must not limit
+	// the lifetime of the connection.
+	err = raw.SetDeadline(time.Time{})
+
+	if err == nil {
+		_, err = buffered.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	}
+
+	if err == nil {
+		err = buffered.Flush()
+	}
+
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return newConn(raw, buffered.Reader, false, options), nil
+}
+
+// Dial performs the client side of the opening
+// handshake with the ws:// or wss:// URL. The
+// context bounds the handshake only.
+func Dial(ctx context.Context, rawURL string, options *Options) (*Conn, error) {
+	target, err := url.Parse(rawURL)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var secure bool
+
+	switch target.Scheme {
+	case "ws":
+	case "wss":
+		secure = true
+	default:
+		return nil, fmt.Errorf("unsupported URL scheme: %s", target.Scheme)
+	}
+
+	address := target.Host
+
+	if target.Port() == "" {
+		if secure {
+			address = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+
+	var dialer interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	} = &net.Dialer{}
+
+	if secure {
+		dialer = &tls.Dialer{Config: &tls.Config{ServerName: target.Hostname()}}
+	}
+
+	raw, err := dialer.DialContext(ctx, "tcp", address)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := handshake(ctx, raw, target)
+
+	if err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	return newConn(raw, reader, true, options), nil
+}
+
+// handshake sends the upgrade request
+// and checks the response of the server.
+func handshake(ctx context.Context, raw net.Conn, target *url.URL) (*bufio.Reader, error) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-ctx.Done():
+			raw.SetDeadline(aLongTimeAgo)
+
+		case <-stop:
+		}
+	}()
+
+	reader, err := exchange(raw, target)
+
+	// Stop the goroutine before the deadline is reset,
+	// so the context can't interrupt the connection.
+	close(stop)
+	<-stopped
+
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("websocket handshake: %w", ctx.Err())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = raw.SetDeadline(time.Time{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// exchange writes the upgrade request
+// and reads the response to it.
+func exchange(raw net.Conn, target *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	_, err := rand.Read(nonce)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := &http.Request{
+		Method:     http.MethodGet,
+		URL:        target,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: target.Host,
+	}
+	err = request.Write(raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(raw)
+	response, err := http.ReadResponse(reader, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		!hasToken(response.Header, "Connection", "upgrade") ||
+		!hasToken(response.Header, "Upgrade", "websocket") ||
+		response.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, fmt.Errorf("%w: unexpected response %s",
+			ErrBadHandshake, response.Status)
+	}
+
+	return reader, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept
+// value for the key sent by the client.
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// hasToken returns true if the comma-separated
+// header contains the token, ignoring case.
+func hasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sameOrigin returns true if the request has no
+// Origin header or its host matches the Host one.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(parsed.Host, r.Host)
+}
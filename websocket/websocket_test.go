@@ -0,0 +1,481 @@
+package websocket_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zergon321/kosuzu"
+	"github.com/zergon321/kosuzu/websocket"
+)
+
+type Ping struct {
+	Text string
+}
+
+func (Ping) Opcode() int32 {
+	return 1
+}
+
+type Pong struct {
+	Text string
+}
+
+func (*Pong) Opcode() int32 {
+	return 2
+}
+
+// serve starts the server passing the upgraded
+// connections to the handler and returns its
+// ws:// URL.
+func serve(t *testing.T, handle func(conn *websocket.Conn), options *websocket.Options) string {
+	server := httptest.NewServer(websocket.Handler(handle, options))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string, options *websocket.Options) *websocket.Conn {
+	conn, err := websocket.Dial(context.Background(), url, options)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// echo sends the packets read
+// from the connection back.
+func echo(conn *websocket.Conn) {
+	for {
+		packet, err := conn.ReadPacket()
+
+		if err != nil {
+			return
+		}
+
+		err = conn.WritePacket(packet)
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func TestPackets(t *testing.T) {
+	conn := dial(t, serve(t, echo, nil), nil)
+
+	for _, size := range []int{0, 100, 1000, 70000} {
+		packet := kosuzu.NewPacket(int32(size), bytes.Repeat([]byte{7}, size))
+		packet.SetChecksum(size%2 == 0)
+
+		// WriteTo writes the packet in parts,
+		// but it's sent as one message anyway.
+		_, err := packet.WriteTo(conn)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		echoed, err := conn.ReadPacket()
+
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if echoed.Opcode != int32(size) || !bytes.Equal(echoed.Payload(), packet.Payload()) {
+			t.Fatalf("%d bytes: unexpected packet echoed", size)
+		}
+	}
+
+	packet := kosuzu.NewPacket(3, []byte("suzunaan"))
+
+	if err := conn.WritePacket(packet); err != nil {
+		t.Fatal(err)
+	}
+
+	_, echoed, err := kosuzu.ReadPacketFrom(conn)
+
+	if err != nil || string(echoed.Payload()) != "suzunaan" {
+		t.Fatalf("unexpected packet read: %v", err)
+	}
+}
+
+func TestRPC(t *testing.T) {
+	server := kosuzu.NewServer()
+	err := server.Handle(Ping{}, func(ctx context.Context, request kosuzu.Message) (kosuzu.Message, error) {
+		return &Pong{Text: request.(Ping).Text}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := serve(t, func(conn *websocket.Conn) {
+		server.Serve(context.Background(), conn)
+	}, nil)
+	client := kosuzu.NewClient(dial(t, url, nil))
+	var pong Pong
+	err = client.Call(context.Background(), Ping{Text: "reimu"}, &pong)
+
+	if err != nil || pong.Text != "reimu" {
+		t.Fatalf("unexpected response: %+v, %v", pong, err)
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	options := &websocket.Options{PingInterval: 10 * time.Millisecond}
+	raw, reader := rawDial(t, serve(t, echo, options))
+	defer raw.Close()
+
+	// The peer answering the pings is kept
+	// while nothing else is sent.
+	for i := 0; i < 5; i++ {
+		opcode, payload := readFrame(t, reader)
+
+		if opcode != 0x9 {
+			t.Fatalf("expected ping, got opcode %d", opcode)
+		}
+
+		writeFrame(t, raw, 0xa, payload, false)
+	}
+
+	data, err := kosuzu.NewPacket(1, nil).Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFrame(t, raw, 0x2, data, false)
+
+	for {
+		opcode, payload := readFrame(t, reader)
+
+		if opcode == 0x2 && bytes.Equal(payload, data) {
+			break
+		}
+
+		if opcode != 0x9 {
+			t.Fatalf("expected echoed packet, got opcode %d", opcode)
+		}
+	}
+
+	// The peer which never answers is dropped.
+	failed := make(chan error, 1)
+	url := serve(t, func(conn *websocket.Conn) {
+		_, err := conn.ReadPacket()
+		failed <- err
+	}, options)
+	silent, reader := rawDial(t, url)
+	defer silent.Close()
+
+	if opcode, _ := readFrame(t, reader); opcode != 0x9 {
+		t.Fatalf("expected ping, got opcode %d", opcode)
+	}
+
+	select {
+	case err := <-failed:
+		var netErr net.Error
+
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Fatalf("expected timeout, got %v", err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the silent peer to be dropped")
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	failed := make(chan error, 1)
+	url := serve(t, func(conn *websocket.Conn) {
+		_, err := conn.ReadPacket()
+		failed <- err
+	}, &websocket.Options{MaxMessageSize: 64})
+	conn := dial(t, url, nil)
+
+	if err := conn.WritePacket(kosuzu.NewPacket(1, make([]byte, 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-failed; !errors.Is(err, websocket.ErrMessageTooBig) {
+		t.Fatalf("expected message too big, got %v", err)
+	}
+
+	var closeErr *websocket.CloseError
+
+	if _, err := conn.ReadPacket(); !errors.As(err, &closeErr) ||
+		closeErr.Code != websocket.CloseMessageTooBig {
+		t.Fatalf("expected close status 1009, got %v", err)
+	}
+
+	small := dial(t, serve(t, echo, nil), &websocket.Options{MaxMessageSize: 64})
+	err := small.WritePacket(kosuzu.NewPacket(1, make([]byte, 100)))
+
+	if !errors.Is(err, websocket.ErrMessageTooBig) {
+		t.Fatalf("expected the packet to be rejected, got %v", err)
+	}
+}
+
+func TestFraming(t *testing.T) {
+	packets := make(chan *kosuzu.Packet, 1)
+	failed := make(chan error, 1)
+	url := serve(t, func(conn *websocket.Conn) {
+		for {
+			packet, err := conn.ReadPacket()
+
+			if err != nil {
+				failed <- err
+				return
+			}
+
+			packets <- packet
+		}
+	}, nil)
+	data, err := kosuzu.NewPacket(5, []byte("suzunaan")).Bytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, reader := rawDial(t, url)
+	defer raw.Close()
+
+	// The fragments are interleaved with the ping.
+	writeFrame(t, raw, 0x02, data[:5], true)
+	writeFrame(t, raw, 0x09, []byte("hi"), false)
+	writeFrame(t, raw, 0x00, data[5:], false)
+
+	if opcode, payload := readFrame(t, reader); opcode != 0xa || string(payload) != "hi" {
+		t.Fatalf("expected pong, got opcode %d", opcode)
+	}
+
+	if packet := <-packets; string(packet.Payload()) != "suzunaan" {
+		t.Fatalf("unexpected packet: %q", packet.Payload())
+	}
+
+	writeFrame(t, raw, 0x08, []byte{0x03, 0xe8}, false)
+
+	if opcode, payload := readFrame(t, reader); opcode != 0x8 ||
+		binary.BigEndian.Uint16(payload) != websocket.CloseNormal {
+		t.Fatalf("expected normal close, got opcode %d, % x", opcode, payload)
+	}
+
+	if err := <-failed; err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		header []byte
+		code   uint16
+	}{
+		{"unmasked", []byte{0x82, 0x00}, websocket.CloseProtocolError},
+		{"reserved bits", []byte{0xc2, 0x80, 0, 0, 0, 0}, websocket.CloseProtocolError},
+		{"text", []byte{0x81, 0x80, 0, 0, 0, 0}, websocket.CloseUnsupportedData},
+		{"unknown opcode", []byte{0x83, 0x80, 0, 0, 0, 0}, websocket.CloseProtocolError},
+		{"continuation", []byte{0x80, 0x80, 0, 0, 0, 0}, websocket.CloseProtocolError},
+		{"fragmented ping", []byte{0x09, 0x80, 0, 0, 0, 0}, websocket.CloseProtocolError},
+		{"long ping", []byte{0x89, 0xfe, 0, 126}, websocket.CloseProtocolError},
+		{"huge", []byte{0x82, 0xff, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, websocket.CloseMessageTooBig},
+		{"negative", []byte{0x82, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, websocket.CloseProtocolError},
+	} {
+		raw, reader := rawDial(t, url)
+		_, err := raw.Write(test.header)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opcode, payload := readFrame(t, reader)
+		raw.Close()
+
+		if opcode != 0x8 || len(payload) < 2 || binary.BigEndian.Uint16(payload) != test.code {
+			t.Fatalf("%s: expected close status %d, got opcode %d, % x",
+				test.name, test.code, opcode, payload)
+		}
+
+		if err := <-failed; err == nil {
+			t.Fatalf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	conn := dial(t, serve(t, echo, nil), nil)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err := conn.Read(make([]byte, 1))
+
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	read := make(chan error, 1)
+
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		read <- err
+	}()
+
+	// The pending read is interrupted.
+	conn.SetDeadline(time.Unix(1, 0))
+
+	if err := <-read; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = kosuzu.Handshake(ctx, dial(t, serve(t, echo, nil), nil), kosuzu.Hello{})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled handshake, got %v", err)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	url := serve(t, echo, nil)
+	httpURL := "http" + strings.TrimPrefix(url, "ws")
+	valid := http.Header{
+		"Connection":            {"keep-alive, Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+	}
+
+	for _, test := range []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"not upgrade", "Upgrade", "h2c", http.StatusBadRequest},
+		{"version", "Sec-Websocket-Version", "8", http.StatusUpgradeRequired},
+		{"key", "Sec-Websocket-Key", "short", http.StatusBadRequest},
+		{"origin", "Origin", "http://example.com", http.StatusForbidden},
+	} {
+		request, err := http.NewRequest(http.MethodGet, httpURL, nil)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for name, values := range valid {
+			request.Header[name] = values
+		}
+
+		request.Header.Set(test.header, test.value)
+		response, err := http.DefaultClient.Do(request)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != test.status {
+			t.Fatalf("%s: expected status %d, got %d",
+				test.name, test.status, response.StatusCode)
+		}
+	}
+
+	_, err := websocket.Dial(context.Background(), httpURL, nil)
+
+	if err == nil {
+		t.Fatalf("expected error for the http:// URL")
+	}
+}
+
+// rawDial performs the opening handshake
+// and returns the connection to write
+// and read the frames by hand.
+func rawDial(t *testing.T, url string) (net.Conn, *bufio.Reader) {
+	raw, err := net.Dial("tcp", strings.TrimPrefix(url, "ws://"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = io.WriteString(raw, "GET / HTTP/1.1\r\n"+
+		"Host: "+strings.TrimPrefix(url, "ws://")+"\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(raw)
+	response, err := http.ReadResponse(reader, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The example from RFC 6455.
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected response: %s, %v", response.Status, response.Header)
+	}
+
+	return raw, reader
+}
+
+// writeFrame writes the masked frame.
+func writeFrame(t *testing.T, raw net.Conn, opcode byte, payload []byte, fragment bool) {
+	fin := byte(0x80)
+
+	if fragment {
+		fin = 0
+	}
+
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{fin | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := raw.Write(frame)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame reads the short unmasked
+// frame sent by the server.
+func readFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(reader, header)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make([]byte, header[1]&0x7f)
+	_, err = io.ReadFull(reader, payload)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return header[0] & 0x0f, payload
+}